@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// alias is a shortcut from the aliases config key: go-npm-run <name> runs
+// Script of Package, given by name or directory, with Args in front of the
+// forwarded arguments. In the config it is either a mapping or the string
+// "package script [args...]".
+type alias struct {
+	Name    string   `yaml:"-"`
+	Package string   `yaml:"package"`
+	Script  string   `yaml:"script"`
+	Args    []string `yaml:"args"`
+}
+
+func (a *alias) UnmarshalYAML(unmarshal func(any) error) error {
+	var short string
+	if err := unmarshal(&short); err == nil {
+		fields := strings.Fields(short)
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid alias %q, expected \"package script [args...]\"", short)
+		}
+		a.Package, a.Script, a.Args = fields[0], fields[1], fields[2:]
+		return nil
+	}
+	type plain alias
+	return unmarshal((*plain)(a))
+}
+
+func (a alias) String() string {
+	parts := []string{a.Package, a.Script}
+	for _, arg := range a.Args {
+		parts = append(parts, runner.ShellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// printAliases writes the configured aliases, sorted by name, one per line.
+func printAliases(w io.Writer, aliases map[string]alias) {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, aliases[name])
+	}
+}
+
+// aliasAtPath returns the script of a when its package is a directory with
+// a package.json, which is then read without scanning. ok is false when
+// the package has to be looked up by name.
+func aliasAtPath(a alias) (script discover.NpmScript, ok bool, err error) {
+	path := filepath.Join(a.Package, "package.json")
+	if _, err := os.Stat(path); err != nil {
+		return script, false, nil
+	}
+	_, scripts, err := discover.ReadPackageJSON(path)
+	if err != nil {
+		return script, true, fmt.Errorf("alias %s: %w", a.Name, err)
+	}
+	for _, s := range scripts {
+		if s.ScriptName == a.Script {
+			return s, true, nil
+		}
+	}
+	return script, true, fmt.Errorf("alias %s: %s has no script %q", a.Name, path, a.Script)
+}
+
+// aliasInScripts returns the script of a from the discovered scripts,
+// looking its package up by name.
+func aliasInScripts(a alias, scripts []discover.NpmScript) (discover.NpmScript, error) {
+	found := false
+	for _, script := range scripts {
+		if script.PackageName != a.Package {
+			continue
+		}
+		found = true
+		if script.ScriptName == a.Script {
+			return script, nil
+		}
+	}
+	if found {
+		return discover.NpmScript{}, fmt.Errorf("alias %s: package %s has no script %q", a.Name, a.Package, a.Script)
+	}
+	return discover.NpmScript{}, fmt.Errorf("alias %s: no package named or at %s found", a.Name, a.Package)
+}
+
+// validateAliases checks the aliases of a config file.
+func validateAliases(aliases map[string]alias) error {
+	for name, a := range aliases {
+		switch {
+		case name == "" || strings.ContainsAny(name, " \t/"):
+			return fmt.Errorf("aliases: invalid name %q", name)
+		case a.Package == "" || a.Script == "":
+			return fmt.Errorf("aliases: %s needs a package and a script", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// Reasons a package's run never started.
+var (
+	errDependencyFailed = errors.New("dependency failed")
+	errCancelled        = errors.New("cancelled after a failure")
+)
+
+// allResult is the outcome of running the script in one package.
+type allResult struct {
+	inv      invocation
+	code     int
+	err      error
+	duration time.Duration
+	// attempts is how many times the script ran, see --retry.
+	attempts int
+	// interrupted is set when --fail-fast stopped the run.
+	interrupted bool
+	// logPath is the --log file the output was written to.
+	logPath string
+}
+
+func (r allResult) failed() bool {
+	return r.err != nil && !errors.Is(r.err, errIncompatible) || r.code != 0
+}
+
+func (r allResult) skipped() bool {
+	return errors.Is(r.err, errDependencyFailed) || errors.Is(r.err, errCancelled) || errors.Is(r.err, errIncompatible)
+}
+
+// runAll runs opts.scriptName in every package that defines it, in the
+// order of scripts or with --order topo dependencies first, see
+// runScripts.
+func runAll(opts *options, scripts []discover.NpmScript) {
+	var candidates []discover.NpmScript
+	defines := map[string]bool{}
+	for _, script := range scripts {
+		if script.ScriptName == opts.scriptName {
+			candidates = append(candidates, script)
+			defines[script.AbsolutePath] = true
+		}
+	}
+	if len(candidates) == 0 {
+		noScriptNamed(opts, opts.scriptName)
+	}
+	for _, script := range scripts {
+		if !defines[script.AbsolutePath] {
+			defines[script.AbsolutePath] = true
+			debugf("skipping %s: no %q script", script.AbsolutePath, opts.scriptName)
+		}
+	}
+
+	// Packages that cannot run here only show up in the recap
+	var skipped []allResult
+	compatible := candidates[:0]
+	for _, script := range candidates {
+		if incompatible(opts, script) {
+			debugf("skipping %s: %s", script.AbsolutePath, platformNote(script))
+			skipped = append(skipped, allResult{inv: invocation{Invocation: runner.Invocation{Script: script}}, err: errIncompatible})
+		} else {
+			compatible = append(compatible, script)
+		}
+	}
+	candidates = compatible
+
+	var deps map[string][]string
+	if opts.order == orderTopo {
+		var err error
+		candidates, deps, err = topoSortScripts(candidates, scripts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+	}
+
+	runScripts(opts, candidates, skipped, deps, opts.scriptName)
+}
+
+// runNames runs the scripts named on the command line one after another,
+// like runAll runs one name in many packages. Every name resolves like a
+// single one: the script of the package at the search path, or the only
+// script with that name; the picker, filtered by the name, chooses between
+// the others. Nothing runs until every name has resolved. --if-present
+// skips the names no package defines.
+func runNames(opts *options, scripts []discover.NpmScript) {
+	var chosen []discover.NpmScript
+	for _, name := range opts.scriptNames {
+		if script, ok := findScriptByName(scripts, name, opts.searchPath); ok {
+			chosen = append(chosen, script)
+			continue
+		}
+		if !hasScriptNamed(scripts, name) {
+			if opts.ifPresent {
+				infof("No script named %q found, skipping it (--if-present).", name)
+				continue
+			}
+			noScriptNamed(opts, name)
+		}
+		if !isTerminal(os.Stdin) && !usePlain(opts) {
+			fmt.Fprintf(os.Stderr, "Error: several packages define %q and stdin is not a terminal to pick one, run it from its package directory.\n", name)
+			os.Exit(exitFailure)
+		}
+		idx, err := pick(opts, scripts, name)
+		if err != nil {
+			pickAborted(opts, err)
+			return
+		}
+		chosen = append(chosen, scripts[idx])
+	}
+	if len(chosen) == 0 {
+		// Every name was skipped by --if-present
+		return
+	}
+	runScripts(opts, chosen, nil, nil, strings.Join(opts.scriptNames, " "))
+}
+
+// runScripts runs scripts, one per package with --all or one per name
+// otherwise, and exits non-zero when any run failed. Every run gets a
+// header and a recap of all runs is printed at the end, along with the
+// skipped results of the packages that never ran. deps are the
+// dependencies between the packages for --parallel, name is what the
+// notification calls the runs.
+//
+// Sequential runs stop at the first failure unless --keep-going is set,
+// parallel runs only with --fail-fast. After stopping early the exit code
+// is that of the first failure, otherwise any failure exits with 1.
+func runScripts(opts *options, scripts []discover.NpmScript, skipped []allResult, deps map[string][]string, name string) {
+	var invocations []invocation
+	for _, script := range scripts {
+		inv := resolveInvocation(script, opts)
+		err := checkRunDir(inv)
+		if err == nil {
+			err = applyScriptEnv(&inv, opts)
+		}
+		var values map[string]string
+		if err == nil {
+			values, err = fillPlaceholders(&inv, opts)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		// Answer the placeholders once for all runs
+		if values != nil {
+			opts.values = values
+		}
+		invocations = append(invocations, inv)
+	}
+
+	switch {
+	case opts.print == printCommand:
+		for _, inv := range invocations {
+			fmt.Println(inv.CommandLine())
+		}
+		return
+	case opts.print == printRaw:
+		for _, inv := range invocations {
+			fmt.Println(inv.Script.Command)
+		}
+		return
+	case opts.dryRun:
+		printDryRun(os.Stdout, invocations)
+		return
+	}
+
+	confirmDangerous(opts, invocations)
+	confirmPlatform(opts, invocations)
+	for _, inv := range invocations {
+		if inv.PackageManager != "bun" {
+			checkNodeVersion(opts, inv.Script)
+		}
+	}
+	ensureInstalled(opts, invocations)
+
+	if !opts.noHistory {
+		for i, inv := range invocations {
+			entry, err := recordHistory(inv.Script, opts.scriptArgs, opts.values)
+			if err != nil {
+				debugf("cannot record history: %v", err)
+				continue
+			}
+			invocations[i].recorded = &entry
+		}
+	}
+
+	failFast := opts.failFast || (!opts.parallel && !opts.keepGoing)
+	start := time.Now()
+	var results []allResult
+	var first int
+	if opts.parallel {
+		results, first = runParallel(invocations, deps, opts.jobs, failFast, opts.output == outputGroup, opts.gha)
+	} else {
+		results, first = runSequential(invocations, failFast, opts.gha)
+	}
+
+	total := time.Since(start)
+	results = append(results, skipped...)
+	if opts.notify && total >= opts.notifyAfter {
+		notifyRecap(name, results)
+	}
+	if opts.gha {
+		ghaAnnotations(os.Stdout, results)
+	}
+	if printRecap(results, total) {
+		return
+	}
+	if failFast && results[first].code > 0 {
+		os.Exit(results[first].code)
+	}
+	os.Exit(exitFailure)
+}
+
+// dependencyInvocations resolves the --with-deps script of every workspace
+// package the package of script depends on, in the order they have to run.
+// The project script belongs to is scanned again rather than reusing the
+// discovered scripts, dependencies of the package count even when filters
+// or the search path leave them out.
+func dependencyInvocations(opts *options, script discover.NpmScript) []invocation {
+	root := discover.ProjectRoot(filepath.Dir(script.AbsolutePath))
+	scripts := discover.ExtractScripts(context.Background(), discover.FindPackages(context.Background(), root))
+	if path, err := filepath.Abs(script.AbsolutePath); err == nil {
+		script.AbsolutePath = path
+	}
+	deps, err := dependencyScripts(script, scripts, opts.withDeps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitFailure)
+	}
+
+	// The arguments after -- are for the selected script only
+	depOpts := *opts
+	depOpts.scriptArgs = nil
+	var invocations []invocation
+	for _, dep := range deps {
+		inv := resolveInvocation(dep, &depOpts)
+		err := checkRunDir(inv)
+		if err == nil {
+			err = applyScriptEnv(&inv, &depOpts)
+		}
+		if err == nil {
+			_, err = fillPlaceholders(&inv, &depOpts)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		invocations = append(invocations, inv)
+	}
+	debugf("--with-deps %s: %d dependencies define it", opts.withDeps, len(invocations))
+	return invocations
+}
+
+// runDependencies runs the --with-deps invocations before inv, exiting
+// with the exit code of the first one to fail.
+func runDependencies(opts *options, deps []invocation, inv invocation) {
+	results, first := runSequential(deps, true, opts.gha)
+	if first < 0 {
+		return
+	}
+	failed := results[first].inv.Script
+	fmt.Fprintf(os.Stderr, "Error: %s of %s (%s) failed, %s was not started\n", failed.ScriptName, failed.PackageName, displayPath(failed.AbsolutePath), inv.Script.Label())
+	if code := results[first].code; code > 0 {
+		os.Exit(code)
+	}
+	os.Exit(exitFailure)
+}
+
+// runSequential runs invocations one after another. With failFast the
+// remaining ones are cancelled after the first failure. first is the index
+// of the first failed run, -1 when all passed. With gha the output of
+// every run is a GitHub Actions log group instead of following a header.
+func runSequential(invocations []invocation, failFast, gha bool) (results []allResult, first int) {
+	first = -1
+	for i, inv := range invocations {
+		if first >= 0 && failFast {
+			results = append(results, allResult{inv: inv, err: errCancelled})
+			continue
+		}
+		var result allResult
+		if gha {
+			ghaGroup(os.Stdout, fmt.Sprintf("[%d/%d] %s (%s)", i+1, len(invocations), inv.Script.Label(), inv.Script.AbsolutePath))
+			stdout := &lineEndWriter{w: os.Stdout, ended: true}
+			result = runOne(context.Background(), inv, os.Stdin, stdout, os.Stderr)
+			ghaEndGroup(stdout)
+		} else {
+			infof("==> [%d/%d] %s (%s)", i+1, len(invocations), inv.Script.Label(), inv.Script.AbsolutePath)
+			result = runOne(context.Background(), inv, os.Stdin, os.Stdout, os.Stderr)
+		}
+		if result.failed() && first < 0 {
+			first = i
+		}
+		results = append(results, result)
+	}
+	return results, first
+}
+
+func runOne(ctx context.Context, inv invocation, stdin io.Reader, stdout, stderr io.Writer) allResult {
+	start := time.Now()
+	var runLog *scriptLog
+	if inv.logPath != "" {
+		var err error
+		if runLog, err = openScriptLog(inv); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return allResult{inv: inv, err: err}
+		}
+		stdout, stderr = runLog.tee(stdout), runLog.tee(stderr)
+	}
+	if inv.timestamps != timestampsOff {
+		stdout, stderr = newTimestampWriter(stdout, inv.timestamps, start), newTimestampWriter(stderr, inv.timestamps, start)
+	}
+	var code, attempts int
+	var err error
+	if inv.errorsOnly {
+		code, attempts, err = runCaptured(ctx, inv, stdin, stderr)
+	} else {
+		code, attempts, err = runAttempts(ctx, inv, stdin, stdout, stderr)
+	}
+	// resultLine reports timeouts
+	if err != nil && !errors.Is(err, errTimedOut) {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+	}
+	result := allResult{inv: inv, code: code, err: err, duration: time.Since(start), attempts: attempts}
+	result.interrupted = result.failed() && ctx.Err() != nil
+	if runLog != nil {
+		runLog.close(code, err)
+		result.logPath = runLog.path
+	}
+	if inv.recorded != nil {
+		if err := completeHistory(*inv.recorded, result); err != nil {
+			debugf("cannot record the outcome in the history: %v", err)
+		}
+	}
+	return result
+}
+
+// runParallel runs up to jobs invocations at the same time. An invocation
+// only starts once every package it depends on, according to deps, has
+// finished successfully; it is skipped when one of them failed. Output
+// lines are prefixed with the package name, with group the output of every
+// run is held until it finished and then written as one block, a GitHub
+// Actions log group with gha. Results keep the input order, first is the
+// index of the first run to fail, -1 when all passed.
+//
+// With failFast the first failure cancels everything not started yet and
+// interrupts the running scripts, which are waited for before returning.
+func runParallel(invocations []invocation, deps map[string][]string, jobs int, failFast, group, gha bool) (results []allResult, first int) {
+	start := time.Now()
+	results = make([]allResult, len(invocations))
+	first = -1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The scripts run in their own process groups and miss the terminal's
+	// Ctrl-C, pass it on by cancelling everything
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	var interrupted os.Signal
+	index := map[string]int{}
+	for i, inv := range invocations {
+		index[inv.Script.AbsolutePath] = i
+	}
+
+	var outputMu sync.Mutex
+	finished := make(chan int)
+	started := make([]bool, len(invocations))
+	done := make([]bool, len(invocations))
+	running, remaining := 0, len(invocations)
+
+	for remaining > 0 {
+		for i, inv := range invocations {
+			if started[i] || running >= jobs {
+				continue
+			}
+			if ctx.Err() != nil {
+				started[i], done[i] = true, true
+				results[i] = allResult{inv: inv, err: errCancelled}
+				remaining--
+				continue
+			}
+			ready, blocked := true, false
+			for _, dep := range deps[inv.Script.AbsolutePath] {
+				d := index[dep]
+				if !done[d] {
+					ready = false
+				} else if results[d].failed() {
+					blocked = true
+				}
+			}
+			if blocked {
+				started[i], done[i] = true, true
+				results[i] = allResult{inv: inv, err: errDependencyFailed}
+				remaining--
+				continue
+			}
+			if !ready {
+				continue
+			}
+
+			started[i] = true
+			running++
+			// Grouped output has its header once the block is written
+			if !group {
+				infof("==> started %s (%s)", inv.Script.Label(), inv.Script.AbsolutePath)
+			}
+			go func(i int, inv invocation) {
+				if group {
+					output := &groupBuffer{limit: groupMemoryLimit}
+					results[i] = runOne(ctx, inv, nil, output, output)
+					outputMu.Lock()
+					writeGroup(os.Stdout, results[i], output, gha)
+					outputMu.Unlock()
+					output.close()
+					finished <- i
+					return
+				}
+				prefix := "[" + inv.Script.PackageName + "] "
+				stdout := &prefixWriter{w: os.Stdout, mu: &outputMu, prefix: prefix}
+				stderr := &prefixWriter{w: os.Stderr, mu: &outputMu, prefix: prefix}
+				// Concurrent scripts cannot share the terminal's input, none gets it
+				results[i] = runOne(ctx, inv, nil, stdout, stderr)
+				stdout.flush()
+				stderr.flush()
+				finished <- i
+			}(i, inv)
+		}
+		if running == 0 {
+			// Everything left was skipped in the loop above
+			continue
+		}
+		var i int
+		select {
+		case sig := <-signals:
+			interrupted = sig
+			cancel()
+			continue
+		case i = <-finished:
+		}
+		done[i] = true
+		running--
+		remaining--
+		if results[i].failed() && !results[i].interrupted && first < 0 {
+			first = i
+			if failFast {
+				cancel()
+			}
+		}
+	}
+	if interrupted != nil {
+		printRecap(results, time.Since(start))
+		os.Exit(signalExitCode(interrupted))
+	}
+	return results, first
+}
+
+// prefixWriter writes every complete line with prefix, serialized through
+// mu so lines of concurrent scripts never interleave.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(data), nil
+}
+
+// flush writes a trailing line without newline, if any.
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+}
+
+// topoSortScripts orders candidates, at most one per package, so that
+// every package runs after the discovered packages it depends on. The
+// dependencies between the candidates are returned as well.
+func topoSortScripts(candidates, scripts []discover.NpmScript) ([]discover.NpmScript, map[string][]string, error) {
+	byPath := map[string]discover.NpmScript{}
+	names := map[string]string{}
+	var targets []string
+	for _, script := range candidates {
+		byPath[script.AbsolutePath] = script
+		targets = append(targets, script.AbsolutePath)
+	}
+	for _, script := range scripts {
+		names[script.AbsolutePath] = script.PackageName
+	}
+
+	deps := targetDependencies(targets, workspaceGraph(scripts))
+	ordered, err := topoOrder(targets, deps, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	sorted := make([]discover.NpmScript, len(ordered))
+	for i, path := range ordered {
+		sorted[i] = byPath[path]
+	}
+	return sorted, deps, nil
+}
+
+// printRecap prints the resultLine of every run and a tally with the
+// total wall-clock time, and reports whether every run passed.
+func printRecap(results []allResult, total time.Duration) bool {
+	failed, skipped, incompatible := 0, 0, 0
+	infof("")
+	for _, r := range results {
+		infof("%s", resultLine(r))
+		if r.logPath != "" {
+			infof("    log: %s", displayPath(r.logPath))
+		}
+		switch {
+		case errors.Is(r.err, errIncompatible):
+			incompatible++
+		case r.skipped():
+			skipped++
+		case r.failed():
+			infof("    %s %s", paint(colorCyan, "→"), describeRun(r.inv))
+			failed++
+		}
+	}
+	tally := fmt.Sprintf("%d passed, %d failed", len(results)-failed-skipped-incompatible, failed)
+	if skipped+incompatible > 0 {
+		tally += fmt.Sprintf(", %d skipped", skipped+incompatible)
+	}
+	infof("%s in %s", tally, total.Round(10*time.Millisecond))
+	return failed == 0 && skipped == 0
+}
+
+// resultLine summarizes a run on one line: a green ✓ or a red ✗, "-" for
+// runs that never started, the script, how long it ran and why it failed.
+func resultLine(r allResult) string {
+	label := r.inv.Script.Label()
+	if r.skipped() {
+		return fmt.Sprintf("- %s (skipped: %v)", label, r.err)
+	}
+	mark := paint(colorGreen, "✓")
+	if r.failed() {
+		mark = paint(colorRed, "✗")
+	}
+	line := fmt.Sprintf("%s %s", mark, label)
+	var details []string
+	switch {
+	case r.interrupted:
+		details = append(details, "interrupted")
+	case r.err != nil:
+		// The error of a run that timed out says how long it took
+		details = append(details, r.err.Error())
+	case r.code != 0:
+		details = append(details, fmt.Sprintf("exit code %d", r.code))
+	}
+	if r.err == nil || r.interrupted {
+		line += " in " + r.duration.Round(10*time.Millisecond).String()
+	}
+	if note := attemptsNote(r.inv, r.attempts); note != "" {
+		details = append(details, note)
+	}
+	if len(details) > 0 {
+		line += " (" + strings.Join(details, ", ") + ")"
+	}
+	return line
+}
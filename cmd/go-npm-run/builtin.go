@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ktr0731/go-fuzzyfinder"
+	"github.com/ktr0731/go-fuzzyfinder/matching"
+	"github.com/mattn/go-runewidth"
+)
+
+// newBuiltinScreen opens the terminal for the built-in finder, tests swap
+// in a simulation screen.
+var newBuiltinScreen = tcell.NewScreen
+
+// builtinReload is how often the built-in finder looks for new items when
+// they can change while it is open, redrawing the preview as well.
+const builtinReload = 50 * time.Millisecond
+
+// builtinOptions configure one run of the built-in finder.
+type builtinOptions struct {
+	// header lines are shown above the count line, the last one closest to
+	// the prompt.
+	header   string
+	query    string
+	caseMode string
+	exact    bool
+	// cursor is the item highlighted first, -1 for the best match.
+	cursor int
+	// preview returns the preview pane content of item i, -1 when nothing
+	// matches. The pane is hidden when preview is nil.
+	preview func(i, width, height int) string
+	// keys close the finder like enter does and report which was pressed,
+	// named like fzf's --expect, e.g. "ctrl-o" and "alt-e".
+	keys []string
+	// lock guards items when they change while the finder is open, they
+	// are reloaded holding it and loaded is called after every load.
+	lock   sync.Locker
+	loaded func()
+	ctx    context.Context
+}
+
+// builtinResult is how the built-in finder was closed: the highlighted
+// item, -1 when nothing matched, the action key pressed, empty for enter,
+// and the query typed.
+type builtinResult struct {
+	idx   int
+	key   string
+	query string
+}
+
+// builtinFinder is the state of the built-in finder. It looks and edits the
+// prompt like go-fuzzyfinder, whose matching it uses, and adds the action
+// keys fzf gets from --expect.
+type builtinFinder struct {
+	screen  tcell.Screen
+	opts    builtinOptions
+	labels  []string
+	input   []rune
+	x       int
+	matched []matching.Matched
+	// y is the position of the cursor in matched, offset the one shown
+	// on the lowest line of the list.
+	y, offset int
+}
+
+// pickBuiltin runs the built-in finder over items until an item is chosen,
+// an action key pressed or the finder aborted, which returns
+// fuzzyfinder.ErrAbort. Canceling opts.ctx closes it with the context's
+// error.
+func pickBuiltin(items *[]pickerItem, opts builtinOptions) (builtinResult, error) {
+	screen, err := newBuiltinScreen()
+	if err != nil {
+		return builtinResult{idx: -1}, err
+	}
+	if err := screen.Init(); err != nil {
+		return builtinResult{idx: -1}, err
+	}
+	defer screen.Fini()
+
+	f := &builtinFinder{screen: screen, opts: opts, input: []rune(opts.query)}
+	f.x = len(f.input)
+	f.load(items)
+	f.filter()
+	for i, m := range f.matched {
+		if m.Idx == opts.cursor {
+			f.y = i
+			break
+		}
+	}
+
+	events := make(chan tcell.Event)
+	quit := make(chan struct{})
+	defer close(quit)
+	go screen.ChannelEvents(events, quit)
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var reload <-chan time.Time
+	if opts.lock != nil {
+		ticker := time.NewTicker(builtinReload)
+		defer ticker.Stop()
+		reload = ticker.C
+	}
+
+	for {
+		f.draw()
+		select {
+		case <-ctx.Done():
+			return builtinResult{idx: -1, query: string(f.input)}, ctx.Err()
+		case <-reload:
+			if f.load(items) {
+				f.filter()
+			}
+		case event := <-events:
+			switch event := event.(type) {
+			case *tcell.EventResize:
+				screen.Sync()
+			case *tcell.EventKey:
+				if result, done, err := f.key(event); done {
+					return result, err
+				}
+			}
+		}
+	}
+}
+
+// load reads the labels of items unless their number is unchanged since
+// the last load, and reports whether it did.
+func (f *builtinFinder) load(items *[]pickerItem) bool {
+	if f.opts.lock != nil {
+		f.opts.lock.Lock()
+		defer f.opts.lock.Unlock()
+	}
+	if f.labels != nil && len(f.labels) == len(*items) {
+		return false
+	}
+	f.labels = make([]string, len(*items))
+	for i, item := range *items {
+		f.labels[i] = item.label
+	}
+	if f.opts.loaded != nil {
+		f.opts.loaded()
+	}
+	return true
+}
+
+// filter matches the labels against the prompt, keeping the cursor in
+// the list.
+func (f *builtinFinder) filter() {
+	f.matched = matchItems(f.labels, string(f.input), f.opts.caseMode, f.opts.exact)
+	if f.y >= len(f.matched) {
+		f.y = len(f.matched) - 1
+	}
+	if f.y < 0 {
+		f.y = 0
+	}
+}
+
+// matchItems returns the labels matching query, best first, or all of them
+// in order for an empty query. With exact a label has to contain the query
+// as is, which --case decides for like for fuzzy matching, before the
+// fuzzy score orders what is left.
+func matchItems(labels []string, query, caseMode string, exact bool) []matching.Matched {
+	if query == "" {
+		all := make([]matching.Matched, len(labels))
+		for i := range labels {
+			all[i] = matching.Matched{Idx: i, Pos: [2]int{-1, -1}}
+		}
+		return all
+	}
+	mode := matching.WithMode(matchingMode(caseMode))
+	if !exact {
+		return matching.FindAll(query, labels, mode)
+	}
+
+	ignoreCase := caseMode == caseIgnore || caseMode == caseSmart && strings.IndexFunc(query, unicode.IsUpper) < 0
+	if ignoreCase {
+		query = strings.ToLower(query)
+	}
+	var candidates []string
+	var indices []int
+	for i, label := range labels {
+		text := label
+		if ignoreCase {
+			text = strings.ToLower(label)
+		}
+		if strings.Contains(text, query) {
+			candidates = append(candidates, label)
+			indices = append(indices, i)
+		}
+	}
+	matched := matching.FindAll(query, candidates, mode)
+	for i := range matched {
+		matched[i].Idx = indices[matched[i].Idx]
+	}
+	return matched
+}
+
+// matchingMode is the go-fuzzyfinder matching mode for --case.
+func matchingMode(caseMode string) matching.Mode {
+	switch caseMode {
+	case caseIgnore:
+		return matching.ModeCaseInsensitive
+	case caseRespect:
+		return matching.ModeCaseSensitive
+	}
+	return matching.ModeSmart
+}
+
+// key handles a key press, done is set when it closes the finder.
+func (f *builtinFinder) key(event *tcell.EventKey) (result builtinResult, done bool, err error) {
+	result = builtinResult{idx: -1, query: string(f.input)}
+	if len(f.matched) > 0 {
+		result.idx = f.matched[f.y].Idx
+	}
+	if name := keyName(event); name != "" {
+		for _, key := range f.opts.keys {
+			if key == name {
+				result.key = key
+				return result, true, nil
+			}
+		}
+	}
+
+	_, height := f.screen.Size()
+	page := height - 3
+	edited := false
+	switch event.Key() {
+	case tcell.KeyEsc, tcell.KeyCtrlC, tcell.KeyCtrlD:
+		return result, true, fuzzyfinder.ErrAbort
+	case tcell.KeyEnter:
+		return result, result.idx >= 0, nil
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if f.x > 0 {
+			f.input = append(f.input[:f.x-1], f.input[f.x:]...)
+			f.x--
+			edited = true
+		}
+	case tcell.KeyDelete:
+		if f.x < len(f.input) {
+			f.input = append(f.input[:f.x], f.input[f.x+1:]...)
+			edited = true
+		}
+	case tcell.KeyLeft, tcell.KeyCtrlB:
+		if f.x > 0 {
+			f.x--
+		}
+	case tcell.KeyRight, tcell.KeyCtrlF:
+		if f.x < len(f.input) {
+			f.x++
+		}
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		f.x = 0
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		f.x = len(f.input)
+	case tcell.KeyCtrlW:
+		before := strings.TrimRightFunc(string(f.input[:f.x]), unicode.IsSpace)
+		cut := utf8.RuneCountInString(before[:strings.LastIndex(before, " ")+1])
+		f.input = append(f.input[:cut], f.input[f.x:]...)
+		f.x = cut
+		edited = true
+	case tcell.KeyCtrlU:
+		f.input = f.input[f.x:]
+		f.x = 0
+		edited = true
+	case tcell.KeyUp, tcell.KeyCtrlK, tcell.KeyCtrlP:
+		f.move(1)
+	case tcell.KeyDown, tcell.KeyCtrlJ, tcell.KeyCtrlN:
+		f.move(-1)
+	case tcell.KeyPgUp:
+		f.move(page)
+	case tcell.KeyPgDn:
+		f.move(-page)
+	case tcell.KeyRune:
+		if event.Modifiers()&tcell.ModAlt == 0 {
+			f.input = append(f.input[:f.x], append([]rune{event.Rune()}, f.input[f.x:]...)...)
+			f.x++
+			edited = true
+		}
+	}
+	if edited {
+		f.y = 0
+		f.filter()
+	}
+	return result, false, nil
+}
+
+// move moves the cursor up the list by n lines, down when n is negative.
+func (f *builtinFinder) move(n int) {
+	f.y += n
+	if f.y >= len(f.matched) {
+		f.y = len(f.matched) - 1
+	}
+	if f.y < 0 {
+		f.y = 0
+	}
+}
+
+// keyName names event like fzf's --expect does, "" for keys without an
+// action name.
+func keyName(event *tcell.EventKey) string {
+	switch {
+	case event.Key() == tcell.KeyRune && event.Modifiers()&tcell.ModAlt != 0:
+		return "alt-" + string(event.Rune())
+	case event.Key() >= tcell.KeyCtrlA && event.Key() <= tcell.KeyCtrlZ:
+		return "ctrl-" + string(rune('a'+event.Key()-tcell.KeyCtrlA))
+	}
+	return ""
+}
+
+// draw renders the list growing up from the prompt on the last line, the
+// count and header lines in between, and the preview in a box on the right
+// half of the terminal.
+func (f *builtinFinder) draw() {
+	screen := f.screen
+	width, height := screen.Size()
+	screen.Clear()
+	listWidth := width
+	if f.opts.preview != nil {
+		listWidth = width/2 - 1
+	}
+
+	row := height - 1
+	prompt := tcell.StyleDefault.Foreground(tcell.ColorBlue)
+	screen.SetContent(0, row, '>', nil, prompt)
+	drawText(screen, 2, row, listWidth, string(f.input), tcell.StyleDefault.Bold(true))
+	screen.ShowCursor(2+runewidth.StringWidth(string(f.input[:f.x])), row)
+
+	if f.opts.header != "" {
+		lines := strings.Split(f.opts.header, "\n")
+		for i := len(lines) - 1; i >= 0 && row > 0; i-- {
+			row--
+			drawText(screen, 2, row, listWidth, lines[i], tcell.StyleDefault.Foreground(tcell.ColorGreen))
+		}
+	}
+	row--
+	count := strconv.Itoa(len(f.matched)) + "/" + strconv.Itoa(len(f.labels))
+	drawText(screen, 2, row, listWidth, count, tcell.StyleDefault.Foreground(tcell.ColorYellow))
+
+	// Keep the cursor within the rows of the list
+	rows := row
+	if f.y < f.offset {
+		f.offset = f.y
+	}
+	if rows > 0 && f.y >= f.offset+rows {
+		f.offset = f.y - rows + 1
+	}
+	for i := 0; i < rows && f.offset+i < len(f.matched); i++ {
+		f.drawItem(row-1-i, listWidth, f.matched[f.offset+i], f.offset+i == f.y)
+	}
+
+	if f.opts.preview != nil {
+		idx := -1
+		if len(f.matched) > 0 {
+			idx = f.matched[f.y].Idx
+		}
+		drawPreview(screen, width/2, width, height, f.opts.preview(idx, width, height))
+	}
+	screen.Show()
+}
+
+// drawItem draws the label of m on row, the query's runes within the
+// matched range highlighted as go-fuzzyfinder does.
+func (f *builtinFinder) drawItem(row, width int, m matching.Matched, current bool) {
+	base := tcell.StyleDefault
+	highlight := tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	if current {
+		marker := tcell.StyleDefault.Foreground(tcell.ColorRed).Background(tcell.ColorBlack)
+		f.screen.SetContent(0, row, '>', nil, marker)
+		f.screen.SetContent(1, row, ' ', nil, marker)
+		base = tcell.StyleDefault.Foreground(tcell.ColorYellow).Background(tcell.ColorBlack).Bold(true)
+		highlight = tcell.StyleDefault.Foreground(tcell.ColorDarkCyan).Background(tcell.ColorBlack).Bold(true)
+	}
+
+	next := 0
+	x := 2
+	for j, r := range []rune(f.labels[m.Idx]) {
+		style := base
+		if next < len(f.input) && m.Pos[0] >= 0 && m.Pos[0] <= j && j <= m.Pos[1] &&
+			unicode.ToLower(f.input[next]) == unicode.ToLower(r) {
+			style = highlight
+			next++
+		}
+		w := runewidth.RuneWidth(r)
+		if x+w+2 > width {
+			f.screen.SetContent(x, row, '.', nil, style)
+			f.screen.SetContent(x+1, row, '.', nil, style)
+			return
+		}
+		f.screen.SetContent(x, row, r, nil, style)
+		x += w
+	}
+}
+
+// drawPreview draws text in a box spanning the columns from left to right
+// and the whole height, cutting lines at its edge.
+func drawPreview(screen tcell.Screen, left, right, height int, text string) {
+	border := tcell.StyleDefault.Foreground(tcell.ColorBlack)
+	for x := left; x < right; x++ {
+		screen.SetContent(x, 0, '─', nil, border)
+		screen.SetContent(x, height-1, '─', nil, border)
+	}
+	for y := 1; y < height-1; y++ {
+		screen.SetContent(left, y, '│', nil, border)
+		screen.SetContent(right-1, y, '│', nil, border)
+	}
+	screen.SetContent(left, 0, '┌', nil, border)
+	screen.SetContent(right-1, 0, '┐', nil, border)
+	screen.SetContent(left, height-1, '└', nil, border)
+	screen.SetContent(right-1, height-1, '┘', nil, border)
+
+	for i, line := range strings.Split(text, "\n") {
+		if i+1 >= height-1 {
+			break
+		}
+		drawText(screen, left+2, i+1, right-2, line, tcell.StyleDefault)
+	}
+}
+
+// drawText draws text on row from column x, ending it with ".." when it
+// would reach column limit.
+func drawText(screen tcell.Screen, x, row, limit int, text string, style tcell.Style) {
+	if runewidth.StringWidth(text) > limit-x {
+		text = runewidth.Truncate(text, limit-x, "..")
+	}
+	for _, r := range text {
+		screen.SetContent(x, row, r, nil, style)
+		x += runewidth.RuneWidth(r)
+	}
+}
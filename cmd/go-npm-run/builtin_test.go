@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// keyScreen is a simulation screen typing keys once the finder opened it.
+type keyScreen struct {
+	tcell.SimulationScreen
+	keys []*tcell.EventKey
+}
+
+func (s *keyScreen) Init() error {
+	if err := s.SimulationScreen.Init(); err != nil {
+		return err
+	}
+	s.SetSize(80, 24)
+	for _, key := range s.keys {
+		s.InjectKey(key.Key(), key.Rune(), key.Modifiers())
+	}
+	return nil
+}
+
+func typed(text string) []*tcell.EventKey {
+	var keys []*tcell.EventKey
+	for _, r := range text {
+		keys = append(keys, tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+	return keys
+}
+
+// TestPickBuiltin checks how the built-in finder closes: enter picks the
+// highlighted item, action keys report themselves with the query and Esc
+// aborts.
+func TestPickBuiltin(t *testing.T) {
+	items := []pickerItem{{label: "web > (build)"}, {label: "web > (test)"}, {label: "api > (test)"}}
+	enter := tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)
+	tests := []struct {
+		name    string
+		keys    []*tcell.EventKey
+		options builtinOptions
+		want    builtinResult
+		wantErr error
+	}{
+		{
+			name:    "enter picks the first item",
+			options: builtinOptions{cursor: -1},
+			keys:    []*tcell.EventKey{enter},
+			want:    builtinResult{idx: 0},
+		},
+		{
+			name:    "the cursor starts on the given item",
+			keys:    []*tcell.EventKey{enter},
+			options: builtinOptions{cursor: 2},
+			want:    builtinResult{idx: 2},
+		},
+		{
+			name:    "up moves the cursor",
+			options: builtinOptions{cursor: -1},
+			keys:    append(typed("test"), tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone), enter),
+			want:    builtinResult{idx: 1, query: "test"},
+		},
+		{
+			name:    "action key",
+			keys:    append(typed("api"), tcell.NewEventKey(tcell.KeyCtrlO, 0, tcell.ModCtrl)),
+			options: builtinOptions{cursor: -1, keys: []string{"ctrl-o"}},
+			want:    builtinResult{idx: 2, key: "ctrl-o", query: "api"},
+		},
+		{
+			name:    "alt action key without a match",
+			keys:    append(typed("zzz"), tcell.NewEventKey(tcell.KeyRune, 'e', tcell.ModAlt)),
+			options: builtinOptions{cursor: -1, keys: []string{"alt-e"}},
+			want:    builtinResult{idx: -1, key: "alt-e", query: "zzz"},
+		},
+		{
+			name:    "unbound keys edit the query",
+			options: builtinOptions{cursor: -1},
+			keys:    append(typed("api"), tcell.NewEventKey(tcell.KeyCtrlO, 0, tcell.ModCtrl), enter),
+			want:    builtinResult{idx: 2, query: "api"},
+		},
+		{
+			name:    "esc aborts",
+			options: builtinOptions{cursor: -1},
+			keys:    []*tcell.EventKey{tcell.NewEventKey(tcell.KeyEsc, 0, tcell.ModNone)},
+			want:    builtinResult{idx: 0},
+			wantErr: fuzzyfinder.ErrAbort,
+		},
+	}
+
+	defer func(restore func() (tcell.Screen, error)) { newBuiltinScreen = restore }(newBuiltinScreen)
+	for _, tt := range tests {
+		screen := &keyScreen{SimulationScreen: tcell.NewSimulationScreen("UTF-8"), keys: tt.keys}
+		newBuiltinScreen = func() (tcell.Screen, error) { return screen, nil }
+		options := tt.options
+		options.caseMode = caseSmart
+		options.preview = func(i, width, height int) string { return "" }
+		got, err := pickBuiltin(&items, options)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestMatchItems checks fuzzy and exact matching under every --case.
+func TestMatchItems(t *testing.T) {
+	t.Parallel()
+	labels := []string{"web > (build)", "web > (lint)", "Api > (test)"}
+	tests := []struct {
+		query    string
+		caseMode string
+		exact    bool
+		want     []int
+	}{
+		{"", caseSmart, false, []int{0, 1, 2}},
+		{"wt", caseSmart, false, []int{1}},
+		{"wt", caseSmart, true, nil},
+		{"(b", caseSmart, true, []int{0}},
+		{"web", caseSmart, true, []int{1, 0}},
+		{"api", caseSmart, true, []int{2}},
+		{"API", caseSmart, true, nil},
+		{"API", caseIgnore, true, []int{2}},
+		{"api", caseRespect, true, nil},
+		{"Api", caseRespect, true, []int{2}},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, m := range matchItems(labels, tt.query, tt.caseMode, tt.exact) {
+			got = append(got, m.Idx)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("matchItems(%q, %s, exact %v) = %v, want %v", tt.query, tt.caseMode, tt.exact, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("matchItems(%q, %s, exact %v) = %v, want %v", tt.query, tt.caseMode, tt.exact, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// TestPickWithBuiltinFollowsItem checks that the built-in finder opens
+// again after an action with the cursor on the item it was on, also when
+// the action reordered the items.
+func TestPickWithBuiltinFollowsItem(t *testing.T) {
+	items := []pickerItem{{label: "a > (build)"}, {label: "b > (build)"}, {label: "c > (build)"}}
+	reverse := pickerAction{
+		key:     "ctrl-o",
+		anyItem: true,
+		run: func(int) string {
+			for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+				items[i], items[j] = items[j], items[i]
+			}
+			return "Reversed"
+		},
+	}
+	rounds := [][]*tcell.EventKey{
+		{tcell.NewEventKey(tcell.KeyCtrlO, 0, tcell.ModCtrl)},
+		{tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)},
+	}
+
+	defer func(restore func() (tcell.Screen, error)) { newBuiltinScreen = restore }(newBuiltinScreen)
+	newBuiltinScreen = func() (tcell.Screen, error) {
+		if len(rounds) == 0 {
+			t.Fatal("the finder opened too often")
+		}
+		screen := &keyScreen{SimulationScreen: tcell.NewSimulationScreen("UTF-8"), keys: rounds[0]}
+		rounds = rounds[1:]
+		return screen, nil
+	}
+	idx, err := pickWithBuiltin(&options{caseMode: caseSmart, noPreview: true}, items, "", []pickerAction{reverse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx != 2 || items[idx].label != "a > (build)" {
+		t.Errorf("picked %d, want 2, where the highlighted first item went", idx)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes accepted by --output.
+const (
+	outputStream     = "stream"
+	outputErrorsOnly = "errors-only"
+	outputGroup      = "group"
+)
+
+var outputModes = []string{outputStream, outputErrorsOnly, outputGroup}
+
+// groupMemoryLimit is how much output of a grouped run is held in memory,
+// more is spilled to a temporary file.
+const groupMemoryLimit = 1 << 20
+
+// defaultTailLines is how many lines of a failed errors-only run are
+// replayed unless --tail-lines says otherwise.
+const defaultTailLines = 100
+
+// runCaptured runs inv like runAttempts, but writes the script's combined
+// output to a log file instead of stdout and stderr. A spinner shows on a
+// terminal meanwhile. When the run fails the last inv.tailLines lines of
+// the log are replayed to stderr followed by its path, otherwise the log
+// is removed.
+func runCaptured(ctx context.Context, inv invocation, stdin io.Reader, stderr io.Writer) (code, attempts int, err error) {
+	log, err := os.CreateTemp("", "go-npm-run-*.log")
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot capture output: %w", err)
+	}
+	defer log.Close()
+
+	stop := func() {}
+	if stderr == os.Stderr {
+		stop = startSpinner("running " + inv.Script.Label())
+	}
+	code, attempts, err = runAttempts(ctx, inv, stdin, log, log)
+	stop()
+
+	if code == 0 && err == nil {
+		log.Close()
+		os.Remove(log.Name())
+		return code, attempts, err
+	}
+	lines, total := tailLines(log.Name(), inv.tailLines)
+	if skipped := total - len(lines); skipped > 0 {
+		fmt.Fprintf(stderr, "... %d earlier lines skipped\n", skipped)
+	}
+	for _, line := range lines {
+		fmt.Fprintln(stderr, line)
+	}
+	infof("full output: %s", log.Name())
+	return code, attempts, err
+}
+
+// groupBuffer holds the output of a --output group run until it finished,
+// in memory up to limit bytes and in a temporary file after that. stdout
+// and stderr of the script are written from separate goroutines.
+type groupBuffer struct {
+	mu    sync.Mutex
+	limit int
+	mem   bytes.Buffer
+	file  *os.File
+	err   error
+}
+
+func (g *groupBuffer) Write(data []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.file == nil && g.err == nil && g.mem.Len()+len(data) > g.limit {
+		if g.file, g.err = os.CreateTemp("", "go-npm-run-group-*.log"); g.err == nil {
+			_, g.err = g.mem.WriteTo(g.file)
+		}
+	}
+	if g.file != nil && g.err == nil {
+		_, g.err = g.file.Write(data)
+		return len(data), nil
+	}
+	// Without a file the output is kept in memory after all
+	return g.mem.Write(data)
+}
+
+// writeTo copies the held output to w and reports whether it ended with a
+// newline.
+func (g *groupBuffer) writeTo(w io.Writer) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	lew := &lineEndWriter{w: w, ended: true}
+	if g.file != nil {
+		if _, err := g.file.Seek(0, io.SeekStart); err == nil {
+			io.Copy(lew, g.file)
+		}
+	}
+	g.mem.WriteTo(lew)
+	if g.err != nil {
+		fmt.Fprintf(lew, "go-npm-run: output lost: %v\n", g.err)
+	}
+	return lew.ended
+}
+
+// close removes the temporary file, if any.
+func (g *groupBuffer) close() {
+	if g.file != nil {
+		g.file.Close()
+		os.Remove(g.file.Name())
+	}
+}
+
+// writeGroup writes the output of a finished run as one block: a header,
+// the output and the resultLine of r. With gha the block is a GitHub
+// Actions log group.
+func writeGroup(w io.Writer, r allResult, output *groupBuffer, gha bool) {
+	title := fmt.Sprintf("%s (%s)", r.inv.Script.Label(), r.inv.Script.AbsolutePath)
+	if gha {
+		ghaGroup(w, title)
+	} else {
+		fmt.Fprintf(w, "==> %s\n", title)
+	}
+	if !output.writeTo(w) {
+		fmt.Fprintln(w)
+	}
+	if gha {
+		fmt.Fprintln(w, "::endgroup::")
+	}
+	fmt.Fprintf(w, "<== %s\n", resultLine(r))
+}
+
+// tailLines returns the last n lines of the file at path and how many
+// lines it has in total.
+func tailLines(path string, n int) (lines []string, total int) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		total++
+		if n <= 0 {
+			continue
+		}
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	return lines, total
+}
+
+// spinnerFrames are drawn one after another by startSpinner.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// startSpinner animates message on stderr until the returned function is
+// called, which clears the line again. Nothing is drawn unless stderr is a
+// terminal and --quiet is off.
+func startSpinner(message string) (stop func()) {
+	return startProgress(func() string { return message })
+}
+
+// startProgress is startSpinner with a message that is asked for again on
+// every frame. The first frame is drawn after a tick, so that quick work
+// does not flash a line.
+func startProgress(message func() string) (stop func()) {
+	if quiet || !isTerminal(os.Stderr) || os.Getenv("TERM") == "dumb" {
+		return func() {}
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			select {
+			case <-done:
+				if frame > 0 {
+					fmt.Fprint(os.Stderr, "\r\x1b[K")
+				}
+				return
+			case <-ticker.C:
+			}
+			fmt.Fprintf(os.Stderr, "\r%s %s\x1b[K", paint(colorCyan, spinnerFrames[frame%len(spinnerFrames)]), message())
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,858 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+const usageHeader = `Usage: go-npm-run [flags] [path|script...] [-- args...]
+
+Fuzzy pick and run a script from the package.json files found under path
+(default: the current directory). When the argument is not a directory it
+is treated as a script name and run without opening the picker. Several
+script names run one after another, stopping at the first failure.
+Arguments after "--" are forwarded to the script.
+
+Commands:
+  completion bash|zsh|fish     print a shell completion script
+  export aliases [path]        print a shell function for every script
+  export markdown [path]       print a Markdown table of the scripts per package
+  doctor [path]                diagnose why packages or package managers are not discovered as expected
+
+Flags:
+`
+
+// defaultTimeoutGrace is how long a script stopped by --timeout gets to
+// exit before it is killed.
+const defaultTimeoutGrace = 10 * time.Second
+
+// options holds everything parsed from the command line.
+type options struct {
+	searchPath string
+	scriptName string
+	// scriptNames are all names when several are given, run one after
+	// another. scriptName is the first of them.
+	scriptNames []string
+	scriptArgs  []string
+	// withDeps is the script --with-deps runs in the dependencies first.
+	withDeps string
+	// ifPresent turns a script name nothing defines into a note.
+	ifPresent bool
+	// ignorePlatform runs packages whose os and cpu fields exclude this
+	// system like any other.
+	ignorePlatform bool
+
+	showVersion     bool
+	verbose         bool
+	stats           bool
+	quiet           bool
+	dryRun          bool
+	packageManager  string
+	noNodeRun       bool
+	noCorepack      bool
+	strictEngines   bool
+	print           printMode
+	watch           bool
+	exec            bool
+	raw             bool
+	watchGlobs      listValue
+	list            bool
+	json            bool
+	finder          string
+	noPreview       bool
+	byPackage       bool
+	ignore          listValue
+	exclude         listValue
+	excludePackages listValue
+	workspacesOnly  bool
+	noLocalDeps     bool
+	only            listValue
+	scopes          listValue
+	since           string
+	dependents      bool
+	shortNames      bool
+	search          string
+	showHidden      bool
+	plain           bool
+	exact           bool
+	caseMode        string
+	noVersions      bool
+	sort            string
+	noHistory       bool
+	last            bool
+	all             bool
+	order           string
+	parallel        bool
+	jobs            int
+	parseJobs       int
+	failFast        bool
+	keepGoing       bool
+	timeout         time.Duration
+	timeoutGrace    time.Duration
+	retry           int
+	restart         restartMode
+	noPty           bool
+	refresh         bool
+	install         bool
+	noInstall       bool
+	retryDelay      time.Duration
+	promptEnv       bool
+	envVars         listValue
+	envFiles        listValue
+	envFileOverride bool
+	dotenv          bool
+	cleanEnv        bool
+	envAllow        listValue
+	configPath      string
+	noProjectConfig bool
+	runAt           string
+	output          string
+	notify          bool
+	log             logTarget
+	logStripANSI    bool
+	timestamps      timestampMode
+	yes             bool
+	// dangerous are the script globs confirmDangerous asks about.
+	dangerous []string
+	// aliases are the configured shortcuts, alias is the one named by the
+	// positional argument.
+	aliases     map[string]alias
+	alias       *alias
+	listAliases bool
+	serve       bool
+	http        string
+	httpToken   string
+	httpPublic  bool
+	format      string
+	columns     listValue
+	header      bool
+	runID       string
+	// export is the kind of `go-npm-run export` and exportOutput the file
+	// it writes, prefix and shell shape the functions of export aliases.
+	export       string
+	exportOutput string
+	prefix       string
+	shell        string
+	notifyAfter  time.Duration
+	tmux         string
+	tmuxRemain   string
+	eval         bool
+	where        bool
+	doctor       bool
+	whereCd      bool
+	gha          bool
+	tailLines    int
+	dir          string
+
+	// values holds placeholder answers replayed by --last.
+	values map[string]string
+
+	// sources records where each effective flag value came from, keyed by
+	// long flag name. Values left at their built-in default are absent.
+	sources map[string]string
+}
+
+// setSource records that the option behind flag name was set by source.
+// Repeatable options accumulate values from every layer.
+func (o *options) setSource(name, source string) {
+	if o.sources == nil {
+		o.sources = map[string]string{}
+	}
+	if prev, ok := o.sources[name]; ok && contains(listFlags, name) && prev != source {
+		source = prev + " + " + source
+	}
+	o.sources[name] = source
+}
+
+// listFlags are the repeatable flags that can also be set from the config
+// file and the environment.
+var listFlags = []string{"ignore", "exclude", "exclude-package", "env-allow"}
+
+// listValue is a repeatable string flag.
+type listValue []string
+
+func (l *listValue) String() string { return strings.Join(*l, ",") }
+
+func (l *listValue) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// printMode is the value of --print. It behaves like a boolean flag so that
+// a bare --print works, while --print=raw selects the raw script body.
+type printMode string
+
+const (
+	printNone    printMode = ""
+	printCommand printMode = "command"
+	printRaw     printMode = "raw"
+)
+
+func (m *printMode) String() string { return string(*m) }
+
+func (m *printMode) IsBoolFlag() bool { return true }
+
+func (m *printMode) Set(value string) error {
+	switch value {
+	case "true", "command":
+		*m = printCommand
+	case "raw":
+		*m = printRaw
+	case "false":
+		*m = printNone
+	default:
+		return fmt.Errorf("expected --print or --print=raw")
+	}
+	return nil
+}
+
+// shortFlags maps a long flag name to its single letter alias. Aliases are
+// registered on the same variable and printed next to the long name in --help.
+var shortFlags = map[string]string{}
+
+// newFlagSet registers every flag on a fresh FlagSet bound to opts.
+func newFlagSet(opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("go-npm-run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	boolFlag(fs, &opts.showVersion, "version", "V", "print version information and exit")
+	boolFlag(fs, &opts.verbose, "verbose", "v", "log discovery and package manager decisions to stderr")
+	boolFlag(fs, &opts.stats, "stats", "", "report stage timings and what the scan found to stderr, after the picker or the --list, --json or tsv output")
+	boolFlag(fs, &opts.quiet, "quiet", "s", "suppress go-npm-run's own messages, only the script output is shown")
+	stringFlag(fs, &opts.configPath, "config", "", "read configuration from `path` instead of the user config file")
+	boolFlag(fs, &opts.noProjectConfig, "no-project-config", "", "do not read the .go-npm-run.yaml or package.json \"go-npm-run\" config of the project")
+	boolFlag(fs, &opts.list, "list", "l", "print all scripts, one per line, instead of opening the picker")
+	boolFlag(fs, &opts.listAliases, "list-aliases", "", "print the aliases from the config file and exit")
+	boolFlag(fs, &opts.serve, "serve", "", "scan once, then answer JSON requests on stdin for editor integrations (see below)")
+	stringFlag(fs, &opts.http, "http", "", "serve an HTTP API for listing and running scripts on `addr`, e.g. 127.0.0.1:7777 (see below)")
+	stringFlag(fs, &opts.httpToken, "http-token", "", "require `token` from --http clients instead of a random one")
+	boolFlag(fs, &opts.httpPublic, "http-public", "", "let --http listen on addresses other than loopback")
+	stringFlag(fs, &opts.format, "format", "", "print all scripts as `format`: list (like --list), json (like --json) or tsv")
+	fs.Var(&opts.columns, "columns", "with --format tsv, print the comma separated `columns` out of id, package, name, version, script, command, path, dir and pm")
+	boolFlag(fs, &opts.header, "header", "", "start --format tsv output with the column names")
+	stringFlag(fs, &opts.prefix, "prefix", "", "with export aliases, start every function name with `prefix`")
+	stringFlag(fs, &opts.shell, "shell", "", "with export aliases, write functions for `shell`: bash, zsh (default) or fish")
+	boolFlag(fs, &opts.json, "json", "", "print all scripts as JSON instead of opening the picker")
+	boolFlag(fs, &opts.dryRun, "dry-run", "", "print the command that would run instead of running it")
+	boolFlag(fs, &opts.raw, "raw", "", "run the script body through sh with node_modules/.bin on PATH, skipping the package manager")
+	boolFlag(fs, &opts.exec, "exec", "", "replace go-npm-run with the package manager instead of running it as a child (not on windows)")
+	stringFlag(fs, &opts.runAt, "run-at", "", "run scripts in `place`: package (their package directory), root (the workspace or repository root) or cwd")
+	stringFlag(fs, &opts.dir, "dir", "", "run scripts in `path` instead of their package directory")
+	boolFlag(fs, &opts.watch, "watch", "w", "re-run the script whenever a file in its package changes")
+	fs.Var(&opts.restart, "restart", "relaunch the script whenever it exits, with backoff (--restart=on-failure only after failures)")
+	fs.Var(&opts.watchGlobs, "watch-glob", "only restart --watch when a changed path matches `glob` (repeatable)")
+	boolFlag(fs, &opts.where, "where", "", "print the package, package.json and command of every script with the given name, without running any")
+	boolFlag(fs, &opts.whereCd, "cd", "", "with --where, print only the directory of the one package defining the script")
+	boolFlag(fs, &opts.eval, "eval", "", "print the command as one cd-and-run line for a shell wrapper to eval, instead of running it")
+	fs.Var(&opts.print, "print", "print the selected command instead of running it (--print=raw prints the script body)")
+	stringFlag(fs, &opts.finder, "finder", "", "pick scripts with `finder`: builtin or fzf (falls back to builtin when fzf is unavailable)")
+	boolFlag(fs, &opts.byPackage, "by-package", "", "pick a package first, then one of its scripts")
+	boolFlag(fs, &opts.plain, "plain", "", "pick from a numbered menu read from stdin instead of a full-screen finder (default when TERM=dumb)")
+	boolFlag(fs, &opts.noPreview, "no-preview", "", "hide the preview pane in the picker")
+	stringFlag(fs, &opts.search, "search", "", "match the picker query against `fields`: name (package and script names) or command (their commands too)")
+	boolFlag(fs, &opts.exact, "exact", "", "match the picker query as a substring instead of fuzzily")
+	stringFlag(fs, &opts.caseMode, "case", "", "match the picker query with `case`: smart (ignore case unless the query has an uppercase letter), ignore or respect")
+	boolFlag(fs, &opts.noVersions, "no-versions", "", "leave the package versions out of the picker labels and --list")
+	stringFlag(fs, &opts.sort, "sort", "", "order scripts by `order`: package, name, recent or none")
+	boolFlag(fs, &opts.noHistory, "no-history", "", "do not record runs in the history file")
+	boolFlag(fs, &opts.all, "all", "", "run the named script in every package that defines it, one after another")
+	boolFlag(fs, &opts.parallel, "parallel", "", "run the --all packages concurrently, output lines are prefixed with the package name")
+	intFlag(fs, &opts.jobs, "jobs", "j", "run at most `n` scripts at the same time with --parallel (default: number of CPUs)")
+	intFlag(fs, &opts.parseJobs, "parse-jobs", "", "read at most `n` package.json files at the same time while scanning")
+	boolFlag(fs, &opts.gha, "gha", "", "group the output of --all runs and annotate failures for GitHub Actions (default on when GITHUB_ACTIONS=true)")
+	boolFlag(fs, &opts.failFast, "fail-fast", "", "stop --all at the first failure, interrupting running scripts (default without --parallel)")
+	boolFlag(fs, &opts.keepGoing, "keep-going", "k", "run every --all package even after failures (default with --parallel)")
+	boolFlag(fs, &opts.ifPresent, "if-present", "", "exit with 0 when no package defines the named script, like npm run --if-present")
+	stringFlag(fs, &opts.withDeps, "with-deps", "", "run `script` in every workspace package the selected one depends on first, dependencies first")
+	stringFlag(fs, &opts.order, "order", "", "run --all packages in `order`: flat (discovery order) or topo (dependencies first)")
+	fs.DurationVar(&opts.timeout, "timeout", opts.timeout, "stop the script when it runs longer than `duration`, e.g. 10m, and exit with 124")
+	fs.DurationVar(&opts.timeoutGrace, "timeout-grace", opts.timeoutGrace, "after --timeout, wait `duration` for the script to exit before killing it")
+	intFlag(fs, &opts.retry, "retry", "", "run a failing script up to `n` more times")
+	fs.DurationVar(&opts.retryDelay, "retry-delay", opts.retryDelay, "wait `duration` between --retry attempts")
+	stringFlag(fs, &opts.runID, "run-id", "", "run the script with `id`, as printed by --list, --json and --format tsv, without the picker")
+	boolFlag(fs, &opts.last, "last", "", "run the most recently run script again, with the same arguments and placeholder values")
+	boolFlag(fs, &opts.promptEnv, "prompt-env", "", "also prompt for $VAR references in the script that are not set in the environment")
+	fs.Var(&opts.envVars, "env", "set `KEY=VALUE` in the script's environment, a bare KEY passes it on from go-npm-run's (repeatable)")
+	fs.Var(&opts.envFiles, "env-file", "load KEY=VALUE lines from `path` into the script's environment (repeatable, later files win)")
+	boolFlag(fs, &opts.envFileOverride, "env-file-override", "", "let --env-file values override variables already set in the environment")
+	boolFlag(fs, &opts.cleanEnv, "clean-env", "", "start the script with only PATH, HOME, TERM, the --env-allow variables and the --env and --env-file ones instead of go-npm-run's whole environment")
+	fs.Var(&opts.envAllow, "env-allow", "with --clean-env, also pass on the variables whose name matches `glob`, case-insensitive (repeatable)")
+	boolFlag(fs, &opts.refresh, "refresh", "", "parse every package.json again instead of using the script cache")
+	fs.Var(&opts.ignore, "ignore", "skip directories named `dir` while scanning (repeatable)")
+	fs.Var(&opts.only, "only", "keep only scripts whose name or package:name matches `glob`, case-insensitive (repeatable)")
+	fs.Var(&opts.excludePackages, "exclude-package", "hide the packages whose name or directory relative to the root matches `glob`, case-insensitive (repeatable)")
+	boolFlag(fs, &opts.noLocalDeps, "no-local-deps", "", "do not list the packages that file: and link: dependencies point to")
+	boolFlag(fs, &opts.workspacesOnly, "workspaces-only", "", "keep only the root package and the packages of declared workspaces, not ones the directory walk found on its own")
+	fs.Var(&opts.scopes, "scope", "keep only packages of the npm `scope`, like @acme (repeatable)")
+	stringFlag(fs, &opts.since, "since", "", "keep only packages with files changed since the git `ref`, committed, uncommitted or untracked")
+	boolFlag(fs, &opts.dependents, "include-dependents", "", "with --since, also keep the packages depending on the changed ones")
+	boolFlag(fs, &opts.shortNames, "short-names", "", "leave the scope out of the package names in the picker, it still matches at the end of each line")
+	boolFlag(fs, &opts.showHidden, "show-hidden", "", "also list the scripts hidden by the \"go-npm-run\": {\"hide\": [...]} globs of their package.json")
+	fs.Var(&opts.exclude, "exclude", "hide scripts whose name or package:name matches `glob`, case-insensitive (repeatable)")
+	boolFlag(fs, &opts.ignorePlatform, "ignore-platform", "", "run packages whose package.json os or cpu fields exclude this system without asking, and with --all")
+	boolFlag(fs, &opts.yes, "yes", "y", "run scripts matching the dangerous patterns without asking to confirm")
+	boolFlag(fs, &opts.install, "install", "", "install missing dependencies before running without asking")
+	boolFlag(fs, &opts.noInstall, "no-install", "", "do not check whether dependencies are installed")
+	stringFlag(fs, &opts.output, "output", "", "show the script output as `mode`: stream, errors-only to hide it unless the script fails, or group to write each --parallel run as one block when it finishes (with export, the file to write)")
+	intFlag(fs, &opts.tailLines, "tail-lines", "", "replay the last `n` lines of a failed --output=errors-only run")
+	fs.Var(&opts.log, "log", "copy the script output to a new file in the project's logs directory (--log=path appends to path)")
+	boolFlag(fs, &opts.logStripANSI, "log-strip-ansi", "", "remove ANSI colors and escape sequences from the --log file")
+	fs.Var(&opts.timestamps, "timestamps", "prefix every output line with the time since the script started (--timestamps=abs for the time of day)")
+	boolFlag(fs, &opts.notify, "notify", "", "show a desktop notification when the script finishes, and on every failure with --watch")
+	fs.DurationVar(&opts.notifyAfter, "notify-after", opts.notifyAfter, "only --notify about runs that took at least `duration`")
+	stringFlag(fs, &opts.tmux, "tmux", "", "inside tmux, run the script in a new `pane` or window instead of here")
+	stringFlag(fs, &opts.tmuxRemain, "tmux-remain-on-exit", "", "keep the --tmux pane open after the script exits: `mode` on, off or failed")
+	boolFlag(fs, &opts.noPty, "no-pty", "", "never run scripts in a pseudo terminal, even when their output is prefixed")
+	boolFlag(fs, &opts.strictEngines, "strict-engines", "", "refuse to run when node does not satisfy .nvmrc, .node-version or engines.node")
+	boolFlag(fs, &opts.noCorepack, "no-corepack", "", "run the package manager from PATH even when packageManager pins a version")
+	boolFlag(fs, &opts.noNodeRun, "no-node-run", "", "always run npm projects with npm run instead of node --run")
+	stringFlag(fs, &opts.packageManager, "pm", "", "run scripts with `runner` (npm, yarn, pnpm, bun or node) instead of inferring it")
+
+	return fs
+}
+
+func boolFlag(fs *flag.FlagSet, p *bool, name, short, usage string) {
+	fs.BoolVar(p, name, *p, usage)
+	if short != "" {
+		fs.BoolVar(p, short, *p, usage)
+		shortFlags[name] = short
+	}
+}
+
+func stringFlag(fs *flag.FlagSet, p *string, name, short, usage string) {
+	fs.StringVar(p, name, *p, usage)
+	if short != "" {
+		fs.StringVar(p, short, *p, usage)
+		shortFlags[name] = short
+	}
+}
+
+func intFlag(fs *flag.FlagSet, p *int, name, short, usage string) {
+	fs.IntVar(p, name, *p, usage)
+	if short != "" {
+		fs.IntVar(p, short, *p, usage)
+		shortFlags[name] = short
+	}
+}
+
+// printUsage writes the --help text, listing every long flag with its alias.
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	aliases := map[string]bool{}
+	for _, short := range shortFlags {
+		aliases[short] = true
+	}
+
+	// The names column is as wide as the longest flag with its value
+	rows := [][2]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if aliases[f.Name] {
+			return
+		}
+		name := "    --" + f.Name
+		if short, ok := shortFlags[f.Name]; ok {
+			name = "-" + short + ", --" + f.Name
+		}
+		valueName, usage := flag.UnquoteUsage(f)
+		if valueName != "" {
+			name += " " + valueName
+		}
+		rows = append(rows, [2]string{name, usage})
+	})
+	rows = append(rows, [2]string{"-h, --help", "show this help and exit"})
+	width := 0
+	for _, row := range rows {
+		if len(row[0]) > width {
+			width = len(row[0])
+		}
+	}
+
+	fmt.Fprint(w, usageHeader)
+	for _, row := range rows {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, row[0], row[1])
+	}
+	writeKeysUsage(w)
+	fmt.Fprint(w, serveUsage)
+	fmt.Fprint(w, httpUsage)
+}
+
+// parseArgs parses the command line. Flags may appear before or after the
+// positional argument; everything after a bare "--" is forwarded verbatim.
+//
+// Option values are resolved here and only here, in increasing precedence:
+// built-in defaults, the saved picker state, the config file, GO_NPM_RUN_*
+// environment variables and finally the command line flags.
+func parseArgs(args []string) (*options, error) {
+	opts := &options{searchPath: ".", finder: finderBuiltin, search: searchName, caseMode: caseSmart, sort: sortPackage, runAt: runAtPackage, output: outputStream, tailLines: defaultTailLines, order: orderFlat, jobs: runtime.NumCPU(), parseJobs: discover.DefaultParseJobs, timeoutGrace: defaultTimeoutGrace, dangerous: defaultDangerous, tmuxRemain: "on", gha: githubActions()}
+
+	// What the picker keys changed last time replaces the built-in defaults
+	if state, path := loadPickerState(); path != "" {
+		state.apply(opts, path)
+	}
+
+	// The config file provides the defaults the flags are parsed on top of,
+	// so it has to be located before the real parse.
+	configPath, required := configFlagValue(args)
+	if !required {
+		if path, ok := os.LookupEnv("GO_NPM_RUN_CONFIG"); ok && path != "" {
+			configPath, required = path, true
+		} else if path, err := defaultConfigPath(); err == nil {
+			configPath = path
+		}
+	}
+	if configPath != "" {
+		config, err := loadConfig(configPath, required)
+		if err != nil {
+			return nil, err
+		}
+		config.apply(opts, configPath)
+	}
+	// The project config overrides the user config, not the flags
+	if !flagPresent(args, "no-project-config") {
+		config, path, err := loadProjectConfig(searchPathArg(args))
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			config.apply(opts, path)
+		}
+	}
+
+	if err := applyEnv(opts); err != nil {
+		return nil, err
+	}
+
+	fs := newFlagSet(opts)
+
+	if len(args) > 0 && args[0] == "export" {
+		if len(args) < 2 || !contains(exportKinds, args[1]) {
+			return nil, fmt.Errorf("export needs one of: %s", strings.Join(exportKinds, ", "))
+		}
+		opts.export, args = args[1], args[2:]
+	} else if len(args) > 0 && args[0] == "doctor" {
+		opts.doctor, args = true, args[1:]
+	}
+
+	for i, arg := range args {
+		if arg == "--" {
+			opts.scriptArgs = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				printUsage(os.Stdout, fs)
+			}
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		name := f.Name
+		for long, short := range shortFlags {
+			if short == f.Name {
+				name = long
+			}
+		}
+		opts.setSource(name, "flag --"+name)
+	})
+
+	// export writes a file instead of running scripts, its --output names
+	// the file
+	if opts.export != "" {
+		if strings.HasPrefix(opts.sources["output"], "flag ") {
+			opts.exportOutput = opts.output
+		}
+		opts.output = outputStream
+	}
+
+	if opts.packageManager != "" && !contains(runner.PackageManagers, opts.packageManager) {
+		return nil, fmt.Errorf("invalid pm %q from %s, expected one of: %s", opts.packageManager, opts.sources["pm"], strings.Join(runner.PackageManagers, ", "))
+	}
+
+	if !contains(finders, opts.finder) {
+		return nil, fmt.Errorf("invalid finder %q from %s, expected one of: %s", opts.finder, opts.sources["finder"], strings.Join(finders, ", "))
+	}
+
+	if !contains(searchModes, opts.search) {
+		return nil, fmt.Errorf("invalid search %q from %s, expected one of: %s", opts.search, opts.sources["search"], strings.Join(searchModes, ", "))
+	}
+
+	if !contains(caseModes, opts.caseMode) {
+		return nil, fmt.Errorf("invalid case %q from %s, expected one of: %s", opts.caseMode, opts.sources["case"], strings.Join(caseModes, ", "))
+	}
+
+	if !contains(sortModes, opts.sort) {
+		return nil, fmt.Errorf("invalid sort %q from %s, expected one of: %s", opts.sort, opts.sources["sort"], strings.Join(sortModes, ", "))
+	}
+
+	if !contains(orders, opts.order) {
+		return nil, fmt.Errorf("invalid order %q from %s, expected one of: %s", opts.order, opts.sources["order"], strings.Join(orders, ", "))
+	}
+
+	if !contains(runAtModes, opts.runAt) {
+		return nil, fmt.Errorf("invalid run-at %q from %s, expected one of: %s", opts.runAt, opts.sources["run-at"], strings.Join(runAtModes, ", "))
+	}
+	if opts.dir != "" && opts.sources["run-at"] != "" {
+		return nil, errors.New("--dir and --run-at cannot be combined")
+	}
+
+	if !contains(outputModes, opts.output) {
+		return nil, fmt.Errorf("invalid output %q from %s, expected one of: %s", opts.output, opts.sources["output"], strings.Join(outputModes, ", "))
+	}
+	if opts.tailLines < 0 {
+		return nil, fmt.Errorf("invalid tail lines %d from %s, expected at least 0", opts.tailLines, opts.sources["tail-lines"])
+	}
+	if opts.output == outputErrorsOnly && (opts.watch || opts.exec || opts.restart != restartNever) {
+		return nil, errors.New("--output=errors-only cannot be combined with --watch, --exec or --restart")
+	}
+
+	if opts.log != "" && (opts.watch || opts.exec || opts.restart != restartNever || opts.output == outputErrorsOnly) {
+		return nil, errors.New("--log cannot be combined with --watch, --exec, --restart or --output=errors-only")
+	}
+	if opts.timestamps != timestampsOff && (opts.watch || opts.exec || opts.restart != restartNever || opts.output == outputErrorsOnly) {
+		return nil, errors.New("--timestamps cannot be combined with --watch, --exec, --restart or --output=errors-only")
+	}
+	if opts.notifyAfter < 0 {
+		return nil, errors.New("--notify-after cannot be negative")
+	}
+
+	if opts.tmux != "" && !contains(tmuxModes, opts.tmux) {
+		return nil, fmt.Errorf("invalid tmux %q from %s, expected one of: %s", opts.tmux, opts.sources["tmux"], strings.Join(tmuxModes, ", "))
+	}
+	if !contains(tmuxRemainModes, opts.tmuxRemain) {
+		return nil, fmt.Errorf("invalid tmux remain-on-exit %q from %s, expected one of: %s", opts.tmuxRemain, opts.sources["tmux-remain-on-exit"], strings.Join(tmuxRemainModes, ", "))
+	}
+	if opts.eval {
+		if opts.print != printNone || opts.dryRun || opts.list || opts.json || opts.format != "" || opts.all || opts.watch || opts.exec || opts.restart != restartNever || opts.serve || opts.http != "" || opts.export != "" || strings.HasPrefix(opts.sources["tmux"], "flag ") {
+			return nil, errors.New("--eval cannot be combined with --print, --dry-run, --list, --json, --format, --all, --watch, --exec, --restart, --tmux, --serve, --http or export")
+		}
+		opts.tmux = ""
+	}
+	// The config default gives way to the flags that need the script to
+	// run here
+	if opts.tmux != "" && (opts.all || opts.watch || opts.exec || opts.restart != restartNever || opts.output == outputErrorsOnly || opts.log != "" || opts.timestamps != timestampsOff || opts.notify) {
+		if strings.HasPrefix(opts.sources["tmux"], "flag ") {
+			return nil, errors.New("--tmux cannot be combined with --all, --watch, --exec, --restart, --output=errors-only, --log, --timestamps or --notify")
+		}
+		opts.tmux = ""
+	}
+
+	if opts.jobs < 1 {
+		return nil, fmt.Errorf("invalid jobs %d from %s, expected at least 1", opts.jobs, opts.sources["jobs"])
+	}
+	if opts.parseJobs < 1 {
+		return nil, fmt.Errorf("invalid parse jobs %d from %s, expected at least 1", opts.parseJobs, opts.sources["parse-jobs"])
+	}
+	for _, assignment := range opts.envVars {
+		if key, _, _ := strings.Cut(assignment, "="); !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid --env %q, expected KEY=VALUE or KEY", assignment)
+		}
+	}
+	for _, glob := range opts.envAllow {
+		if glob == "" {
+			return nil, fmt.Errorf("empty --env-allow pattern from %s", opts.sources["env-allow"])
+		}
+	}
+	if opts.timeout < 0 || opts.timeoutGrace < 0 {
+		return nil, errors.New("--timeout and --timeout-grace cannot be negative")
+	}
+	if opts.timeout > 0 && (opts.exec || opts.watch) {
+		return nil, errors.New("--timeout cannot be combined with --exec or --watch")
+	}
+	if opts.retry < 0 || opts.retryDelay < 0 {
+		return nil, errors.New("--retry and --retry-delay cannot be negative")
+	}
+	if opts.retry > 0 && (opts.exec || opts.watch) {
+		return nil, errors.New("--retry cannot be combined with --exec or --watch")
+	}
+	if opts.restart != restartNever && (opts.watch || opts.exec || opts.all) {
+		return nil, errors.New("--restart cannot be combined with --watch, --exec or --all")
+	}
+	if opts.install && opts.noInstall {
+		return nil, errors.New("--install and --no-install cannot be combined")
+	}
+	if opts.exec && (opts.watch || opts.all) {
+		return nil, errors.New("--exec cannot be combined with --watch or --all")
+	}
+	if opts.failFast && opts.keepGoing {
+		return nil, errors.New("--fail-fast and --keep-going cannot be combined")
+	}
+	if opts.withDeps != "" && (opts.all || opts.eval || opts.serve || opts.http != "" || opts.export != "") {
+		return nil, errors.New("--with-deps cannot be combined with --all, --eval, --serve, --http or export, --all has --order topo")
+	}
+	if opts.dependents && opts.since == "" {
+		return nil, errors.New("--include-dependents needs --since")
+	}
+	if opts.parallel && !opts.all {
+		return nil, errors.New("--parallel needs --all")
+	}
+
+	switch opts.format {
+	case "":
+	case formatList:
+		opts.list = true
+	case formatJSON:
+		opts.json = true
+	case formatTSV:
+		if len(opts.columns) == 0 {
+			opts.columns = defaultTSVColumns
+		}
+	default:
+		return nil, fmt.Errorf("invalid format %q, expected one of: %s", opts.format, strings.Join(formats, ", "))
+	}
+	var columns []string
+	for _, value := range opts.columns {
+		for _, column := range strings.Split(value, ",") {
+			column = strings.TrimSpace(column)
+			if _, ok := tsvColumns[column]; !ok {
+				return nil, fmt.Errorf("invalid column %q, expected some of: %s", column, strings.Join(sortedKeys(tsvColumns), ", "))
+			}
+			columns = append(columns, column)
+		}
+	}
+	opts.columns = columns
+	if (len(opts.columns) > 0 || opts.header) && opts.format != formatTSV {
+		return nil, errors.New("--columns and --header need --format tsv")
+	}
+
+	if opts.serve && (len(positional) > 0 && !isDir(positional[0]) || opts.list || opts.json || opts.all || opts.last || opts.watch || opts.exec) {
+		return nil, errors.New("--serve only takes a directory and cannot be combined with --list, --json, --all, --last, --watch or --exec")
+	}
+
+	if opts.export != exportAliases && (opts.prefix != "" || opts.shell != "") {
+		return nil, errors.New("--prefix and --shell need export aliases")
+	}
+	if opts.shell != "" && !contains(exportShells, opts.shell) {
+		return nil, fmt.Errorf("invalid shell %q, expected one of: %s", opts.shell, strings.Join(exportShells, ", "))
+	}
+	if opts.http != "" {
+		if len(positional) > 0 && !isDir(positional[0]) || opts.serve || opts.list || opts.json || opts.format != "" || opts.all || opts.last || opts.watch || opts.exec || opts.export != "" || opts.runID != "" {
+			return nil, errors.New("--http only takes a directory and cannot be combined with --serve, --list, --json, --format, --all, --last, --watch, --exec, --run-id or export")
+		}
+		addr, err := checkHTTPAddr(opts.http, opts.httpPublic)
+		if err != nil {
+			return nil, err
+		}
+		opts.http = addr
+	} else if strings.HasPrefix(opts.sources["http-token"], "flag ") || opts.httpPublic {
+		return nil, errors.New("--http-token and --http-public need --http")
+	}
+
+	if opts.export != "" && (len(positional) > 0 && !isDir(positional[0]) || opts.list || opts.json || opts.format != "" || opts.all || opts.last || opts.serve || opts.runID != "") {
+		return nil, errors.New("export only takes a directory and cannot be combined with --list, --json, --format, --all, --last, --serve or --run-id")
+	}
+
+	if opts.runID != "" && (len(positional) > 0 && !isDir(positional[0]) || opts.list || opts.json || opts.format != "" || opts.all || opts.last || opts.serve) {
+		return nil, errors.New("--run-id only takes a directory and cannot be combined with --list, --json, --format, --all, --last or --serve")
+	}
+
+	if opts.where && (opts.list || opts.json || opts.format != "" || opts.all || opts.last || opts.watch || opts.exec || opts.serve || opts.http != "" || opts.export != "" || opts.runID != "" || opts.eval || opts.print != printNone || opts.dryRun) {
+		return nil, errors.New("--where cannot be combined with --list, --json, --format, --all, --last, --watch, --exec, --serve, --http, --run-id, --eval, --print, --dry-run or export")
+	}
+	if opts.whereCd && !opts.where {
+		return nil, errors.New("--cd needs --where")
+	}
+
+	if opts.all {
+		if len(positional) == 0 {
+			return nil, errors.New("--all needs a script name")
+		}
+		if opts.watch {
+			return nil, errors.New("--all cannot be combined with --watch")
+		}
+		if opts.last {
+			return nil, errors.New("--all cannot be combined with --last")
+		}
+	}
+
+	switch len(positional) {
+	case 0:
+	case 1:
+		if a, ok := opts.aliases[positional[0]]; ok && !opts.all {
+			opts.alias = &a
+			opts.scriptName = a.Script
+			opts.scriptArgs = append(append([]string(nil), a.Args...), opts.scriptArgs...)
+		} else if info, err := os.Stat(positional[0]); err == nil && info.IsDir() && !opts.all {
+			opts.searchPath = positional[0]
+		} else {
+			opts.scriptName = positional[0]
+		}
+	default:
+		if opts.all || opts.last || opts.where || opts.runID != "" || opts.watch || opts.exec || opts.restart != restartNever || opts.tmux != "" || opts.eval || opts.serve || opts.doctor || opts.export != "" || opts.withDeps != "" {
+			return nil, fmt.Errorf("unexpected arguments: %s, several script names cannot be combined with --all, --last, --where, --run-id, --watch, --exec, --restart, --tmux, --eval, --serve, --with-deps, doctor or export", strings.Join(positional[1:], " "))
+		}
+		opts.scriptName, opts.scriptNames = positional[0], positional
+	}
+	if opts.doctor && opts.scriptName != "" {
+		return nil, errors.New("doctor only takes a directory")
+	}
+	if opts.where && opts.scriptName == "" {
+		return nil, errors.New("--where needs a script name")
+	}
+
+	return opts, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// envFlags maps GO_NPM_RUN_* environment variables to the flag whose value
+// they provide. List variables hold comma separated values.
+var envFlags = []struct {
+	env  string
+	flag string
+	list bool
+}{
+	{env: "GO_NPM_RUN_PM", flag: "pm"},
+	{env: "GO_NPM_RUN_FINDER", flag: "finder"},
+	{env: "GO_NPM_RUN_NO_NODE_RUN", flag: "no-node-run"},
+	{env: "GO_NPM_RUN_NO_COREPACK", flag: "no-corepack"},
+	{env: "GO_NPM_RUN_NO_PREVIEW", flag: "no-preview"},
+	{env: "GO_NPM_RUN_NO_VERSIONS", flag: "no-versions"},
+	{env: "GO_NPM_RUN_NO_LOCAL_DEPS", flag: "no-local-deps"},
+	{env: "GO_NPM_RUN_QUIET", flag: "quiet"},
+	{env: "GO_NPM_RUN_SORT", flag: "sort"},
+	{env: "GO_NPM_RUN_SEARCH", flag: "search"},
+	{env: "GO_NPM_RUN_EXACT", flag: "exact"},
+	{env: "GO_NPM_RUN_CASE", flag: "case"},
+	{env: "GO_NPM_RUN_PLAIN", flag: "plain"},
+	{env: "GO_NPM_RUN_IF_PRESENT", flag: "if-present"},
+	{env: "GO_NPM_RUN_NO_HISTORY", flag: "no-history"},
+	{env: "GO_NPM_RUN_JOBS", flag: "jobs"},
+	{env: "GO_NPM_RUN_OUTPUT", flag: "output"},
+	{env: "GO_NPM_RUN_NOTIFY", flag: "notify"},
+	{env: "GO_NPM_RUN_HTTP_TOKEN", flag: "http-token"},
+	{env: "GO_NPM_RUN_PARSE_JOBS", flag: "parse-jobs"},
+	{env: "GO_NPM_RUN_CLEAN_ENV", flag: "clean-env"},
+	{env: "GO_NPM_RUN_IGNORE", flag: "ignore", list: true},
+	{env: "GO_NPM_RUN_EXCLUDE", flag: "exclude", list: true},
+	{env: "GO_NPM_RUN_EXCLUDE_PACKAGE", flag: "exclude-package", list: true},
+	{env: "GO_NPM_RUN_ENV_ALLOW", flag: "env-allow", list: true},
+}
+
+// applyEnv sets opts from the environment, parsing every value with the
+// same flag.Value the command line uses.
+func applyEnv(opts *options) error {
+	fs := newFlagSet(opts)
+	for _, ef := range envFlags {
+		value, ok := os.LookupEnv(ef.env)
+		if !ok || value == "" {
+			continue
+		}
+		values := []string{value}
+		if ef.list {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			if err := fs.Set(ef.flag, v); err != nil {
+				return fmt.Errorf("%s: %w", ef.env, err)
+			}
+		}
+		opts.setSource(ef.flag, "env "+ef.env)
+	}
+	return nil
+}
+
+// configFlagValue returns the value of --config when it is present in args.
+func configFlagValue(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// searchPathArg returns the directory args, which have not been parsed
+// yet, search: the positional argument when it is the only one and a
+// directory, like parseArgs decides later, or else ".". Parse errors are
+// left to the real parse.
+func searchPathArg(args []string) string {
+	if len(args) > 1 && args[0] == "export" {
+		args = args[2:]
+	} else if len(args) > 0 && args[0] == "doctor" {
+		args = args[1:]
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[:i]
+			break
+		}
+	}
+	scratch := &options{}
+	fs := newFlagSet(scratch)
+	var positional []string
+	for {
+		if fs.Parse(args) != nil {
+			return "."
+		}
+		if args = fs.Args(); len(args) == 0 {
+			break
+		}
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	if len(positional) == 1 && !scratch.all && isDir(positional[0]) {
+		return positional[0]
+	}
+	return "."
+}
+
+// flagPresent reports whether the boolean flag name is set in args, which
+// have not been parsed yet.
+func flagPresent(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--"+name || arg == "-"+name || arg == "--"+name+"=true" || arg == "-"+name+"=true" {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands are tried in order when OSC52 is not available.
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// copyToClipboard puts text on the system clipboard. It emits an OSC52
+// escape sequence on the controlling terminal, which works over ssh and in
+// most modern terminals, and also hands the text to the first native
+// clipboard tool found since OSC52 support cannot be detected.
+func copyToClipboard(text string) error {
+	osc52Err := copyWithOSC52(text)
+	nativeErr := copyWithTool(text)
+	if osc52Err != nil && nativeErr != nil {
+		return fmt.Errorf("no clipboard available: %v, %v", osc52Err, nativeErr)
+	}
+	return nil
+}
+
+func copyWithOSC52(text string) error {
+	if runtime.GOOS == "windows" {
+		return errors.New("OSC52 is not supported on windows")
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	// tmux only forwards OSC52 when wrapped in a passthrough sequence
+	if os.Getenv("TMUX") != "" {
+		seq = "\x1bPtmux;\x1b" + seq + "\x1b\\"
+	}
+	_, err = tty.WriteString(seq)
+	return err
+}
+
+func copyWithTool(text string) error {
+	for _, command := range clipboardCommands {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errors.New("no clipboard tool found")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// invocation is a resolved script plus how go-npm-run supervises it.
+type invocation struct {
+	runner.Invocation
+	// timeout stops the script once it ran that long, zero means never.
+	// It gets timeoutGrace to exit before it is killed.
+	timeout      time.Duration
+	timeoutGrace time.Duration
+	// retries is how often a failed run is repeated, retryDelay apart.
+	retries    int
+	retryDelay time.Duration
+	// pty runs the script in a pseudo terminal when its output is captured
+	// while go-npm-run's own stdout is a terminal.
+	pty bool
+	// errorsOnly captures the output instead of streaming it and replays
+	// its last tailLines lines when the script fails, see runCaptured.
+	errorsOnly bool
+	tailLines  int
+	// notify shows a desktop notification when a run that took at least
+	// notifyAfter finishes, see notifyResult.
+	notify      bool
+	notifyAfter time.Duration
+	// logPath is the --log file the output is copied to, without ANSI
+	// escape sequences when logStripANSI is set.
+	logPath      string
+	logStripANSI bool
+	// timestamps prefixes every output line with the time, see
+	// timestampWriter.
+	timestamps timestampMode
+	// recorded is the history entry of the run, completed with its
+	// duration and exit code once it finished.
+	recorded *historyEntry
+}
+
+// resolveInvocation works out the binary, arguments and working directory
+// used to run script with the forwarded args, and how to supervise it.
+func resolveInvocation(script discover.NpmScript, opts *options) invocation {
+	inv := invocation{Invocation: runner.Resolve(script, runner.Options{
+		PackageManager: opts.packageManager,
+		PMSource:       opts.sources["pm"],
+		Raw:            opts.raw,
+		NoNodeRun:      opts.noNodeRun,
+		NoCorepack:     opts.noCorepack,
+		Args:           opts.scriptArgs,
+		Dir:            runDir(script, opts),
+	})}
+	inv.timeout, inv.timeoutGrace = opts.timeout, opts.timeoutGrace
+	inv.retries, inv.retryDelay = opts.retry, opts.retryDelay
+	inv.pty = !opts.noPty
+	inv.errorsOnly, inv.tailLines = opts.output == outputErrorsOnly, opts.tailLines
+	inv.notify, inv.notifyAfter = opts.notify, opts.notifyAfter
+	inv.timestamps = opts.timestamps
+	if opts.log != "" {
+		path, err := logFilePath(opts.log, script, time.Now())
+		if err != nil {
+			warnf("cannot log %s: %v", script.Label(), err)
+		}
+		inv.logPath, inv.logStripANSI = path, opts.logStripANSI
+	}
+	return inv
+}
+
+// Places accepted by --run-at.
+const (
+	runAtPackage = "package"
+	runAtRoot    = "root"
+	runAtCwd     = "cwd"
+)
+
+var runAtModes = []string{runAtPackage, runAtRoot, runAtCwd}
+
+// runDir returns the directory --dir or --run-at asks script to run in, or
+// "" for its package directory.
+func runDir(script discover.NpmScript, opts *options) string {
+	switch {
+	case opts.dir != "":
+		if dir, err := filepath.Abs(opts.dir); err == nil {
+			return dir
+		}
+		return opts.dir
+	case opts.runAt == runAtRoot:
+		return discover.ProjectRoot(filepath.Dir(script.AbsolutePath))
+	case opts.runAt == runAtCwd:
+		if dir, err := os.Getwd(); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// checkRunDir fails when the working directory of inv is not a directory.
+func checkRunDir(inv invocation) error {
+	info, err := os.Stat(inv.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot run %s in %s: no such directory", inv.Script.Label(), displayPath(inv.Dir))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot run %s in %s: %w", inv.Script.Label(), displayPath(inv.Dir), err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot run %s in %s: not a directory", inv.Script.Label(), displayPath(inv.Dir))
+	}
+	return nil
+}
+
+// printDryRun describes each invocation without running anything. Details
+// are emitted as shell comments so the whole output stays pasteable.
+func printDryRun(w io.Writer, invocations []invocation) {
+	for _, inv := range invocations {
+		fmt.Fprintf(w, "# %s > (%s) from %s\n", inv.Script.PackageName, inv.Script.ScriptName, inv.Script.AbsolutePath)
+		fmt.Fprintf(w, "# → %s\n", describeRun(inv))
+		if inv.Shell != "" {
+			fmt.Fprintf(w, "# runs through %s (%s), pre and post scripts are skipped\n", inv.Name, inv.Shell)
+			fmt.Fprintf(w, "# sets %d npm_package_* and npm_lifecycle_* variables\n", len(inv.PackageEnv))
+		} else {
+			fmt.Fprintf(w, "# package manager: %s (%s)\n", inv.PackageManager, inv.PMSource)
+		}
+		if inv.Corepack != "" {
+			fmt.Fprintf(w, "# via corepack: %s pinned by packageManager\n", inv.Corepack)
+		}
+		if inv.RunnerReason != "" {
+			fmt.Fprintf(w, "# npm run instead of node --run: %s\n", inv.RunnerReason)
+		}
+		if inv.BaseEnv != nil {
+			env := inv.Environ()
+			fmt.Fprintf(w, "# clean environment, %d variables:\n", len(env))
+			for _, assignment := range env {
+				if strings.ContainsAny(assignment, "\r\n") {
+					assignment = strconv.Quote(assignment)
+				}
+				fmt.Fprintf(w, "#   %s\n", assignment)
+			}
+		}
+		fmt.Fprintln(w, inv.CommandLine())
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionFlag describes a flag the way the completion scripts need it.
+type completionFlag struct {
+	long     string
+	short    string
+	usage    string
+	hasValue bool
+}
+
+// completionFlags lists every long flag from the CLI flag set, sorted by name.
+func completionFlags() []completionFlag {
+	fs := newFlagSet(&options{})
+
+	aliases := map[string]bool{}
+	for _, short := range shortFlags {
+		aliases[short] = true
+	}
+
+	flags := []completionFlag{{long: "help", short: "h", usage: "show this help and exit"}}
+	fs.VisitAll(func(f *flag.Flag) {
+		if aliases[f.Name] {
+			return
+		}
+		isBool := false
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			isBool = bf.IsBoolFlag()
+		}
+		flags = append(flags, completionFlag{
+			long:     f.Name,
+			short:    shortFlags[f.Name],
+			usage:    f.Usage,
+			hasValue: !isBool,
+		})
+	})
+
+	sort.Slice(flags, func(i, j int) bool { return flags[i].long < flags[j].long })
+	return flags
+}
+
+// writeCompletion prints a static completion script for shell to w.
+func writeCompletion(w io.Writer, shell string) error {
+	flags := completionFlags()
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q, expected one of: %s", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag) {
+	var words, valueFlags []string
+	for _, f := range flags {
+		words = append(words, "--"+f.long)
+		if f.short != "" {
+			words = append(words, "-"+f.short)
+		}
+		if f.hasValue {
+			valueFlags = append(valueFlags, "--"+f.long)
+			if f.short != "" {
+				valueFlags = append(valueFlags, "-"+f.short)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "# bash completion for go-npm-run")
+	fmt.Fprintln(w, "# Install with: eval \"$(go-npm-run completion bash)\"")
+	fmt.Fprintln(w, "# or: go-npm-run completion bash > /etc/bash_completion.d/go-npm-run")
+	fmt.Fprintln(w, "_go_npm_run() {")
+	fmt.Fprintln(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\"")
+	fmt.Fprintln(w, "    local prev=\"${COMP_WORDS[COMP_CWORD-1]}\"")
+	fmt.Fprintln(w, "    if [[ $COMP_CWORD -eq 2 && \"${COMP_WORDS[1]}\" == completion ]]; then")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(completionShells, " "))
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    fi")
+	if len(valueFlags) > 0 {
+		fmt.Fprintln(w, "    case \"$prev\" in")
+		fmt.Fprintf(w, "        %s)\n", strings.Join(valueFlags, "|"))
+		fmt.Fprintln(w, "            COMPREPLY=($(compgen -f -- \"$cur\"))")
+		fmt.Fprintln(w, "            return")
+		fmt.Fprintln(w, "            ;;")
+		fmt.Fprintln(w, "    esac")
+	}
+	fmt.Fprintln(w, "    if [[ \"$cur\" == -* ]]; then")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(words, " "))
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, "    COMPREPLY=($(compgen -d -- \"$cur\"))")
+	fmt.Fprintln(w, "    if [[ $COMP_CWORD -eq 1 ]]; then")
+	fmt.Fprintln(w, "        COMPREPLY+=($(compgen -W \"completion\" -- \"$cur\"))")
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o filenames -F _go_npm_run go-npm-run")
+}
+
+// zshQuote escapes a flag description for use inside an _arguments spec.
+func zshQuote(s string) string {
+	s = strings.ReplaceAll(s, "'", `'\''`)
+	s = strings.ReplaceAll(s, "[", `\[`)
+	s = strings.ReplaceAll(s, "]", `\]`)
+	s = strings.ReplaceAll(s, ":", `\:`)
+	return s
+}
+
+func writeZshCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "#compdef go-npm-run")
+	fmt.Fprintln(w, "# zsh completion for go-npm-run")
+	fmt.Fprintln(w, "# Install with: eval \"$(go-npm-run completion zsh)\"")
+	fmt.Fprintln(w, "# or: go-npm-run completion zsh > \"${fpath[1]}/_go-npm-run\"")
+	fmt.Fprintln(w, "_go_npm_run() {")
+	fmt.Fprintln(w, "  if (( CURRENT == 3 )) && [[ ${words[2]} == completion ]]; then")
+	fmt.Fprintf(w, "    _values 'shell' %s\n", strings.Join(completionShells, " "))
+	fmt.Fprintln(w, "    return")
+	fmt.Fprintln(w, "  fi")
+	fmt.Fprintln(w, "  _arguments -s \\")
+	for _, f := range flags {
+		value := ""
+		if f.hasValue {
+			value = ":" + f.long + ":_files"
+		}
+		desc := zshQuote(f.usage)
+		if f.short != "" {
+			fmt.Fprintf(w, "    '(-%s --%s)'{-%s,--%s}'[%s]%s' \\\n", f.short, f.long, f.short, f.long, desc, value)
+		} else {
+			fmt.Fprintf(w, "    '--%s[%s]%s' \\\n", f.long, desc, value)
+		}
+	}
+	fmt.Fprintln(w, "    '1:path:{_alternative \"commands:command:(completion)\" \"dirs:path:_files -/\"}' \\")
+	fmt.Fprintln(w, "    '*::args:'")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "if [[ \"${funcstack[1]}\" == \"_go_npm_run\" ]]; then")
+	fmt.Fprintln(w, "  _go_npm_run \"$@\"")
+	fmt.Fprintln(w, "else")
+	fmt.Fprintln(w, "  compdef _go_npm_run go-npm-run")
+	fmt.Fprintln(w, "fi")
+}
+
+func writeFishCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "# fish completion for go-npm-run")
+	fmt.Fprintln(w, "# Install with: go-npm-run completion fish > ~/.config/fish/completions/go-npm-run.fish")
+	fmt.Fprintln(w, "complete -c go-npm-run -f")
+	fmt.Fprintln(w, "complete -c go-npm-run -n '__fish_use_subcommand' -a '(__fish_complete_directories)'")
+	fmt.Fprintln(w, "complete -c go-npm-run -n '__fish_use_subcommand' -a completion -d 'print a shell completion script'")
+	fmt.Fprintf(w, "complete -c go-npm-run -n '__fish_seen_subcommand_from completion' -a '%s'\n", strings.Join(completionShells, " "))
+	for _, f := range flags {
+		line := "complete -c go-npm-run"
+		if f.short != "" {
+			line += " -s " + f.short
+		}
+		line += " -l " + f.long
+		if f.hasValue {
+			line += " -r -F"
+		}
+		line += " -d '" + strings.ReplaceAll(f.usage, "'", `\'`) + "'"
+		fmt.Fprintln(w, line)
+	}
+}
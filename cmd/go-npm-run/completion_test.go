@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestCompletion compares the completion scripts with testdata/completion.*,
+// run with -update after changing the flags to accept the new output.
+func TestCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		shell := shell
+		t.Run(shell, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			if err := writeCompletion(&buf, shell); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "completion."+shell)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run go test -run TestCompletion -update to create it", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s completion differs from %s, run go test -run TestCompletion -update if the change is intended\n got:\n%s", shell, golden, buf.String())
+			}
+		})
+	}
+}
+
+func TestCompletionUnsupportedShell(t *testing.T) {
+	if err := writeCompletion(&bytes.Buffer{}, "powershell"); err == nil {
+		t.Error("no error for powershell")
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the user level configuration file, by default
+// os.UserConfigDir()/go-npm-run/config.yaml, or the project one, see
+// loadProjectConfig. Every key is optional and command line flags take
+// precedence over it.
+type Config struct {
+	// Ignore lists extra directory names skipped during the scan.
+	Ignore []string `yaml:"ignore"`
+	// Exclude lists script globs hidden like --exclude.
+	Exclude []string `yaml:"exclude"`
+	// ExcludePackage lists package name or path globs hidden like
+	// --exclude-package.
+	ExcludePackage []string `yaml:"exclude-package"`
+	// Finder is the default for --finder.
+	Finder string `yaml:"finder"`
+	// PM is the default for --pm.
+	PM string `yaml:"pm"`
+	// NodeRun runs npm projects with node --run when node supports it, on
+	// unless set to false.
+	NodeRun *bool `yaml:"node-run"`
+	// Preview shows the preview pane in the picker, on unless set to false.
+	Preview *bool `yaml:"preview"`
+	// Versions shows the package versions in the picker labels, on unless
+	// set to false.
+	Versions *bool `yaml:"versions"`
+	// Quiet is the default for --quiet.
+	Quiet *bool `yaml:"quiet"`
+	// Sort is the default for --sort.
+	Sort string `yaml:"sort"`
+	// Search is the default for --search.
+	Search string `yaml:"search"`
+	// Exact is the default for --exact, Case for --case.
+	Exact *bool  `yaml:"exact"`
+	Case  string `yaml:"case"`
+	// Dotenv loads the .env file of the package directory into the
+	// script's environment, before any --env-file.
+	Dotenv *bool `yaml:"dotenv"`
+	// CleanEnv is the default for --clean-env, EnvAllow adds globs to
+	// --env-allow.
+	CleanEnv *bool    `yaml:"clean-env"`
+	EnvAllow []string `yaml:"env-allow"`
+	// Jobs is the default for --jobs.
+	Jobs int `yaml:"jobs"`
+	// Output is the default for --output.
+	Output string `yaml:"output"`
+	// TailLines is the default for --tail-lines.
+	TailLines int `yaml:"tail-lines"`
+	// Notify is the default for --notify.
+	Notify *bool `yaml:"notify"`
+	// NotifyAfter is the default for --notify-after, e.g. "30s".
+	NotifyAfter string `yaml:"notify-after"`
+	// Tmux is the default for --tmux, TmuxRemainOnExit for
+	// --tmux-remain-on-exit.
+	Tmux             string `yaml:"tmux"`
+	TmuxRemainOnExit string `yaml:"tmux-remain-on-exit"`
+	// Dangerous replaces the script globs that need a typed confirmation,
+	// an empty list turns the confirmation off. DangerousExtra adds to
+	// them.
+	Dangerous      *[]string `yaml:"dangerous"`
+	DangerousExtra []string  `yaml:"dangerous-extra"`
+	// Aliases map shortcut names to a package and script, see alias.
+	Aliases map[string]alias `yaml:"aliases"`
+	// History records runs in the history file, on unless set to false.
+	History *bool `yaml:"history"`
+}
+
+// configKeys are the top level keys accepted in the config file.
+var configKeys = []string{"ignore", "exclude", "exclude-package", "finder", "pm", "node-run", "preview", "versions", "quiet", "sort", "search", "exact", "case", "dotenv", "clean-env", "env-allow", "jobs", "history", "output", "tail-lines", "notify", "notify-after", "tmux", "tmux-remain-on-exit", "dangerous", "dangerous-extra", "aliases"}
+
+// defaultConfigPath returns the location of the user config file.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-npm-run", "config.yaml"), nil
+}
+
+// loadConfig reads the config file at path. With required unset a missing
+// file yields an empty config and no error.
+func loadConfig(path string, required bool) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	return parseConfig(data, path)
+}
+
+// projectConfigName is the project config file at the project root.
+const projectConfigName = ".go-npm-run.yaml"
+
+// loadProjectConfig returns the config of the project searchPath belongs
+// to, found at its discover.ProjectRoot: the
+// .go-npm-run.yaml file or else the "go-npm-run" object of package.json.
+// path names where it was read from, nil and "" mean there is none.
+// Relative package directories of its aliases are made relative to the
+// project root.
+func loadProjectConfig(searchPath string) (config *Config, path string, err error) {
+	dir, err := filepath.Abs(searchPath)
+	if err != nil {
+		return nil, "", nil
+	}
+	root := discover.ProjectRoot(dir)
+	path = filepath.Join(root, projectConfigName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		path = filepath.Join(root, "package.json") + ` ("go-npm-run")`
+		var pkg map[string]json.RawMessage
+		if packageJSON, err := os.ReadFile(filepath.Join(root, "package.json")); err != nil || json.Unmarshal(packageJSON, &pkg) != nil || pkg["go-npm-run"] == nil {
+			return nil, "", nil
+		}
+		// The hide list belongs to the package, not to the config
+		var object map[string]json.RawMessage
+		if json.Unmarshal(pkg["go-npm-run"], &object) == nil {
+			if _, ok := object["hide"]; ok {
+				delete(object, "hide")
+				if len(object) == 0 {
+					return nil, "", nil
+				}
+				pkg["go-npm-run"], _ = json.Marshal(object)
+			}
+		}
+		// JSON is YAML, so the object is parsed like the config file
+		data, err = pkg["go-npm-run"], nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("reading config: %w", err)
+	}
+	if config, err = parseConfig(data, path); err != nil {
+		return nil, "", err
+	}
+	for name, a := range config.Aliases {
+		if dir := filepath.Join(root, a.Package); !filepath.IsAbs(a.Package) && isDir(dir) {
+			a.Package = dir
+			config.Aliases[name] = a
+		}
+	}
+	return config, path, nil
+}
+
+// parseConfig decodes and validates the config read from path.
+func parseConfig(data []byte, path string) (*Config, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, item := range raw {
+		key := fmt.Sprint(item.Key)
+		if !contains(configKeys, key) {
+			return nil, fmt.Errorf("%s: unknown key %q, expected one of: %s", path, key, strings.Join(configKeys, ", "))
+		}
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &config, nil
+}
+
+func (c *Config) validate() error {
+	if c.Finder != "" && !contains(finders, c.Finder) {
+		return fmt.Errorf("finder: invalid value %q, expected one of: %s", c.Finder, strings.Join(finders, ", "))
+	}
+	if c.PM != "" && !contains(runner.PackageManagers, c.PM) {
+		return fmt.Errorf("pm: invalid value %q, expected one of: %s", c.PM, strings.Join(runner.PackageManagers, ", "))
+	}
+	if c.Sort != "" && !contains(sortModes, c.Sort) {
+		return fmt.Errorf("sort: invalid value %q, expected one of: %s", c.Sort, strings.Join(sortModes, ", "))
+	}
+	if c.Search != "" && !contains(searchModes, c.Search) {
+		return fmt.Errorf("search: invalid value %q, expected one of: %s", c.Search, strings.Join(searchModes, ", "))
+	}
+	if c.Case != "" && !contains(caseModes, c.Case) {
+		return fmt.Errorf("case: invalid value %q, expected one of: %s", c.Case, strings.Join(caseModes, ", "))
+	}
+	if c.Output != "" && !contains(outputModes, c.Output) {
+		return fmt.Errorf("output: invalid value %q, expected one of: %s", c.Output, strings.Join(outputModes, ", "))
+	}
+	if c.Tmux != "" && !contains(tmuxModes, c.Tmux) {
+		return fmt.Errorf("tmux: invalid value %q, expected one of: %s", c.Tmux, strings.Join(tmuxModes, ", "))
+	}
+	if c.TmuxRemainOnExit != "" && !contains(tmuxRemainModes, c.TmuxRemainOnExit) {
+		return fmt.Errorf("tmux-remain-on-exit: invalid value %q, expected one of: %s", c.TmuxRemainOnExit, strings.Join(tmuxRemainModes, ", "))
+	}
+	if c.TailLines < 0 {
+		return fmt.Errorf("tail-lines: invalid value %d, expected at least 0", c.TailLines)
+	}
+	if c.NotifyAfter != "" {
+		if d, err := time.ParseDuration(c.NotifyAfter); err != nil || d < 0 {
+			return fmt.Errorf("notify-after: invalid duration %q, expected e.g. 30s", c.NotifyAfter)
+		}
+	}
+	if c.Jobs < 0 {
+		return fmt.Errorf("jobs: invalid value %d, expected at least 1", c.Jobs)
+	}
+	for _, dir := range c.Ignore {
+		if dir == "" || strings.ContainsAny(dir, `/\`) {
+			return fmt.Errorf("ignore: invalid directory name %q, expected a single path segment", dir)
+		}
+	}
+	for _, glob := range c.Exclude {
+		if glob == "" {
+			return errors.New("exclude: empty pattern")
+		}
+	}
+	for _, glob := range c.ExcludePackage {
+		if glob == "" {
+			return errors.New("exclude-package: empty pattern")
+		}
+	}
+	for _, glob := range c.EnvAllow {
+		if glob == "" {
+			return errors.New("env-allow: empty pattern")
+		}
+	}
+	if err := validateAliases(c.Aliases); err != nil {
+		return err
+	}
+	if c.Dangerous != nil {
+		for _, glob := range *c.Dangerous {
+			if glob == "" {
+				return errors.New("dangerous: empty pattern")
+			}
+		}
+	}
+	for _, glob := range c.DangerousExtra {
+		if glob == "" {
+			return errors.New("dangerous-extra: empty pattern")
+		}
+	}
+	return nil
+}
+
+// apply copies the configured values into opts as defaults for the flags.
+// path is recorded as the source of every value it sets.
+func (c *Config) apply(opts *options, path string) {
+	source := "config " + path
+	if len(c.Ignore) > 0 {
+		opts.ignore = append(opts.ignore, c.Ignore...)
+		opts.setSource("ignore", source)
+	}
+	if len(c.Exclude) > 0 {
+		opts.exclude = append(opts.exclude, c.Exclude...)
+		opts.setSource("exclude", source)
+	}
+	if len(c.ExcludePackage) > 0 {
+		opts.excludePackages = append(opts.excludePackages, c.ExcludePackage...)
+		opts.setSource("exclude-package", source)
+	}
+	if c.Finder != "" {
+		opts.finder = c.Finder
+		opts.setSource("finder", source)
+	}
+	if c.PM != "" {
+		opts.packageManager = c.PM
+		opts.setSource("pm", source)
+	}
+	if c.NodeRun != nil {
+		opts.noNodeRun = !*c.NodeRun
+		opts.setSource("no-node-run", source)
+	}
+	if c.Preview != nil {
+		opts.noPreview = !*c.Preview
+		opts.setSource("no-preview", source)
+	}
+	if c.Versions != nil {
+		opts.noVersions = !*c.Versions
+		opts.setSource("no-versions", source)
+	}
+	if c.Quiet != nil {
+		opts.quiet = *c.Quiet
+		opts.setSource("quiet", source)
+	}
+	if c.Sort != "" {
+		opts.sort = c.Sort
+		opts.setSource("sort", source)
+	}
+	if c.Search != "" {
+		opts.search = c.Search
+		opts.setSource("search", source)
+	}
+	if c.Exact != nil {
+		opts.exact = *c.Exact
+		opts.setSource("exact", source)
+	}
+	if c.Case != "" {
+		opts.caseMode = c.Case
+		opts.setSource("case", source)
+	}
+	if c.Dotenv != nil {
+		opts.dotenv = *c.Dotenv
+		opts.setSource("dotenv", source)
+	}
+	if c.CleanEnv != nil {
+		opts.cleanEnv = *c.CleanEnv
+		opts.setSource("clean-env", source)
+	}
+	if len(c.EnvAllow) > 0 {
+		opts.envAllow = append(opts.envAllow, c.EnvAllow...)
+		opts.setSource("env-allow", source)
+	}
+	if c.Jobs > 0 {
+		opts.jobs = c.Jobs
+		opts.setSource("jobs", source)
+	}
+	if c.Output != "" {
+		opts.output = c.Output
+		opts.setSource("output", source)
+	}
+	if c.TailLines > 0 {
+		opts.tailLines = c.TailLines
+		opts.setSource("tail-lines", source)
+	}
+	if c.Notify != nil {
+		opts.notify = *c.Notify
+		opts.setSource("notify", source)
+	}
+	if c.NotifyAfter != "" {
+		// validate already parsed it
+		opts.notifyAfter, _ = time.ParseDuration(c.NotifyAfter)
+		opts.setSource("notify-after", source)
+	}
+	if c.Tmux != "" {
+		opts.tmux = c.Tmux
+		opts.setSource("tmux", source)
+	}
+	if c.TmuxRemainOnExit != "" {
+		opts.tmuxRemain = c.TmuxRemainOnExit
+		opts.setSource("tmux-remain-on-exit", source)
+	}
+	if c.Dangerous != nil {
+		opts.dangerous = *c.Dangerous
+		opts.setSource("dangerous", source)
+	}
+	if len(c.DangerousExtra) > 0 {
+		opts.dangerous = append(append([]string(nil), opts.dangerous...), c.DangerousExtra...)
+		opts.setSource("dangerous", source)
+	}
+	for name, a := range c.Aliases {
+		if opts.aliases == nil {
+			opts.aliases = map[string]alias{}
+		}
+		a.Name = name
+		opts.aliases[name] = a
+	}
+	if c.History != nil {
+		opts.noHistory = !*c.History
+		opts.setSource("no-history", source)
+	}
+}
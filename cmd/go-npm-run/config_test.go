@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestProjectConfigOverridesBools checks that a project config can turn
+// off what the user config turned on.
+func TestProjectConfigOverridesBools(t *testing.T) {
+	t.Parallel()
+	user, err := parseConfig([]byte("quiet: true\nexact: true\nnotify: true\ndotenv: true\nclean-env: true\n"), "user.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := parseConfig([]byte("quiet: false\nexact: false\nnotify: false\ndotenv: false\nclean-env: false\n"), ".go-npm-run.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &options{}
+	user.apply(opts, "user.yaml")
+	project.apply(opts, ".go-npm-run.yaml")
+	if opts.quiet || opts.exact || opts.notify || opts.dotenv || opts.cleanEnv {
+		t.Errorf("after the project config quiet=%v exact=%v notify=%v dotenv=%v clean-env=%v, want all false", opts.quiet, opts.exact, opts.notify, opts.dotenv, opts.cleanEnv)
+	}
+}
+
+func TestSearchPathArg(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(dir, "repo")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "."},
+		{[]string{"--list", repo}, repo},
+		{[]string{repo, "--sort", "name"}, repo},
+		{[]string{"-s", repo, "--", "arg"}, repo},
+		{[]string{"doctor", repo}, repo},
+		{[]string{"export", "aliases", repo}, repo},
+		{[]string{"build"}, "."},
+		{[]string{"--all", repo}, "."},
+		{[]string{repo, "build"}, "."},
+		{[]string{"--unknown-flag", repo}, "."},
+	}
+	for _, tt := range tests {
+		if got := searchPathArg(tt.args); got != tt.want {
+			t.Errorf("searchPathArg(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// defaultDangerous are the script globs that need a typed confirmation
+// unless the config replaces them.
+var defaultDangerous = []string{"*reset*", "*drop*", "*destroy*", "*wipe*", "publish", "release"}
+
+// dangerousGlob returns the first of globs matching the script of inv.
+func dangerousGlob(inv invocation, globs []string) (string, bool) {
+	for _, glob := range globs {
+		if discover.MatchScriptGlob(glob, inv.Script) {
+			return glob, true
+		}
+	}
+	return "", false
+}
+
+// confirmDangerous makes the user type the script name before any of
+// invocations matching opts.dangerous runs, and exits when they do not.
+// --yes skips the question, without a terminal to ask on go-npm-run
+// refuses to run them. It has to be called before anything is started.
+func confirmDangerous(opts *options, invocations []invocation) {
+	if opts.yes {
+		return
+	}
+	asked := map[string]bool{}
+	var reader *bufio.Reader
+	for _, inv := range invocations {
+		name := inv.Script.ScriptName
+		glob, dangerous := dangerousGlob(inv, opts.dangerous)
+		if !dangerous || asked[name] {
+			continue
+		}
+		asked[name] = true
+		where := inv.Script.PackageName
+		if len(invocations) > 1 {
+			where = fmt.Sprintf("%d packages", countScript(invocations, name))
+		}
+		if !isTerminal(os.Stdin) {
+			fmt.Fprintf(os.Stderr, "Error: %s in %s matches the dangerous script pattern %q, pass --yes to run it\n", name, where, glob)
+			os.Exit(exitFailure)
+		}
+		if reader == nil {
+			reader = bufio.NewReader(os.Stdin)
+		}
+		fmt.Fprintf(os.Stderr, "%s %s in %s matches the dangerous script pattern %q.\nType the script name to continue: ", paint(colorRed, "!"), name, where, glob)
+		answer, _ := reader.ReadString('\n')
+		if strings.TrimSpace(answer) != name {
+			if answer == "" {
+				fmt.Fprintln(os.Stderr)
+			}
+			fmt.Fprintln(os.Stderr, "Error: not confirmed, nothing was run")
+			os.Exit(exitFailure)
+		}
+	}
+}
+
+// countScript returns how many of invocations run a script called name.
+func countScript(invocations []invocation, name string) int {
+	n := 0
+	for _, inv := range invocations {
+		if inv.Script.ScriptName == name {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// runDoctor prints what `go-npm-run doctor` finds out about the discovery
+// below opts.searchPath and returns the exit code, exitFailure when it
+// found problems. The report starts with versionString, for bug reports.
+func runDoctor(w io.Writer, opts *options) int {
+	fmt.Fprintf(w, "%s\n\n", versionString())
+	root, _ := filepath.Abs(opts.searchPath)
+	reason := "the current directory"
+	if opts.searchPath != "." {
+		reason = "given on the command line"
+	}
+	fmt.Fprintf(w, "Search root: %s (%s)\n", root, reason)
+	if project := discover.ProjectRoot(root); project != root {
+		fmt.Fprintf(w, "  it belongs to the project at %s, run go-npm-run there to see all of its workspaces\n", project)
+	}
+
+	d := discover.Diagnose(opts.searchPath)
+	var problems []string
+	problem := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	fmt.Fprintf(w, "\nPackages found by the directory walk: %d, through workspaces: %d\n", len(d.Roots), d.Workspaces)
+	for _, r := range d.Roots {
+		fmt.Fprintf(w, "  %s (%s)\n", r.Path, r.PackageManager)
+		for _, source := range r.Sources {
+			what := "workspaces"
+			if filepath.Base(source.Path) == "pnpm-workspace.yaml" {
+				what = "pnpm-workspace.yaml"
+			}
+			fmt.Fprintf(w, "    %s:\n", what)
+			for _, p := range source.Patterns {
+				switch {
+				case p.Exclude:
+					fmt.Fprintf(w, "      !%s  excludes %d\n", p.Pattern, p.Matches)
+				case p.Matches == 0:
+					fmt.Fprintf(w, "      %s  matches nothing\n", p.Pattern)
+					problem("%s: workspace pattern %q matches no package", source.Path, p.Pattern)
+				default:
+					fmt.Fprintf(w, "      %s  matches %d\n", p.Pattern, p.Matches)
+				}
+			}
+		}
+	}
+
+	if len(d.Unsupported) > 0 {
+		fmt.Fprintln(w, "\nWorkspace configs go-npm-run does not read:")
+		for _, path := range d.Unsupported {
+			fmt.Fprintf(w, "  %s, list its packages in the package.json workspaces or pnpm-workspace.yaml\n", path)
+		}
+	}
+
+	// Packages next to each other without a workspace are separate
+	// projects, strays only matter once there is a workspace
+	if len(d.Uncovered) > 0 && d.Workspaces > 0 {
+		fmt.Fprintln(w, "\nPackages found by the directory walk but not part of any workspace:")
+		for _, path := range d.Uncovered {
+			fmt.Fprintf(w, "  %s\n", path)
+			problem("%s is not part of any workspace, --workspaces-only drops it", path)
+		}
+	}
+	for _, conflict := range d.Lockfiles {
+		problem("%s has several lockfiles: %s, %s decides the package manager", conflict.Dir, strings.Join(conflict.Files, ", "), conflict.Files[0])
+	}
+	for _, e := range d.Unreadable {
+		problem("cannot read %s: %v", e.Path, e.Err)
+	}
+	for _, e := range d.Malformed {
+		problem("%s is malformed: %v", e.Path, e.Err)
+	}
+
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "\nNo problems found.")
+		return 0
+	}
+	fmt.Fprintf(w, "\n%d problems found:\n", len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+	return exitFailure
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// lineArgEditors accept "+LINE file" to open a file at a line.
+var lineArgEditors = map[string]bool{
+	"vi": true, "vim": true, "nvim": true, "gvim": true, "mvim": true,
+	"nano": true, "pico": true, "micro": true, "emacs": true, "emacsclient": true,
+	"kak": true, "mg": true, "ne": true, "joe": true, "jed": true,
+}
+
+// colonLineEditors accept "file:LINE" to open a file at a line.
+var colonLineEditors = map[string]bool{
+	"subl": true, "hx": true, "helix": true, "zed": true,
+}
+
+// editorCommand returns the user's editor from $EDITOR, then $VISUAL,
+// falling back to vi. The value may contain arguments, e.g. "code -w".
+func editorCommand() []string {
+	for _, env := range []string{"EDITOR", "VISUAL"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// openInEditor opens path in the user's editor, at line when the editor is
+// known to support it, and waits for the editor to exit.
+func openInEditor(path string, line int) error {
+	editor := editorCommand()
+	name := strings.TrimSuffix(filepath.Base(editor[0]), ".exe")
+
+	args := editor[1:]
+	switch {
+	case line > 0 && lineArgEditors[name]:
+		args = append(args, fmt.Sprintf("+%d", line), path)
+	case line > 0 && colonLineEditors[name]:
+		args = append(args, fmt.Sprintf("%s:%d", path, line))
+	case line > 0 && (name == "code" || name == "codium"):
+		args = append(args, "-g", fmt.Sprintf("%s:%d", path, line))
+	default:
+		args = append(args, path)
+	}
+
+	cmd := exec.Command(editor[0], args...)
+	// Talk to the terminal directly, stdout may be captured by --print
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	} else {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", editor[0], err)
+	}
+	return nil
+}
+
+// refreshScript re-reads the package.json script came from and returns its
+// current definition. What the scan decided about the package, its package
+// manager and how it was found, is kept.
+func refreshScript(script discover.NpmScript) (discover.NpmScript, error) {
+	_, scripts, err := discover.ReadPackageJSON(script.AbsolutePath)
+	if err != nil {
+		return script, err
+	}
+	for _, s := range scripts {
+		if s.ScriptName == script.ScriptName {
+			s.PackageManager, s.Source = script.PackageManager, script.Source
+			return s, nil
+		}
+	}
+	return script, errors.New("script no longer exists")
+}
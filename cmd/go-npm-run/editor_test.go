@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// TestRefreshScript checks that a script re-read after editing has the new
+// command and keeps what the scan found out about its package.
+func TestRefreshScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "package.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"name": "app", "scripts": {"build": "tsc"}}`)
+	_, scripts, err := discover.ReadPackageJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := scripts[0]
+	script.PackageManager, script.Source = "pnpm", discover.SourceWorkspace
+
+	write(`{"name": "app", "scripts": {"lint": "eslint .", "build": "tsc -b"}}`)
+	got, err := refreshScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Command != "tsc -b" || got.Line != 1 {
+		t.Errorf("refreshScript() = %q on line %d, want %q on line 1", got.Command, got.Line, "tsc -b")
+	}
+	if got.PackageManager != "pnpm" || got.Source != discover.SourceWorkspace {
+		t.Errorf("refreshScript() has package manager %q and source %q, want %q and %q", got.PackageManager, got.Source, "pnpm", discover.SourceWorkspace)
+	}
+
+	write(`{"name": "app", "scripts": {"lint": "eslint ."}}`)
+	if _, err := refreshScript(script); err == nil {
+		t.Error("refreshScript() of a removed script succeeded")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// dotenvName is the file loaded from the package directory with the
+// dotenv config option.
+const dotenvName = ".env"
+
+// envKeyPattern matches the variable names accepted in env files.
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// cleanEnvKeys are the variables --clean-env always passes on, along with
+// platformEnvKeys.
+var cleanEnvKeys = []string{"PATH", "HOME", "TERM"}
+
+// envAssignment is one KEY=VALUE pair read from an env file.
+type envAssignment struct {
+	key, value string
+}
+
+// parseEnvFile parses the dotenv style file at path: KEY=VALUE lines with
+// optional "export " prefixes, blank lines and # comments. Values may be
+// single quoted (literal), double quoted (with \n, \t, \" and \\ escapes,
+// possibly spanning lines) or bare, where a " #" starts a comment.
+func parseEnvFile(path string) ([]envAssignment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	var assignments []envAssignment
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		if !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: invalid variable name %q", path, lineNo, key)
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// Keep reading lines until the closing quote
+			rest := value[1:]
+			for {
+				if end := closingQuote(rest); end >= 0 {
+					if trailing := strings.TrimSpace(rest[end+1:]); trailing != "" && !strings.HasPrefix(trailing, "#") {
+						return nil, fmt.Errorf("%s:%d: unexpected %q after the closing quote", path, i+1, trailing)
+					}
+					value = unescapeEnvValue(rest[:end])
+					break
+				}
+				if i+1 == len(lines) {
+					return nil, fmt.Errorf("%s:%d: unterminated double quoted value", path, lineNo)
+				}
+				i++
+				rest += "\n" + lines[i]
+			}
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("%s:%d: unterminated single quoted value", path, lineNo)
+			}
+			if trailing := strings.TrimSpace(value[end+2:]); trailing != "" && !strings.HasPrefix(trailing, "#") {
+				return nil, fmt.Errorf("%s:%d: unexpected %q after the closing quote", path, lineNo, trailing)
+			}
+			value = value[1 : end+1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		assignments = append(assignments, envAssignment{key: key, value: value})
+	}
+	return assignments, nil
+}
+
+// closingQuote returns the index of the first unescaped double quote in s,
+// or -1.
+func closingQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeEnvValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// applyScriptEnv sets up inv's extra environment from the env files and
+// then the --env flags, which override them. With --clean-env they extend
+// cleanEnvironment instead of go-npm-run's environment.
+func applyScriptEnv(inv *invocation, opts *options) error {
+	if opts.cleanEnv {
+		inv.BaseEnv = cleanEnvironment(opts.envAllow)
+		debugf("--clean-env keeps %d of %d variables", len(inv.BaseEnv), len(os.Environ()))
+	}
+	if err := applyEnvFiles(inv, opts); err != nil {
+		return err
+	}
+	for _, assignment := range opts.envVars {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			// A bare KEY passes the parent's value on explicitly
+			if value, ok = os.LookupEnv(key); !ok {
+				warnf("--env %s: not set in the environment, skipping it", key)
+				continue
+			}
+		}
+		debugf("--env %s=%s", key, value)
+		inv.SetEnv(key, value)
+	}
+	if len(inv.Env) > 0 {
+		debugf("extra environment for %s: %s", inv.Script.Label(), strings.Join(inv.Env, " "))
+	}
+	return nil
+}
+
+// applyEnvFiles adds the variables of the package's .env, when the dotenv
+// config option is set, and of every --env-file to inv's environment.
+// Later files override earlier ones. Variables already set in the parent
+// environment, or with --clean-env in the part of it that is kept, win
+// unless --env-file-override is passed.
+func applyEnvFiles(inv *invocation, opts *options) error {
+	var paths []string
+	if opts.dotenv {
+		path := filepath.Join(filepath.Dir(inv.Script.AbsolutePath), dotenvName)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	paths = append(paths, opts.envFiles...)
+
+	values := map[string]string{}
+	var order []string
+	for _, path := range paths {
+		assignments, err := parseEnvFile(path)
+		if err != nil {
+			return err
+		}
+		debugf("loaded %d variables from %s", len(assignments), path)
+		for _, a := range assignments {
+			if inherited(inv, a.key) && !opts.envFileOverride {
+				debugf("%s from %s is already set in the environment, keeping it", a.key, path)
+				continue
+			}
+			if _, seen := values[a.key]; !seen {
+				order = append(order, a.key)
+			}
+			values[a.key] = a.value
+		}
+	}
+	for _, key := range order {
+		inv.SetEnv(key, values[key])
+	}
+	return nil
+}
+
+// inherited reports whether the script of inv gets key from go-npm-run's
+// environment.
+func inherited(inv *invocation, key string) bool {
+	if inv.BaseEnv == nil {
+		_, set := os.LookupEnv(key)
+		return set
+	}
+	for _, assignment := range inv.BaseEnv {
+		if strings.HasPrefix(assignment, key+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanEnvironment returns the variables of go-npm-run's environment that
+// --clean-env passes on: cleanEnvKeys, platformEnvKeys and the ones whose
+// name matches one of the allow globs, all compared case-insensitively.
+func cleanEnvironment(allow []string) []string {
+	var matchers []*regexp.Regexp
+	for _, glob := range append(append(append([]string(nil), cleanEnvKeys...), platformEnvKeys...), allow...) {
+		if matcher, err := discover.GlobRegexp(glob); err == nil {
+			matchers = append(matchers, matcher)
+		}
+	}
+	env := []string{}
+	for _, assignment := range os.Environ() {
+		key, _, _ := strings.Cut(assignment, "=")
+		if key == "" {
+			continue
+		}
+		for _, matcher := range matchers {
+			if matcher.MatchString(key) {
+				env = append(env, assignment)
+				break
+			}
+		}
+	}
+	return env
+}
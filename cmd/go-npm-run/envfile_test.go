@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		content string
+		want    []envAssignment
+		wantErr string
+	}{
+		{
+			name:    "bare values",
+			content: "A=1\nB = two words \nEMPTY=\n",
+			want:    []envAssignment{{"A", "1"}, {"B", "two words"}, {"EMPTY", ""}},
+		},
+		{
+			name:    "comments and blank lines",
+			content: "# leading\n\nA=1 # trailing\n  # indented\nB=a#b\r\n",
+			want:    []envAssignment{{"A", "1"}, {"B", "a#b"}},
+		},
+		{
+			name:    "export prefix",
+			content: "export A=1\nexport  B=2\n",
+			want:    []envAssignment{{"A", "1"}, {"B", "2"}},
+		},
+		{
+			name:    "single quotes are literal",
+			content: `A='x \n $Y # z' # comment`,
+			want:    []envAssignment{{"A", `x \n $Y # z`}},
+		},
+		{
+			name:    "double quote escapes",
+			content: `A="tab\there \"quoted\" back\\slash\nnext" # comment`,
+			want:    []envAssignment{{"A", "tab\there \"quoted\" back\\slash\nnext"}},
+		},
+		{
+			name:    "double quotes spanning lines",
+			content: "KEY=\"-----BEGIN\nline # not a comment\n-----END\"\nB=2\n",
+			want:    []envAssignment{{"KEY", "-----BEGIN\nline # not a comment\n-----END"}, {"B", "2"}},
+		},
+		{
+			name:    "dotted names",
+			content: "log.level=debug\n",
+			want:    []envAssignment{{"log.level", "debug"}},
+		},
+		{name: "missing equals sign", content: "A=1\nNOPE\n", wantErr: ":2: expected KEY=VALUE"},
+		{name: "invalid name", content: "1A=1\n", wantErr: `invalid variable name "1A"`},
+		{name: "unterminated double quote", content: "A=\"open\nB=2\n", wantErr: ":1: unterminated double quoted value"},
+		{name: "unterminated single quote", content: "A='open\n", wantErr: ":1: unterminated single quoted value"},
+		{name: "text after the closing quote", content: `A="x" y`, wantErr: `unexpected "y" after the closing quote`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), ".env")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseEnvFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseEnvFile() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnvFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// Kinds accepted by `go-npm-run export <kind>`.
+const (
+	exportAliases  = "aliases"
+	exportMarkdown = "markdown"
+)
+
+var exportKinds = []string{exportAliases, exportMarkdown}
+
+// Shells accepted by --shell. bash and zsh share the same output.
+var exportShells = []string{"bash", "zsh", "fish"}
+
+// argsPlaceholder stands in for the forwarded arguments while an exported
+// function is resolved, it is replaced with "$@" or $argv.
+const argsPlaceholder = "\x00args"
+
+// writeExport prints the export opts.export asks for, to the --output
+// file when one is given.
+func writeExport(w io.Writer, opts *options, scripts []discover.NpmScript) error {
+	var file *os.File
+	if opts.exportOutput != "" {
+		var err error
+		if file, err = os.Create(opts.exportOutput); err != nil {
+			return err
+		}
+		w = file
+	}
+	switch opts.export {
+	case exportAliases:
+		writeAliasFunctions(w, opts, scripts)
+	case exportMarkdown:
+		writeMarkdown(w, scripts, opts.searchPath, time.Now())
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
+
+// writeAliasFunctions prints one shell function per script that runs it in
+// its package directory with the arguments passed to the function, e.g.
+// `run-web-dev() { (cd /repo/apps/web && pnpm run dev "$@"); }`.
+func writeAliasFunctions(w io.Writer, opts *options, scripts []discover.NpmScript) {
+	names := functionNames(scripts, opts.prefix, opts.searchPath)
+	fmt.Fprintf(w, "# Generated by go-npm-run export aliases, %d scripts\n", len(scripts))
+	for i, script := range scripts {
+		inv := exportInvocation(script, opts)
+		if opts.shell == "fish" {
+			fmt.Fprintf(w, "function %s\n    pushd %s || return\n    %s\n    set -l code $status\n    popd\n    return $code\nend\n", names[i], fishQuote(inv.Dir), exportCommand(inv, fishQuote, "$argv"))
+			continue
+		}
+		fmt.Fprintf(w, "%s() { (cd %s && %s); }\n", names[i], runner.ShellQuote(inv.Dir), exportCommand(inv, runner.ShellQuote, `"$@"`))
+	}
+}
+
+// exportInvocation resolves script like a run with forwarded arguments,
+// which are left as argsPlaceholder. A script run through the shell gets
+// them as positional parameters instead, since they are quoted into the
+// script body otherwise.
+func exportInvocation(script discover.NpmScript, opts *options) invocation {
+	withArgs := *opts
+	withArgs.scriptArgs = []string{argsPlaceholder}
+	inv := resolveInvocation(script, &withArgs)
+	if inv.Shell != "" {
+		withArgs.scriptArgs = nil
+		inv = resolveInvocation(script, &withArgs)
+		last := len(inv.Args) - 1
+		inv.Args[last] += ` "$@"`
+		inv.Args = append(inv.Args, inv.Name, argsPlaceholder)
+	}
+	if dir, err := filepath.Abs(inv.Dir); err == nil {
+		inv.Dir = dir
+	}
+	return inv
+}
+
+// exportCommand renders the command of inv for a function body, quoting
+// with quote and passing the function arguments as args.
+func exportCommand(inv invocation, quote func(string) string, args string) string {
+	var parts []string
+	if len(inv.Env) > 0 || inv.BinPath != "" {
+		parts = append(parts, "env")
+	}
+	for _, env := range inv.Env {
+		parts = append(parts, quote(env))
+	}
+	if inv.BinPath != "" {
+		parts = append(parts, "PATH="+quote(inv.BinPath)+`:"$PATH"`)
+	}
+	parts = append(parts, quote(inv.Name))
+	for _, arg := range inv.Args {
+		if arg == argsPlaceholder {
+			parts = append(parts, args)
+		} else {
+			parts = append(parts, quote(arg))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// fishQuote quotes s for fish, whose single quotes only know the \' and \\
+// escapes.
+func fishQuote(s string) string {
+	if s != "" && runner.ShellQuote(s) == s {
+		return s
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+var unsafeFunctionChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// functionName makes s usable in a function name, "@scope/ui" becomes
+// "scope-ui" and "build:watch" becomes "build-watch".
+func functionName(s string) string {
+	s = strings.Trim(unsafeFunctionChars.ReplaceAllString(s, "-"), "-")
+	if s == "" {
+		return "root"
+	}
+	return s
+}
+
+// functionNames returns the function name of every script, prefix followed
+// by the package and script name. Names used by more than one script get
+// the package directory relative to root instead of the package name, any
+// still left over a number. Collisions are resolved in the order of the
+// package paths, so the names do not depend on --sort.
+func functionNames(scripts []discover.NpmScript, prefix, root string) []string {
+	order := make([]int, len(scripts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := scripts[order[a]], scripts[order[b]]
+		if sa.AbsolutePath != sb.AbsolutePath {
+			return sa.AbsolutePath < sb.AbsolutePath
+		}
+		return sa.ScriptName < sb.ScriptName
+	})
+
+	names := make([]string, len(scripts))
+	count := map[string]int{}
+	for i, script := range scripts {
+		names[i] = prefix + functionName(script.PackageName) + "-" + functionName(script.ScriptName)
+		count[names[i]]++
+	}
+	absRoot, _ := filepath.Abs(root)
+	for _, i := range order {
+		if count[names[i]] < 2 {
+			continue
+		}
+		script := scripts[i]
+		dir, _ := filepath.Abs(filepath.Dir(script.AbsolutePath))
+		if rel, err := filepath.Rel(absRoot, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			dir = rel
+		}
+		if dir == "." {
+			dir = ""
+		}
+		names[i] = prefix + functionName(filepath.ToSlash(dir)) + "-" + functionName(script.ScriptName)
+	}
+	taken := map[string]bool{}
+	for _, i := range order {
+		name := names[i]
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", names[i], n)
+		}
+		taken[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+// writeMarkdown writes an inventory of scripts: a section per package,
+// headed by its name and directory relative to root, with a table of its
+// scripts, their commands and descriptions. Packages are ordered by path
+// and scripts as declared, whatever --sort says, so that a committed
+// inventory only changes with the scripts, and the footer date.
+func writeMarkdown(w io.Writer, scripts []discover.NpmScript, root string, now time.Time) {
+	sorted := append([]discover.NpmScript(nil), scripts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].AbsolutePath != sorted[j].AbsolutePath {
+			return sorted[i].AbsolutePath < sorted[j].AbsolutePath
+		}
+		return sorted[i].Line < sorted[j].Line
+	})
+
+	fmt.Fprintln(w, "# Scripts")
+	absRoot, _ := filepath.Abs(root)
+	for i := 0; i < len(sorted); {
+		path := sorted[i].AbsolutePath
+		end := i
+		for end < len(sorted) && sorted[end].AbsolutePath == path {
+			end++
+		}
+		dir, _ := filepath.Abs(filepath.Dir(path))
+		if rel, err := filepath.Rel(absRoot, dir); err == nil {
+			dir = filepath.ToSlash(rel)
+		}
+		descriptions := map[string]string{}
+		if pkg, _, err := discover.ReadPackageJSON(path); err == nil {
+			descriptions = scriptDescriptions(pkg)
+		}
+
+		fmt.Fprintf(w, "\n## %s\n\n`%s`\n\n", markdownCell(sorted[i].PackageName), dir)
+		fmt.Fprintln(w, "| Script | Command | Description |")
+		fmt.Fprintln(w, "| ------ | ------- | ----------- |")
+		for _, script := range sorted[i:end] {
+			fmt.Fprintf(w, "| %s | %s | %s |\n", markdownCode(script.ScriptName), markdownCode(script.Command), markdownCell(descriptions[script.ScriptName]))
+		}
+		i = end
+	}
+	fmt.Fprintf(w, "\n---\n\n_Generated by go-npm-run export markdown on %s._\n", now.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+// scriptDescriptions returns the script descriptions of a parsed
+// package.json, from the "scripts-info" object of npm-scripts-info or the
+// "ntl.descriptions" object of ntl. The former wins when both describe a
+// script.
+func scriptDescriptions(pkg map[string]any) map[string]string {
+	descriptions := map[string]string{}
+	add := func(v any) {
+		m, _ := v.(map[string]any)
+		for name, description := range m {
+			if text, ok := description.(string); ok {
+				descriptions[name] = text
+			}
+		}
+	}
+	if ntl, ok := pkg["ntl"].(map[string]any); ok {
+		add(ntl["descriptions"])
+	}
+	add(pkg["scripts-info"])
+	return descriptions
+}
+
+// markdownCell keeps s inside one table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>").Replace(s)
+}
+
+// markdownCode formats s as inline code in a table cell, with a longer
+// fence when s contains backticks.
+func markdownCode(s string) string {
+	s = markdownCell(s)
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.Contains(s, "`") {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// onlyScripts keeps the scripts matched by any of globs. unmatched lists
+// the globs that matched no script at all.
+func onlyScripts(scripts []discover.NpmScript, globs []string) (kept []discover.NpmScript, unmatched []string) {
+	matched := make([]bool, len(globs))
+	for _, script := range scripts {
+		keep := false
+		for i, glob := range globs {
+			if discover.MatchScriptGlob(glob, script) {
+				matched[i] = true
+				keep = true
+			}
+		}
+		if keep {
+			kept = append(kept, script)
+		}
+	}
+	for i, glob := range globs {
+		if !matched[i] {
+			debugf("--only %q matches no script", glob)
+			unmatched = append(unmatched, glob)
+		}
+	}
+	return kept, unmatched
+}
+
+// visibleScripts drops the scripts hidden by their package.json.
+func visibleScripts(scripts []discover.NpmScript) []discover.NpmScript {
+	var kept []discover.NpmScript
+	for _, script := range scripts {
+		if script.Hidden {
+			debugf("hiding %s: listed in the hide globs of %s", script.Label(), script.AbsolutePath)
+			continue
+		}
+		kept = append(kept, script)
+	}
+	return kept
+}
+
+// excludeScripts drops the scripts matched by any of globs.
+func excludeScripts(scripts []discover.NpmScript, globs []string) []discover.NpmScript {
+	if len(globs) == 0 {
+		return scripts
+	}
+	var kept []discover.NpmScript
+	for _, script := range scripts {
+		excluded := false
+		for _, glob := range globs {
+			if discover.MatchScriptGlob(glob, script) {
+				excluded = true
+				debugf("excluding %s: matches %q", script.Label(), glob)
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, script)
+		}
+	}
+	return kept
+}
+
+// scopeScripts keeps the scripts of packages in any of scopes, given with
+// or without the leading "@".
+func scopeScripts(scripts []discover.NpmScript, scopes []string) []discover.NpmScript {
+	var kept []discover.NpmScript
+	for _, script := range scripts {
+		scope, _ := splitScope(script.PackageName)
+		for _, want := range scopes {
+			if scope != "" && scope == "@"+strings.TrimPrefix(want, "@") {
+				kept = append(kept, script)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// splitScope splits a scoped package name like "@acme/web" into "@acme"
+// and "web". Unscoped names have no scope.
+func splitScope(name string) (scope, short string) {
+	if !strings.HasPrefix(name, "@") {
+		return "", name
+	}
+	scope, short, ok := strings.Cut(name, "/")
+	if !ok || short == "" {
+		return "", name
+	}
+	return scope, short
+}
+
+// excludePackages drops the scripts of packages whose name or directory
+// relative to root matches any of globs, like --exclude matches scripts.
+func excludePackages(scripts []discover.NpmScript, globs []string, root string) []discover.NpmScript {
+	if len(globs) == 0 {
+		return scripts
+	}
+	matchers := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		if matcher, err := discover.GlobRegexp(glob); err == nil {
+			matchers = append(matchers, matcher)
+		}
+	}
+	absRoot, _ := filepath.Abs(root)
+	excluded := map[string]string{}
+	var kept []discover.NpmScript
+	for _, script := range scripts {
+		glob, seen := excluded[script.AbsolutePath]
+		if !seen {
+			dir, _ := filepath.Abs(filepath.Dir(script.AbsolutePath))
+			if rel, err := filepath.Rel(absRoot, dir); err == nil {
+				dir = filepath.ToSlash(rel)
+			}
+			for i, matcher := range matchers {
+				if matcher.MatchString(script.PackageName) || matcher.MatchString(dir) {
+					glob = globs[i]
+					break
+				}
+			}
+			excluded[script.AbsolutePath] = glob
+		}
+		if glob == "" {
+			kept = append(kept, script)
+		}
+	}
+	counts := map[string]int{}
+	for _, glob := range excluded {
+		if glob != "" {
+			counts[glob]++
+		}
+	}
+	for _, glob := range globs {
+		if counts[glob] > 0 {
+			debugf("--exclude-package %q excludes %d packages", glob, counts[glob])
+		}
+	}
+	return kept
+}
+
+// workspaceScripts keeps the scripts of the package at root and of the
+// packages that are or belong to declared workspaces, dropping the ones
+// the directory walk found on its own.
+func workspaceScripts(scripts []discover.NpmScript, root string) []discover.NpmScript {
+	absRoot, _ := filepath.Abs(root)
+	skipped := map[string]bool{}
+	var kept []discover.NpmScript
+	for _, script := range scripts {
+		dir, _ := filepath.Abs(filepath.Dir(script.AbsolutePath))
+		if script.Source != discover.SourceWalk || dir == absRoot {
+			kept = append(kept, script)
+		} else if !skipped[script.AbsolutePath] {
+			skipped[script.AbsolutePath] = true
+			debugf("--workspaces-only: skipping %s, not part of a workspace", script.AbsolutePath)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// Finders accepted by --finder.
+const (
+	finderBuiltin = "builtin"
+	finderFzf     = "fzf"
+)
+
+var finders = []string{finderBuiltin, finderFzf}
+
+// What the picker query matches with --search: the package and script
+// name, or those and the script command.
+const (
+	searchName    = "name"
+	searchCommand = "command"
+)
+
+var searchModes = []string{searchName, searchCommand}
+
+// Case sensitivities accepted by --case. smart ignores case unless the
+// query has an uppercase letter, the default of both finders.
+const (
+	caseSmart   = "smart"
+	caseIgnore  = "ignore"
+	caseRespect = "respect"
+)
+
+var caseModes = []string{caseSmart, caseIgnore, caseRespect}
+
+// pickerItem is one entry offered by a finder.
+type pickerItem struct {
+	label   string
+	preview string
+	// ansiLabel is label with ANSI styling for finders that render it,
+	// empty when it has none.
+	ansiLabel string
+}
+
+// pickerAction is a key binding that acts on the highlighted item while the
+// picker stays open. run returns a status message for the picker header.
+// Both finders close on the key, run the action and open again.
+type pickerAction struct {
+	key  string
+	help string
+	run  func(i int) string
+	// anyItem actions also run when nothing matches the query, with i -1.
+	anyItem bool
+}
+
+// pickerInfo is the pickerHeader line the pickers show above the list, set
+// before picking.
+var pickerInfo string
+
+// pickerWidth is the width the list of the picker gets, the built-in
+// finder gives half of the terminal to the preview pane and indents the
+// header by two columns.
+func pickerWidth(opts *options) int {
+	width := terminalWidth()
+	if opts.finder == finderBuiltin && !usePlain(opts) && !opts.noPreview {
+		width /= 2
+	}
+	return width - 2
+}
+
+// uncopied collects texts the clipboard keybindings failed to copy, they
+// are printed once the picker closes instead.
+var uncopied []string
+
+// pick lets the user choose one of scripts and returns its index. query
+// pre-fills the prompt. fuzzyfinder.ErrAbort is returned when nothing was
+// chosen, regardless of the finder in use.
+func pick(opts *options, scripts []discover.NpmScript, query string) (int, error) {
+	defer func() {
+		for _, text := range uncopied {
+			fmt.Fprintf(os.Stderr, "Could not copy to the clipboard: %s\n", text)
+		}
+		uncopied = nil
+	}()
+
+	if opts.byPackage {
+		return pickByPackage(opts, scripts, query)
+	}
+	items := scriptItems(opts, scripts)
+	return pickItem(opts, items, query, scriptActions(opts, scripts, items))
+}
+
+// scriptActions are the key bindings available in a script picker. Actions
+// that change a script update both scripts and the matching items.
+func scriptActions(opts *options, scripts []discover.NpmScript, items []pickerItem) []pickerAction {
+	copyText := func(text string) string {
+		if err := copyToClipboard(text); err != nil {
+			uncopied = append(uncopied, text)
+			return "Clipboard unavailable, the text is printed on exit"
+		}
+		return "Copied: " + text
+	}
+
+	return []pickerAction{
+		{
+			key:  "ctrl-y",
+			help: "copy command",
+			run: func(i int) string {
+				return copyText(resolveInvocation(scripts[i], opts).CommandLine())
+			},
+		},
+		{
+			key:  "alt-y",
+			help: "copy script body",
+			run: func(i int) string {
+				return copyText(scripts[i].Command)
+			},
+		},
+		{
+			key:  "alt-c",
+			help: "toggle command search",
+			run: func(i int) string {
+				if opts.search == searchCommand {
+					opts.search = searchName
+				} else {
+					opts.search = searchCommand
+				}
+				copy(items, scriptItems(opts, scripts))
+				if opts.search == searchCommand {
+					return "Searching script names and commands"
+				}
+				return "Searching script names"
+			},
+		},
+		{
+			key:     "ctrl-o",
+			help:    "cycle sort",
+			anyItem: true,
+			run: func(int) string {
+				opts.sort = nextSort(opts.sort)
+				sortScripts(scripts, opts.sort, loadHistory())
+				copy(items, scriptItems(opts, scripts))
+				mode := opts.sort
+				savePickerState(func(state *pickerState) { state.Sort = mode })
+				return "Sort: " + opts.sort
+			},
+		},
+		{
+			key:  "ctrl-e",
+			help: "edit in $EDITOR",
+			run: func(i int) string {
+				if err := openInEditor(scripts[i].AbsolutePath, scripts[i].Line); err != nil {
+					return "Error: " + err.Error()
+				}
+				refreshed, err := refreshScript(scripts[i])
+				if err != nil {
+					return fmt.Sprintf("%s: %v", scripts[i].ScriptName, err)
+				}
+				scripts[i] = refreshed
+				items[i] = scriptItems(opts, scripts[i:i+1])[0]
+				return "Reloaded " + scripts[i].AbsolutePath
+			},
+		},
+	}
+}
+
+// scriptItems returns the picker items of scripts. With --search command
+// the label ends with the command on one line, dimmed with fzf, for the
+// query to match it; the finder cuts it at the window edge.
+func scriptItems(opts *options, scripts []discover.NpmScript) []pickerItem {
+	items := make([]pickerItem, len(scripts))
+	for i, script := range scripts {
+		item := packageLabel(opts, script, fmt.Sprintf(" > (%s)", script.ScriptName))
+		if incompatible(opts, script) {
+			badge := "  ⚠ " + script.Incompatible
+			if item.ansiLabel == "" {
+				item.ansiLabel = item.label
+			}
+			item.label += badge
+			item.ansiLabel += "\x1b[33m" + badge + "\x1b[0m"
+		}
+		if opts.search == searchCommand {
+			command := "  " + strings.Join(strings.Fields(script.Command), " ")
+			if item.ansiLabel == "" {
+				item.ansiLabel = item.label
+			}
+			item.label += command
+			item.ansiLabel += "\x1b[2m" + command + "\x1b[0m"
+		}
+		item.preview = scriptPreview(script)
+		items[i] = item
+	}
+	return items
+}
+
+// packageLabel labels the package of script followed by rest, the package
+// version appended to its name unless --no-versions is set. fzf shows the
+// version dimmed. With --short-names the scope moves to the end of the
+// label, where the fuzzy matcher still finds "acme" of "@acme/web".
+func packageLabel(opts *options, script discover.NpmScript, rest string) pickerItem {
+	name, scope := script.PackageName, ""
+	if opts.shortNames {
+		if s, short := splitScope(name); s != "" {
+			name, scope = short, "  "+s
+		}
+	}
+	if opts.noVersions || script.PackageVersion == "" {
+		return pickerItem{label: name + rest + scope}
+	}
+	version := "@" + script.PackageVersion
+	return pickerItem{
+		label:     name + version + rest + scope,
+		ansiLabel: name + "\x1b[2m" + version + "\x1b[0m" + rest + scope,
+	}
+}
+
+// scriptPreview is the preview pane content for script, ending with the
+// outcome of its last run when the history has one.
+func scriptPreview(script discover.NpmScript) string {
+	location := script.AbsolutePath
+	if script.PackageManager != "" {
+		location += " (" + script.PackageManager + ")"
+	}
+	name := script.PackageName
+	if script.PackageVersion != "" {
+		name += " " + script.PackageVersion
+	}
+	preview := fmt.Sprintf("%s\n%s\n\n$ %s", name, location, script.Command)
+	if script.Implicit {
+		preview += "\n\n(npm's default start, not declared in package.json)"
+	}
+	if script.Hidden {
+		preview += "\n\n(hidden by the \"go-npm-run\" hide list of package.json)"
+	}
+	if script.Incompatible != "" {
+		preview += "\n\n⚠ " + platformNote(script)
+	}
+	if entry, ok := lastOutcome(script); ok {
+		preview += "\n\nlast run: " + describeOutcome(entry)
+	}
+	return preview
+}
+
+// pickByPackage picks a package first and then one of its scripts. Aborting
+// the script picker returns to the package picker instead of quitting.
+func pickByPackage(opts *options, scripts []discover.NpmScript, query string) (int, error) {
+	var packages [][]int
+	var packageItems []pickerItem
+	byPath := map[string]int{}
+	for i, script := range scripts {
+		p, ok := byPath[script.AbsolutePath]
+		if !ok {
+			p = len(packages)
+			byPath[script.AbsolutePath] = p
+			packages = append(packages, nil)
+		}
+		packages[p] = append(packages[p], i)
+	}
+	for _, indices := range packages {
+		first := scripts[indices[0]]
+		var names []string
+		for _, i := range indices {
+			names = append(names, scripts[i].ScriptName)
+		}
+		item := packageLabel(opts, first, fmt.Sprintf(" (%d scripts)", len(indices)))
+		item.preview = fmt.Sprintf("%s\n%s\n\n%s", first.PackageName, first.AbsolutePath, strings.Join(names, "\n"))
+		packageItems = append(packageItems, item)
+	}
+
+	for {
+		p, err := pickItem(opts, packageItems, "", nil)
+		if err != nil {
+			return -1, err
+		}
+
+		indices := packages[p]
+		subset := make([]discover.NpmScript, len(indices))
+		for i, idx := range indices {
+			subset[i] = scripts[idx]
+		}
+		items := scriptItems(opts, subset)
+		s, err := pickItem(opts, items, query, scriptActions(opts, subset, items))
+		// Keep edits made from the picker
+		for i, idx := range indices {
+			scripts[idx] = subset[i]
+		}
+		if errors.Is(err, fuzzyfinder.ErrAbort) {
+			continue
+		}
+		if err != nil {
+			return -1, err
+		}
+		return indices[s], nil
+	}
+}
+
+// finderActions are the key bindings changing how the query matches and
+// what the picker shows, they apply to every picker.
+func finderActions(opts *options) []pickerAction {
+	return []pickerAction{
+		{
+			key:     "alt-e",
+			help:    "toggle exact",
+			anyItem: true,
+			run: func(int) string {
+				opts.exact = !opts.exact
+				if opts.exact {
+					return "Exact matching"
+				}
+				return "Fuzzy matching"
+			},
+		},
+		{
+			key:     "alt-i",
+			help:    "cycle case",
+			anyItem: true,
+			run: func(int) string {
+				for i, mode := range caseModes {
+					if mode == opts.caseMode {
+						opts.caseMode = caseModes[(i+1)%len(caseModes)]
+						break
+					}
+				}
+				return "Case: " + opts.caseMode
+			},
+		},
+		{
+			key:     "alt-p",
+			help:    "toggle preview",
+			anyItem: true,
+			run: func(int) string {
+				opts.noPreview = !opts.noPreview
+				preview := !opts.noPreview
+				savePickerState(func(state *pickerState) { state.Preview = &preview })
+				if preview {
+					return "Preview on"
+				}
+				return "Preview off"
+			},
+		},
+	}
+}
+
+// writeKeysUsage writes the --help section listing the key bindings of
+// scriptActions and finderActions.
+func writeKeysUsage(w io.Writer) {
+	fmt.Fprint(w, "\nPicker keys:\n")
+	for _, action := range append(scriptActions(&options{}, nil, nil), finderActions(&options{})...) {
+		fmt.Fprintf(w, "  %-8s %s\n", action.key, action.help)
+	}
+}
+
+// pickItem runs the configured finder over items and returns the chosen
+// index. The plain menu stands in for a built-in finder that cannot start.
+func pickItem(opts *options, items []pickerItem, query string, actions []pickerAction) (int, error) {
+	if usePlain(opts) {
+		return pickPlain(os.Stdin, os.Stderr, items, query)
+	}
+	actions = append(append([]pickerAction(nil), actions...), finderActions(opts)...)
+	if opts.finder == finderFzf {
+		idx, err := pickWithFzf(opts, items, query, actions)
+		if err == nil || errors.Is(err, fuzzyfinder.ErrAbort) {
+			return idx, err
+		}
+		warnf("%v, falling back to the built-in finder", err)
+	}
+
+	idx, err := pickWithBuiltin(opts, items, query, actions)
+	if err != nil && !errors.Is(err, fuzzyfinder.ErrAbort) {
+		warnf("cannot open the picker: %v, falling back to the plain menu", err)
+		return pickPlain(os.Stdin, os.Stderr, items, query)
+	}
+	return idx, err
+}
+
+// actionHeader returns the keys of actions and the header line listing
+// them below pickerInfo.
+func actionHeader(actions []pickerAction) ([]string, string) {
+	var keys, keyHelp []string
+	for _, action := range actions {
+		keys = append(keys, action.key)
+		keyHelp = append(keyHelp, action.key+": "+action.help)
+	}
+	keyLine := strings.Join(keyHelp, ", ")
+	if pickerInfo != "" {
+		keyLine = strings.TrimSuffix(pickerInfo+"\n"+keyLine, "\n")
+	}
+	return keys, keyLine
+}
+
+// pickWithBuiltin runs the built-in finder over items. Like pickWithFzf it
+// closes when an action key is pressed, runs the action and opens again
+// with the same query, the cursor on the item it was on and the action's
+// message in the header.
+func pickWithBuiltin(opts *options, items []pickerItem, query string, actions []pickerAction) (int, error) {
+	keys, keyLine := actionHeader(actions)
+	header := keyLine
+	cursor := -1
+	for {
+		var preview func(i, width, height int) string
+		if !opts.noPreview {
+			preview = func(i, width, height int) string {
+				if i == -1 {
+					return ""
+				}
+				return items[i].preview
+			}
+		}
+		result, err := pickBuiltin(&items, builtinOptions{
+			header:   header,
+			query:    query,
+			caseMode: opts.caseMode,
+			exact:    opts.exact,
+			cursor:   cursor,
+			preview:  preview,
+			keys:     keys,
+		})
+		if err != nil {
+			return -1, err
+		}
+		action := findAction(actions, result.key)
+		if action == nil {
+			return result.idx, nil
+		}
+		query, cursor = result.query, result.idx
+		if result.idx == -1 {
+			// A key pressed without a match, like toggling exact matching
+			// off again
+			if action.anyItem {
+				header = action.run(-1) + "\n" + keyLine
+			}
+			continue
+		}
+		highlighted := items[result.idx]
+		header = action.run(result.idx) + "\n" + keyLine
+		cursor = followItem(items, highlighted, result.idx)
+	}
+}
+
+// fzfEscaper encodes preview text for printf %b, keeping it on one line.
+var fzfEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`)
+
+// pickWithFzf pipes the items to an external fzf. Every line starts with a
+// hidden index column so the selection maps back to items unambiguously.
+//
+// Action keys are passed to --expect: fzf exits when one is pressed, the
+// action runs and fzf is started again with the same query, the cursor on
+// the item it was on and the action's message in the header, which looks
+// like the picker never closed. The matching and preview flags are rebuilt
+// every round too, for finderActions.
+func pickWithFzf(opts *options, items []pickerItem, query string, actions []pickerAction) (int, error) {
+	fzfPath, err := exec.LookPath("fzf")
+	if err != nil {
+		return -1, errors.New("fzf not found in PATH")
+	}
+
+	keys, keyLine := actionHeader(actions)
+	header := keyLine
+	// cursor is the item to highlight when fzf starts again, -1 for the top
+	cursor := -1
+	canPos := fzfAtLeast(fzfPath, 0, 36)
+
+	for {
+		// Rebuilt every round, actions may have changed the items
+		var input bytes.Buffer
+		ansi := false
+		for i, item := range items {
+			label := item.label
+			if item.ansiLabel != "" {
+				label, ansi = item.ansiLabel, true
+			}
+			fmt.Fprintf(&input, "%d\t%s\t%s\n", i, label, fzfEscaper.Replace(item.preview))
+		}
+
+		args := fzfMatchArgs(opts, ansi)
+		if cursor >= 0 && canPos {
+			if pos := fzfPosition(fzfPath, args, input.Bytes(), query, cursor); pos > 0 {
+				args = append(args, "--bind", fmt.Sprintf("load:pos(%d)", pos))
+			}
+		}
+		if !opts.noPreview {
+			args = append(args, "--preview", `printf '%b\n' {3}`, "--preview-window", "down:5:wrap")
+		}
+		if query != "" {
+			args = append(args, "--query", query)
+		}
+		if len(actions) > 0 {
+			args = append(args, "--expect", strings.Join(keys, ","), "--print-query")
+		}
+		if header != "" {
+			args = append(args, "--header", header)
+		}
+
+		cmd := exec.Command(fzfPath, args...)
+		cmd.Stdin = &input
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		noMatch := false
+		if err != nil {
+			var exitError *exec.ExitError
+			// 1 means no match, 130 means the user hit Esc or Ctrl-C
+			if !errors.As(err, &exitError) || (exitError.ExitCode() != 1 && exitError.ExitCode() != 130) {
+				return -1, fmt.Errorf("fzf failed: %w", err)
+			}
+			noMatch = exitError.ExitCode() == 1
+		}
+
+		lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+		key := ""
+		if len(actions) > 0 && len(lines) >= 2 {
+			query, key, lines = lines[0], lines[1], lines[2:]
+		}
+		if action := findAction(actions, key); noMatch && action != nil && action.anyItem {
+			// A key pressed without a match, like toggling exact matching
+			// off again
+			header = action.run(-1) + "\n" + keyLine
+			cursor = -1
+			continue
+		}
+		if err != nil {
+			return -1, fuzzyfinder.ErrAbort
+		}
+		if len(lines) == 0 {
+			return -1, fmt.Errorf("unexpected fzf output %q", out)
+		}
+
+		idx, err := strconv.Atoi(strings.SplitN(lines[0], "\t", 2)[0])
+		if err != nil || idx < 0 || idx >= len(items) {
+			return -1, fmt.Errorf("unexpected fzf output %q", lines[0])
+		}
+
+		action := findAction(actions, key)
+		if action == nil {
+			return idx, nil
+		}
+		highlighted := items[idx]
+		header = action.run(idx) + "\n" + keyLine
+		cursor = followItem(items, highlighted, idx)
+	}
+}
+
+// followItem returns where the item highlighted at idx went after an
+// action: actions that reorder the items keep them unchanged otherwise,
+// the others keep the order.
+func followItem(items []pickerItem, highlighted pickerItem, idx int) int {
+	for i, item := range items {
+		if item == highlighted {
+			return i
+		}
+	}
+	return idx
+}
+
+// fzfMatchArgs are the fzf flags deciding which lines match a query and
+// in what order: the input format and --exact and --case.
+func fzfMatchArgs(opts *options, ansi bool) []string {
+	args := []string{"--delimiter", "\t", "--with-nth", "2"}
+	if ansi {
+		args = append(args, "--ansi")
+	}
+	if opts.exact {
+		args = append(args, "--exact")
+	}
+	switch opts.caseMode {
+	case caseIgnore:
+		args = append(args, "-i")
+	case caseRespect:
+		args = append(args, "+i")
+	}
+	return args
+}
+
+// fzfPosition returns the 1-based position of item idx of input in the
+// list fzf shows for query, which fzf --filter prints in the same order,
+// or 0 when it does not match.
+func fzfPosition(fzfPath string, matchArgs []string, input []byte, query string, idx int) int {
+	if query == "" {
+		return idx + 1
+	}
+	cmd := exec.Command(fzfPath, append(append([]string(nil), matchArgs...), "--filter", query)...)
+	cmd.Stdin = bytes.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0
+	}
+	prefix := strconv.Itoa(idx) + "\t"
+	for i, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// fzfAtLeast reports whether fzf --version is major.minor or newer. The
+// load event and pos action restoring the cursor need 0.36.
+func fzfAtLeast(fzfPath string, major, minor int) bool {
+	out, err := exec.Command(fzfPath, "--version").Output()
+	if err != nil {
+		return false
+	}
+	fields := strings.SplitN(strings.TrimSpace(string(out)), ".", 3)
+	if len(fields) < 2 {
+		return false
+	}
+	gotMajor, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+	gotMinor, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return false
+	}
+	return gotMajor > major || gotMajor == major && gotMinor >= minor
+}
+
+func findAction(actions []pickerAction, key string) *pickerAction {
+	for i := range actions {
+		if actions[i].key == key && key != "" {
+			return &actions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestFzfPosition checks where the cursor goes when fzf reopens after an
+// action, against a stub fzf whose --filter ranks the lines in reverse.
+func TestFzfPosition(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub is written for sh")
+	}
+	fzfPath := filepath.Join(t.TempDir(), "fzf")
+	stub := `#!/bin/sh
+case "$*" in
+*--version*) echo "0.36.0 (brew)" ;;
+*--filter*) grep -v '^1	' | sort -r ;;
+esac
+`
+	if err := os.WriteFile(fzfPath, []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	input := []byte("0\ta > (build)\t\n1\ta > (test)\t\n2\tb > (build)\t\n")
+
+	tests := []struct {
+		name  string
+		query string
+		idx   int
+		want  int
+	}{
+		{"no query keeps the input order", "", 1, 2},
+		{"query ranks by match", "build", 0, 2},
+		{"ranked first", "build", 2, 1},
+		{"no longer matching", "build", 1, 0},
+	}
+	for _, tt := range tests {
+		if got := fzfPosition(fzfPath, nil, input, tt.query, tt.idx); got != tt.want {
+			t.Errorf("%s: fzfPosition(%q, %d) = %d, want %d", tt.name, tt.query, tt.idx, got, tt.want)
+		}
+	}
+
+	if !fzfAtLeast(fzfPath, 0, 36) {
+		t.Error("fzfAtLeast(0.36) = false for 0.36.0")
+	}
+	if fzfAtLeast(fzfPath, 0, 40) {
+		t.Error("fzfAtLeast(0.40) = true for 0.36.0")
+	}
+}
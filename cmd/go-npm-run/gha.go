@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// githubActions reports whether go-npm-run runs in a GitHub Actions job,
+// where --gha is on unless turned off.
+func githubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// ghaData escapes the message of a workflow command.
+var ghaData = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// ghaProperty escapes a property value of a workflow command, like the
+// title of an annotation.
+var ghaProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// ghaGroup starts a collapsible group of log lines titled title, the
+// next ghaEndGroup ends it.
+func ghaGroup(w io.Writer, title string) {
+	fmt.Fprintf(w, "::group::%s\n", ghaData.Replace(title))
+}
+
+// ghaEndGroup ends the group on a line of its own, after output that
+// did not end with a newline too.
+func ghaEndGroup(w *lineEndWriter) {
+	if !w.ended {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "::endgroup::")
+}
+
+// lineEndWriter passes writes on to w and remembers whether the last one
+// ended a line.
+type lineEndWriter struct {
+	w     io.Writer
+	ended bool
+}
+
+func (l *lineEndWriter) Write(data []byte) (int, error) {
+	if len(data) > 0 {
+		l.ended = data[len(data)-1] == '\n'
+	}
+	return l.w.Write(data)
+}
+
+// ghaAnnotations writes an error annotation for every failed run, like
+// `::error title=web test failed::exit code 1 (2m13s)`.
+func ghaAnnotations(w io.Writer, results []allResult) {
+	for _, r := range results {
+		if !r.failed() || r.skipped() {
+			continue
+		}
+		script := r.inv.Script
+		title := fmt.Sprintf("%s %s failed", script.PackageName, script.ScriptName)
+		reason := fmt.Sprintf("exit code %d", r.code)
+		switch {
+		case r.interrupted:
+			reason = "interrupted"
+		case r.err != nil:
+			reason = r.err.Error()
+		}
+		duration := r.duration.Round(100 * time.Millisecond)
+		if r.duration >= time.Minute {
+			duration = r.duration.Round(time.Second)
+		}
+		fmt.Fprintf(w, "::error title=%s::%s (%s)\n", ghaProperty.Replace(title), ghaData.Replace(reason), duration)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// Orders accepted by --order.
+const (
+	orderFlat = "flat"
+	orderTopo = "topo"
+)
+
+var orders = []string{orderFlat, orderTopo}
+
+// dependencyFields are the package.json fields that link workspace packages.
+var dependencyFields = []string{"dependencies", "devDependencies", "peerDependencies", "optionalDependencies"}
+
+// workspaceGraph maps every package.json path found in scripts to the paths
+// of the discovered packages it depends on.
+func workspaceGraph(scripts []discover.NpmScript) map[string][]string {
+	byName := map[string]string{}
+	var paths []string
+	for _, script := range scripts {
+		if _, ok := byName[script.PackageName]; !ok {
+			byName[script.PackageName] = script.AbsolutePath
+			paths = append(paths, script.AbsolutePath)
+		}
+	}
+
+	graph := map[string][]string{}
+	for _, path := range paths {
+		data, _, err := discover.ReadPackageJSON(path)
+		if err != nil {
+			debugf("cannot read dependencies of %s: %v", path, err)
+			continue
+		}
+		seen := map[string]bool{}
+		for _, field := range dependencyFields {
+			deps, _ := data[field].(map[string]any)
+			for name := range deps {
+				dep, ok := byName[name]
+				if ok && dep != path && !seen[dep] {
+					seen[dep] = true
+					graph[path] = append(graph[path], dep)
+				}
+			}
+		}
+		// Map iteration order is random, keep cycle reports stable
+		sort.Strings(graph[path])
+	}
+	return graph
+}
+
+// targetDependencies restricts graph to targets: a target depends on every
+// target reachable from it, also through packages that are not targets.
+func targetDependencies(targets []string, graph map[string][]string) map[string][]string {
+	isTarget := map[string]bool{}
+	for _, target := range targets {
+		isTarget[target] = true
+	}
+
+	deps := map[string][]string{}
+	for _, target := range targets {
+		visited := map[string]bool{target: true}
+		queue := append([]string(nil), graph[target]...)
+		for len(queue) > 0 {
+			path := queue[0]
+			queue = queue[1:]
+			if visited[path] {
+				continue
+			}
+			visited[path] = true
+			if isTarget[path] {
+				deps[target] = append(deps[target], path)
+				continue
+			}
+			queue = append(queue, graph[path]...)
+		}
+	}
+	return deps
+}
+
+// topoOrder sorts targets so that every package comes after its
+// dependencies. Among packages that are ready at the same time the input
+// order is kept. A dependency cycle is reported with the package names.
+func topoOrder(targets []string, deps map[string][]string, names map[string]string) ([]string, error) {
+	done := map[string]bool{}
+	var ordered []string
+	for len(ordered) < len(targets) {
+		progressed := false
+		for _, target := range targets {
+			if done[target] || !allDone(deps[target], done) {
+				continue
+			}
+			done[target] = true
+			ordered = append(ordered, target)
+			progressed = true
+			// Rescan from the start so earlier packages keep precedence
+			break
+		}
+		if !progressed {
+			return nil, fmt.Errorf("dependency cycle: %s", strings.Join(findCycle(targets, deps, done, names), " -> "))
+		}
+	}
+	return ordered, nil
+}
+
+func allDone(paths []string, done map[string]bool) bool {
+	for _, path := range paths {
+		if !done[path] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle returns the package names along one cycle among the targets
+// that are not done yet, starting and ending with the same name.
+func findCycle(targets []string, deps map[string][]string, done map[string]bool, names map[string]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		finished
+	)
+	state := map[string]int{}
+	var stack []string
+	var cycle []string
+
+	var visit func(path string) bool
+	visit = func(path string) bool {
+		state[path] = visiting
+		stack = append(stack, path)
+		for _, dep := range deps[path] {
+			if done[dep] {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				for i, p := range stack {
+					if p == dep {
+						for _, p := range stack[i:] {
+							cycle = append(cycle, names[p])
+						}
+						cycle = append(cycle, names[dep])
+						return true
+					}
+				}
+			case unvisited:
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[path] = finished
+		return false
+	}
+
+	for _, target := range targets {
+		if !done[target] && state[target] == unvisited && visit(target) {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// dependencyScripts returns the scripts called name of the packages among
+// scripts that the package of script depends on, directly or through other
+// packages, each after those of its own dependencies. Packages without the
+// script are skipped, but not the packages they depend on.
+func dependencyScripts(script discover.NpmScript, scripts []discover.NpmScript, name string) ([]discover.NpmScript, error) {
+	target := script.AbsolutePath
+	byPath := map[string]discover.NpmScript{}
+	names := map[string]string{}
+	for _, s := range scripts {
+		names[s.AbsolutePath] = s.PackageName
+		if s.ScriptName == name {
+			byPath[s.AbsolutePath] = s
+		}
+	}
+
+	graph := workspaceGraph(scripts)
+	visited := map[string]bool{target: true}
+	queue := append([]string(nil), graph[target]...)
+	var targets []string
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if visited[path] {
+			continue
+		}
+		visited[path] = true
+		if _, ok := byPath[path]; ok {
+			targets = append(targets, path)
+		} else {
+			debugf("--with-deps: %s has no %q script", path, name)
+		}
+		queue = append(queue, graph[path]...)
+	}
+	sort.Strings(targets)
+
+	ordered, err := topoOrder(targets, targetDependencies(targets, graph), names)
+	if err != nil {
+		return nil, err
+	}
+	deps := make([]discover.NpmScript, len(ordered))
+	for i, path := range ordered {
+		deps[i] = byPath[path]
+	}
+	return deps, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// maxHistoryEntries bounds the history file, older runs are dropped.
+const maxHistoryEntries = 1000
+
+// historyEntry is one recorded run. Package is the absolute path of the
+// package.json the script belongs to.
+type historyEntry struct {
+	Package string   `json:"package"`
+	Script  string   `json:"script"`
+	Args    []string `json:"args,omitempty"`
+	// Values are the placeholder answers given for the run.
+	Values map[string]string `json:"values,omitempty"`
+	Time   time.Time         `json:"time"`
+	// DurationMS and ExitCode are filled in once the run finished. They
+	// stay empty for --watch, --restart and --exec runs.
+	DurationMS int64 `json:"durationMs,omitempty"`
+	ExitCode   *int  `json:"exitCode,omitempty"`
+}
+
+// finished reports whether the outcome of the run was recorded.
+func (e historyEntry) finished() bool {
+	return e.ExitCode != nil
+}
+
+// historyMu serializes the updates of the history file by parallel runs.
+var historyMu sync.Mutex
+
+func historyPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-npm-run", "history.jsonl"), nil
+}
+
+// loadHistory returns the recorded runs, oldest first. A missing or
+// unreadable history is treated as empty, malformed lines are skipped.
+func loadHistory() []historyEntry {
+	path, err := historyPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// recordHistory appends a run of script to the history file and returns
+// the entry, for completeHistory once the run finished.
+func recordHistory(script discover.NpmScript, args []string, values map[string]string) (historyEntry, error) {
+	packagePath, err := filepath.Abs(script.AbsolutePath)
+	if err != nil {
+		return historyEntry{}, err
+	}
+	entry := historyEntry{
+		Package: packagePath,
+		Script:  script.ScriptName,
+		Args:    args,
+		Values:  values,
+		Time:    time.Now(),
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	return entry, writeHistory(append(loadHistory(), entry))
+}
+
+// completeHistory records the duration and exit code of r in the history
+// entry of the run.
+func completeHistory(entry historyEntry, r allResult) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	entries := loadHistory()
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := &entries[i]
+		if e.Package != entry.Package || e.Script != entry.Script || !e.Time.Equal(entry.Time) {
+			continue
+		}
+		code := r.code
+		if r.err != nil && code == 0 {
+			code = exitFailure
+		}
+		e.DurationMS, e.ExitCode = r.duration.Milliseconds(), &code
+		return writeHistory(entries)
+	}
+	return nil
+}
+
+// writeHistory replaces the history file with entries, keeping the newest
+// maxHistoryEntries.
+func writeHistory(entries []historyEntry) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never truncates the history
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// finishedRuns maps "package.json path\x00script" to the latest run whose
+// outcome was recorded.
+func finishedRuns(entries []historyEntry) map[string]historyEntry {
+	runs := map[string]historyEntry{}
+	for _, entry := range entries {
+		key := historyKey(entry.Package, entry.Script)
+		if entry.finished() && !entry.Time.Before(runs[key].Time) {
+			runs[key] = entry
+		}
+	}
+	return runs
+}
+
+// lastOutcomes holds the finishedRuns of the history for lastOutcome.
+var lastOutcomes map[string]historyEntry
+
+// lastOutcome returns the latest recorded outcome of script.
+func lastOutcome(script discover.NpmScript) (historyEntry, bool) {
+	path, err := filepath.Abs(script.AbsolutePath)
+	if err != nil {
+		return historyEntry{}, false
+	}
+	entry, ok := lastOutcomes[historyKey(path, script.ScriptName)]
+	return entry, ok
+}
+
+// describeOutcome summarizes a finished run, e.g. "~2m10s, exit code 1".
+func describeOutcome(entry historyEntry) string {
+	duration := time.Duration(entry.DurationMS) * time.Millisecond
+	if duration >= time.Minute {
+		duration = duration.Round(time.Second)
+	} else {
+		duration = duration.Round(100 * time.Millisecond)
+	}
+	if *entry.ExitCode == 0 {
+		return fmt.Sprintf("~%s, passed", duration)
+	}
+	return fmt.Sprintf("~%s, exit code %d", duration, *entry.ExitCode)
+}
+
+// lastRuns maps "package.json path\x00script" to the latest run time.
+func lastRuns(entries []historyEntry) map[string]time.Time {
+	runs := map[string]time.Time{}
+	for _, entry := range entries {
+		key := historyKey(entry.Package, entry.Script)
+		if entry.Time.After(runs[key]) {
+			runs[key] = entry.Time
+		}
+	}
+	return runs
+}
+
+// lastRun finds the most recent run of one of scripts, limited to scripts
+// called name unless name is empty.
+func lastRun(scripts []discover.NpmScript, entries []historyEntry, name string) (discover.NpmScript, historyEntry, bool) {
+	i, entry := lastRunIndex(scripts, entries, name)
+	if i < 0 {
+		return discover.NpmScript{}, historyEntry{}, false
+	}
+	return scripts[i], entry, true
+}
+
+// lastRunIndex is lastRun returning the index of the script in scripts, -1
+// when none of them ran.
+func lastRunIndex(scripts []discover.NpmScript, entries []historyEntry, name string) (int, historyEntry) {
+	byKey := map[string]int{}
+	for i, script := range scripts {
+		if path, err := filepath.Abs(script.AbsolutePath); err == nil {
+			byKey[historyKey(path, script.ScriptName)] = i
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if name != "" && entry.Script != name {
+			continue
+		}
+		if idx, ok := byKey[historyKey(entry.Package, entry.Script)]; ok {
+			return idx, entry
+		}
+	}
+	return -1, historyEntry{}
+}
+
+// preselectLastRun moves the most recently run of scripts to the front,
+// where the picker cursor starts, so that Enter runs it again. The others
+// keep their order.
+func preselectLastRun(scripts []discover.NpmScript, entries []historyEntry) {
+	if i, _ := lastRunIndex(scripts, entries, ""); i > 0 {
+		last := scripts[i]
+		copy(scripts[1:i+1], scripts[:i])
+		scripts[0] = last
+	}
+}
+
+// lastRunBelow reads the script of the most recent run in a package below
+// root again, for the streaming picker to preselect before the scan found
+// it. Its path is joined to root like the scan's. Runs of scripts that no
+// longer exist are skipped.
+func lastRunBelow(root string, entries []historyEntry) (discover.NpmScript, bool) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return discover.NpmScript{}, false
+	}
+	read := map[string][]discover.NpmScript{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		rel, err := filepath.Rel(absRoot, entry.Package)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		scripts, ok := read[entry.Package]
+		if !ok {
+			_, scripts, _ = discover.ReadPackageJSON(entry.Package)
+			read[entry.Package] = scripts
+		}
+		for _, script := range scripts {
+			if script.ScriptName == entry.Script {
+				script.AbsolutePath = filepath.Join(root, rel)
+				script.PackageManager = discover.InferPackageManager(script.AbsolutePath)
+				return script, true
+			}
+		}
+	}
+	return discover.NpmScript{}, false
+}
+
+func historyKey(packagePath, script string) string {
+	return packagePath + "\x00" + script
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// httpUsage documents the --http API in --help.
+const httpUsage = `
+HTTP API:
+  --http addr serves the scripts on addr, a loopback address unless
+  --http-public is passed. Every request needs "Authorization: Bearer <token>"
+  with the --http-token, or the token printed at startup.
+    GET  /scripts             the scripts as in --json, ?refresh=1 scans again
+    POST /run                 {"id":"<script id>","args":[],"yes":false}
+                              streams server-sent events: started, output
+                              ({"stream":"stdout","data":"..."}) and exit
+    GET  /runs                the runs started so far, newest first
+  A run is cancelled when its client disconnects. Ctrl-C cancels all runs and
+  stops the server once they exited.
+`
+
+// httpRun is a run started through POST /run, as listed by GET /runs.
+type httpRun struct {
+	Run        int        `json:"run"`
+	Script     jsonScript `json:"script"`
+	Args       []string   `json:"args,omitempty"`
+	Started    time.Time  `json:"started"`
+	Running    bool       `json:"running"`
+	ExitCode   *int       `json:"exitCode,omitempty"`
+	DurationMS *int64     `json:"durationMs,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// httpServer adds the HTTP API on top of the scripts and the run
+// bookkeeping of the --serve server.
+type httpServer struct {
+	*server
+	token   string
+	history []*httpRun
+}
+
+// serveHTTP runs the --http API until Ctrl-C.
+func serveHTTP(opts *options, scriptCache *discover.ScriptCache) {
+	token := opts.httpToken
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: cannot generate a token:", err)
+			os.Exit(exitFailure)
+		}
+		token = hex.EncodeToString(buf)
+	}
+	listener, err := net.Listen("tcp", opts.http)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitFailure)
+	}
+
+	s := &httpServer{server: &server{opts: opts, scriptCache: scriptCache, runs: map[int]context.CancelFunc{}}, token: token}
+	s.scan()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scripts", s.handleScripts)
+	mux.HandleFunc("/run", s.handleRun)
+	mux.HandleFunc("/runs", s.handleRuns)
+	srv := &http.Server{Handler: s.authorize(mux), ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		infof("Stopping, waiting for running scripts to exit.")
+		s.mu.Lock()
+		for _, cancel := range s.runs {
+			cancel()
+		}
+		s.mu.Unlock()
+		srv.Shutdown(context.Background())
+	}()
+
+	infof("Serving %d scripts on http://%s", len(s.scripts), listener.Addr())
+	if opts.httpToken == "" {
+		fmt.Fprintf(os.Stderr, "Token: %s\n", token)
+	}
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitFailure)
+	}
+	s.wg.Wait()
+}
+
+// checkHTTPAddr refuses to listen beyond loopback unless public is set.
+// An address without a host listens on 127.0.0.1.
+func checkHTTPAddr(addr string, public bool) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid --http address %q: %w", addr, err)
+	}
+	if host == "" && !public {
+		host = "127.0.0.1"
+	}
+	if !public {
+		ip := net.ParseIP(host)
+		if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return "", fmt.Errorf("--http only listens on loopback addresses, pass --http-public to listen on %s", addr)
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// authorize rejects requests without the bearer token.
+func (s *httpServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			httpError(w, http.StatusUnauthorized, "missing or wrong token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *httpServer) handleScripts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	s.mu.Lock()
+	if r.URL.Query().Get("refresh") != "" {
+		s.scan()
+	}
+	scripts := make([]jsonScript, 0, len(s.scripts))
+	for _, script := range s.scripts {
+		scripts = append(scripts, newJSONScript(script))
+	}
+	s.mu.Unlock()
+	writeJSON(w, scripts)
+}
+
+func (s *httpServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	s.mu.Lock()
+	runs := make([]httpRun, 0, len(s.history))
+	for _, run := range s.history {
+		runs = append(runs, *run)
+	}
+	s.mu.Unlock()
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Run > runs[j].Run })
+	writeJSON(w, runs)
+}
+
+// handleRun runs the script with the requested ID and streams its output
+// as server-sent events until it exits.
+func (s *httpServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req struct {
+		ID   string   `json:"id"`
+		Args []string `json:"args"`
+		Yes  bool     `json:"yes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	s.mu.Lock()
+	script, ok := findScriptByID(s.scripts, req.ID)
+	s.mu.Unlock()
+	if !ok {
+		httpError(w, http.StatusNotFound, fmt.Sprintf("no script with id %q", req.ID))
+		return
+	}
+	inv, err := s.prepare(script, req.Args, req.Yes)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	record := &httpRun{Script: newJSONScript(script), Args: req.Args, Started: time.Now(), Running: true}
+	s.mu.Lock()
+	s.nextRun++
+	record.Run = s.nextRun
+	s.runs[record.Run] = cancel
+	s.history = append(s.history, record)
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	events := &sseWriter{w: w, flusher: flusher}
+	events.send("started", map[string]any{"run": record.Run, "script": record.Script})
+	res := runOne(ctx, inv, nil, events.stream("stdout"), events.stream("stderr"))
+
+	s.mu.Lock()
+	delete(s.runs, record.Run)
+	code, duration := res.code, res.duration.Milliseconds()
+	record.Running, record.ExitCode, record.DurationMS = false, &code, &duration
+	if res.err != nil {
+		record.Error = res.err.Error()
+	}
+	exit := map[string]any{"run": record.Run, "code": code, "durationMs": duration}
+	if record.Error != "" {
+		exit["error"] = record.Error
+	}
+	s.mu.Unlock()
+	events.send("exit", exit)
+}
+
+// sseWriter writes server-sent events, one at a time.
+type sseWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (e *sseWriter) send(event string, data any) {
+	payload, _ := json.Marshal(data)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, payload)
+	e.flusher.Flush()
+}
+
+// stream returns a writer turning output into output events for stream.
+func (e *sseWriter) stream(stream string) *sseOutput {
+	return &sseOutput{events: e, stream: stream}
+}
+
+type sseOutput struct {
+	events *sseWriter
+	stream string
+}
+
+func (o *sseOutput) Write(data []byte) (int, error) {
+	o.events.send("output", map[string]string{"stream": o.stream, "data": string(data)})
+	return len(data), nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// missingDependencies returns the directory to install in when the package
+// of script declares dependencies but neither its directory nor any
+// directory up to the project root has a node_modules.
+func missingDependencies(script discover.NpmScript) (root string, missing bool) {
+	data, _, err := discover.ReadPackageJSON(script.AbsolutePath)
+	if err != nil || !hasDependencies(data) {
+		return "", false
+	}
+	dir, err := filepath.Abs(filepath.Dir(script.AbsolutePath))
+	if err != nil {
+		return "", false
+	}
+	root = dir
+	for {
+		if info, err := os.Stat(filepath.Join(dir, "node_modules")); err == nil && info.IsDir() {
+			debugf("dependencies of %s are installed in %s", script.AbsolutePath, dir)
+			return "", false
+		}
+		if discover.IsProjectRoot(dir) {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return root, true
+		}
+		dir = parent
+	}
+}
+
+func hasDependencies(data map[string]any) bool {
+	for _, field := range dependencyFields {
+		if deps, _ := data[field].(map[string]any); len(deps) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureInstalled checks that the dependencies of every invocation are
+// installed and offers to install them first, once per project root. With
+// --install it installs without asking, with --no-install it does not
+// check at all. A failed install exits with its code.
+func ensureInstalled(opts *options, invocations []invocation) {
+	if opts.noInstall {
+		return
+	}
+	seen := map[string]bool{}
+	for _, inv := range invocations {
+		root, missing := missingDependencies(inv.Script)
+		if !missing || seen[root] {
+			continue
+		}
+		seen[root] = true
+
+		install := installInvocation(inv, root)
+		if !opts.install {
+			if !isTerminal(os.Stdin) {
+				warnf("dependencies not installed in %s, run `%s` first", root, install.displayName())
+				continue
+			}
+			if !confirm(fmt.Sprintf("dependencies not installed in %s, run `%s` first?", root, install.displayName())) {
+				continue
+			}
+		}
+		infof("==> %s (%s)", install.displayName(), root)
+		code, err := execScript(context.Background(), install, os.Stdin, os.Stdout, os.Stderr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		if code != 0 {
+			fmt.Fprintf(os.Stderr, "Error: %s failed with exit code %d\n", install.displayName(), code)
+			os.Exit(code)
+		}
+	}
+}
+
+// installInvocation installs the dependencies in root with the package
+// manager inv runs the script with.
+func installInvocation(inv invocation, root string) invocation {
+	pm := inv.PackageManager
+	if pm == "" || pm == "node" {
+		pm = "npm"
+	}
+	install := invocation{Invocation: runner.Invocation{Script: inv.Script, PackageManager: pm, Name: pm, Args: []string{"install"}, Dir: root}}
+	if inv.Corepack != "" {
+		install.Corepack = inv.Corepack
+		install.Name, install.Args = "corepack", []string{inv.Corepack, "install"}
+	}
+	return install
+}
+
+// displayName is the command inv runs, without the working directory.
+func (inv invocation) displayName() string {
+	return strings.TrimPrefix(inv.CommandLine(), "cd "+runner.ShellQuote(inv.Dir)+" && ")
+}
+
+// confirm asks question on stderr and reports whether the answer on stdin
+// is yes, which is the default.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [Y/n] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// debugLog is the --verbose logger. It is safe for concurrent use by the
+// scanning goroutines. While held, lines are buffered instead of written so
+// they never interleave with the picker UI.
+type debugLog struct {
+	mu      sync.Mutex
+	enabled bool
+	held    bool
+	out     io.Writer
+	buf     bytes.Buffer
+}
+
+var verboseLog = &debugLog{out: os.Stderr}
+
+// debugf logs a line when --verbose is on.
+func debugf(format string, args ...any) {
+	verboseLog.printf(format, args...)
+}
+
+func (l *debugLog) printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.enabled {
+		return
+	}
+	w := l.out
+	if l.held {
+		w = &l.buf
+	}
+	fmt.Fprintf(w, "[go-npm-run] "+format+"\n", args...)
+}
+
+// hold buffers log lines until release is called.
+func (l *debugLog) hold() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = true
+}
+
+// release writes out the buffered lines and resumes direct logging.
+func (l *debugLog) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = false
+	if l.buf.Len() > 0 {
+		l.out.Write(l.buf.Bytes())
+		l.buf.Reset()
+	}
+}
+
+// quiet is set by --quiet and silences go-npm-run's own informational
+// messages and warnings. Errors and the script's output are unaffected.
+var quiet bool
+
+// infof prints an informational message to stderr unless --quiet is set.
+func infof(format string, args ...any) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// ANSI colors for go-npm-run's own stderr output.
+const (
+	colorRed   = "31"
+	colorGreen = "32"
+	colorCyan  = "36"
+)
+
+// paint wraps s in the ANSI color when stderr is a terminal and NO_COLOR
+// is not set.
+func paint(color, s string) string {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" || !isTerminal(os.Stderr) {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+// warnf prints a warning to stderr unless --quiet is set.
+func warnf(format string, args ...any) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+	}
+}
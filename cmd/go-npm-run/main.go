@@ -0,0 +1,719 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+	"github.com/ktr0731/go-fuzzyfinder"
+	"golang.org/x/term"
+)
+
+// runScript runs inv in the foreground and prints its resultLine. A failed
+// run exits with the exit code of the script.
+func runScript(inv invocation) {
+	result := runOne(context.Background(), inv, os.Stdin, os.Stdout, os.Stderr)
+	infof("%s", resultLine(result))
+	if result.logPath != "" {
+		infof("    log: %s", displayPath(result.logPath))
+	}
+	notifyResult(inv, result)
+	if errors.Is(result.err, errTimedOut) {
+		os.Exit(result.code)
+	}
+	if result.err != nil {
+		os.Exit(exitFailure)
+	}
+	if result.code != 0 {
+		// exit with the same exit code as the command
+		os.Exit(result.code)
+	}
+}
+
+// forwardedSignals are passed on to a script running in the foreground.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// errTimedOut is returned, with exitTimeout, for a script that was stopped
+// because it ran longer than its timeout.
+var errTimedOut = errors.New("timed out")
+
+// execScript runs inv reading stdin, nil meaning no input, and writing to
+// stdout and stderr, and returns its exit code. err is only set when the
+// command could not be run at all, or wraps errTimedOut when inv.timeout
+// elapsed: then the script's process group got SIGTERM and, after
+// inv.timeoutGrace, SIGKILL. Cancelling ctx interrupts the script and waits
+// for it to exit.
+//
+// Without a cancellable ctx the script runs in the foreground: SIGINT,
+// SIGTERM and SIGHUP are forwarded to its process group and, once it
+// exited, go-npm-run exits too, with the script's code or 128+signal.
+// Either way a script that does not exit within killGrace is killed along
+// with everything it spawned.
+func execScript(ctx context.Context, inv invocation, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	cmd := inv.Command()
+
+	var signals chan os.Signal
+	if ctx.Done() == nil {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, forwardedSignals...)
+		defer signal.Stop(signals)
+	}
+
+	// Captured output would make the script think it is not in a terminal
+	restore, finishOutput := func() {}, func() {}
+	started := false
+	if _, direct := stdout.(*os.File); inv.pty && !direct && isTerminal(os.Stdout) {
+		finish, err := startInPTY(cmd, stdin, stdout)
+		if err != nil {
+			debugf("cannot run %s in a pty, using pipes: %v", inv.Script.ScriptName, err)
+			cmd = inv.Command()
+		} else {
+			finishOutput, started = finish, true
+		}
+	}
+	if !started {
+		cmd.Stdin = stdin
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if ctx.Done() != nil {
+			// The interrupt has to reach everything the script spawned
+			setProcessGroup(cmd)
+		} else {
+			restore = setForegroundProcessGroup(cmd)
+		}
+		if err := cmd.Start(); err != nil {
+			restore()
+			return 0, err
+		}
+	}
+	start := time.Now()
+	var timeout <-chan time.Time
+	if inv.timeout > 0 {
+		timer := time.NewTimer(inv.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var received atomic.Value
+	var timedOut atomic.Bool
+	exited := make(chan struct{})
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		select {
+		case <-ctx.Done():
+			stopProcess(cmd, os.Interrupt, exited, killGrace)
+		case sig := <-signals:
+			received.Store(sig)
+			debugf("forwarding %v to %s", sig, inv.Script.ScriptName)
+			stopProcess(cmd, sig, exited, killGrace)
+		case <-timeout:
+			timedOut.Store(true)
+			debugf("%s ran longer than %s, terminating it", inv.Script.ScriptName, inv.timeout)
+			stopProcess(cmd, syscall.SIGTERM, exited, inv.timeoutGrace)
+		case <-exited:
+		}
+	}()
+
+	err := cmd.Wait()
+	restore()
+	close(exited)
+	<-forwarded
+
+	code := 0
+	if err != nil {
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) {
+			return 0, err
+		}
+		code = exitStatus(exitError)
+	}
+	sig, signalled := received.Load().(os.Signal)
+	// A script stopped by a signal must not leave servers running behind it
+	if signalled || ctx.Err() != nil || code > 128 || timedOut.Load() {
+		killStragglers(cmd, killGrace)
+	}
+	finishOutput()
+	if timedOut.Load() {
+		return exitTimeout, fmt.Errorf("%w after %s", errTimedOut, time.Since(start).Round(time.Millisecond))
+	}
+	if signalled {
+		if code == 0 {
+			code = signalExitCode(sig)
+		}
+		os.Exit(code)
+	}
+	return code, nil
+}
+
+// exitStatus is the shell's view of a failed command's exit code, 128+signal
+// when it was killed by a signal.
+func exitStatus(exitError *exec.ExitError) int {
+	if code := exitError.ExitCode(); code >= 0 {
+		return code
+	}
+	if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return signalExitCode(status.Signal())
+	}
+	return exitFailure
+}
+
+// findScriptByID returns the script whose ID is id.
+func findScriptByID(scripts []discover.NpmScript, id string) (discover.NpmScript, bool) {
+	for _, script := range scripts {
+		if script.ID() == id {
+			return script, true
+		}
+	}
+	return discover.NpmScript{}, false
+}
+
+// findScriptByName returns the script called name. A script defined by the
+// package.json in searchPath wins, otherwise the name must be unique across
+// all discovered packages. ok is false when there is no unambiguous match.
+func findScriptByName(scripts []discover.NpmScript, name string, searchPath string) (discover.NpmScript, bool) {
+	rootPackageJSON := filepath.Join(searchPath, "package.json")
+
+	var matches []discover.NpmScript
+	for _, script := range scripts {
+		if script.ScriptName != name {
+			continue
+		}
+		if filepath.Clean(script.AbsolutePath) == rootPackageJSON {
+			return script, true
+		}
+		matches = append(matches, script)
+	}
+
+	if len(matches) == 1 {
+		return matches[0], true
+	}
+	return discover.NpmScript{}, false
+}
+
+// noScriptNamed reports that no script is called name and exits with
+// exitFailure, or like npm's --if-present with a note and 0.
+func noScriptNamed(opts *options, name string) {
+	if opts.ifPresent {
+		infof("No script named %q found, nothing to run (--if-present).", name)
+		os.Exit(0)
+	}
+	fmt.Fprintf(os.Stderr, "No script named %q found.\n", name)
+	os.Exit(exitFailure)
+}
+
+// Exit codes used by go-npm-run itself. A script's own exit code is
+// propagated as is.
+const (
+	exitFailure = 1
+	exitUsage   = 2
+	// exitNothingToDo means the scan found no package.json files or scripts.
+	exitNothingToDo = 3
+	// exitTimeout means a script ran longer than --timeout, like coreutils
+	// timeout(1) reports it.
+	exitTimeout = 124
+)
+
+// scanAborted exits after Ctrl-C interrupted the scan.
+func scanAborted() {
+	fmt.Fprintln(os.Stderr, "scan aborted")
+	os.Exit(signalExitCode(os.Interrupt))
+}
+
+// signalExitCode is the conventional shell exit code for a process killed
+// by sig.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 128 + int(syscall.SIGINT)
+}
+
+func main() {
+	timeStart := time.Now()
+
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		shell := ""
+		if len(os.Args) > 2 {
+			shell = os.Args[2]
+		}
+		if err := writeCompletion(os.Stdout, shell); err != nil {
+			fmt.Fprintf(os.Stderr, "go-npm-run: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		return
+	}
+
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "go-npm-run: %v\nRun 'go-npm-run --help' for usage.\n", err)
+		os.Exit(exitUsage)
+	}
+
+	discover.SetParseJobs(opts.parseJobs)
+
+	if opts.showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	quiet = opts.quiet
+	verboseLog.enabled = opts.verbose
+	discover.Debugf = debugf
+	runner.Debugf, runner.Warnf = debugf, warnf
+	debugf("starting %s", versionString())
+	if !opts.plain && usePlain(opts) {
+		debugf("TERM is dumb, picking from the plain menu")
+	}
+	for _, name := range sortedKeys(opts.sources) {
+		debugf("option %s set by %s", name, opts.sources[name])
+	}
+
+	if opts.listAliases {
+		printAliases(os.Stdout, opts.aliases)
+		return
+	}
+
+	for _, dir := range opts.ignore {
+		discover.IgnoredDirs[dir] = true
+	}
+	discover.FollowLocalDependencies = !opts.noLocalDeps
+
+	if opts.doctor {
+		os.Exit(runDoctor(os.Stdout, opts))
+	}
+
+	// Aliases pointing at a directory do not need a scan
+	if opts.alias != nil {
+		script, ok, err := aliasAtPath(*opts.alias)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		if ok {
+			debugf("alias %s: %s", opts.alias.Name, opts.alias)
+			run(opts, script)
+			return
+		}
+	}
+
+	scriptCache := discover.LoadScriptCache(opts.refresh)
+	discover.UseCache(scriptCache)
+
+	if opts.serve {
+		serve(opts, scriptCache)
+		return
+	}
+	if opts.http != "" {
+		serveHTTP(opts, scriptCache)
+		return
+	}
+
+	// The picker does not have to wait for the scan
+	if canStream(opts) && isTerminal(os.Stdin) && (isTerminal(os.Stdout) || opts.eval) {
+		pickWhileScanning(opts, scriptCache, timeStart)
+		return
+	}
+
+	// Ctrl-C aborts the scan, once it is done the picker and the script
+	// handle it themselves
+	scanCtx, stopScan := signal.NotifyContext(context.Background(), os.Interrupt)
+	stopProgress := startProgress(scanProgress)
+
+	// Use the concurrent version to find package.json files
+	var stats scanStats
+	stageStart := time.Now()
+	projectRootPackageJsons := discover.FindPackages(scanCtx, opts.searchPath)
+	stats.walk = time.Since(stageStart)
+	if scanCtx.Err() != nil {
+		stopProgress()
+		scanAborted()
+	}
+
+	if len(projectRootPackageJsons) == 0 {
+		stopProgress()
+		if opts.ifPresent && opts.scriptName != "" {
+			noScriptNamed(opts, opts.scriptName)
+		}
+		infof("No package.json files found.")
+		os.Exit(exitNothingToDo)
+		return
+	}
+
+	// Use the concurrent version to extract scripts from package.json files
+	stageStart = time.Now()
+	allScripts := discover.ExtractScripts(scanCtx, projectRootPackageJsons)
+	stats.extract = time.Since(stageStart)
+	stopProgress()
+	if scanCtx.Err() != nil {
+		scanAborted()
+	}
+	stopScan()
+	scriptCache.Save()
+	extracted := allScripts
+
+	if len(allScripts) == 0 {
+		if opts.ifPresent && opts.scriptName != "" {
+			noScriptNamed(opts, opts.scriptName)
+		}
+		infof("No scripts found.")
+		os.Exit(exitNothingToDo)
+	}
+
+	// Before the other filters, dependents are found through any package
+	if opts.since != "" {
+		var err error
+		allScripts, err = sinceScripts(allScripts, opts.searchPath, opts.since, opts.dependents)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		if len(allScripts) == 0 {
+			infof("No packages changed since %s.", opts.since)
+			os.Exit(exitNothingToDo)
+		}
+	}
+
+	if opts.workspacesOnly {
+		allScripts = workspaceScripts(allScripts, opts.searchPath)
+		if len(allScripts) == 0 {
+			infof("No scripts found in workspaces.")
+			os.Exit(exitNothingToDo)
+		}
+	}
+
+	if found := len(allScripts); len(opts.excludePackages) > 0 {
+		allScripts = excludePackages(allScripts, opts.excludePackages, opts.searchPath)
+		if len(allScripts) == 0 {
+			infof("All %d scripts are in packages excluded by %s.", found, strings.Join(opts.excludePackages, ", "))
+			os.Exit(exitNothingToDo)
+		}
+	}
+
+	if len(opts.scopes) > 0 {
+		allScripts = scopeScripts(allScripts, opts.scopes)
+		if len(allScripts) == 0 {
+			infof("No packages in scope %s.", strings.Join(opts.scopes, ", "))
+			os.Exit(exitNothingToDo)
+		}
+	}
+
+	if len(opts.only) > 0 {
+		var unmatched []string
+		allScripts, unmatched = onlyScripts(allScripts, opts.only)
+		if len(allScripts) == 0 {
+			infof("No scripts match --only %s.", strings.Join(unmatched, ", "))
+			os.Exit(exitNothingToDo)
+		}
+	}
+
+	// Exclusions apply after --only, so they can carve exceptions out of it
+	if found := len(allScripts); len(opts.exclude) > 0 {
+		allScripts = excludeScripts(allScripts, opts.exclude)
+		if len(allScripts) == 0 {
+			infof("All %d scripts are excluded by %s.", found, strings.Join(opts.exclude, ", "))
+			os.Exit(exitNothingToDo)
+		}
+	}
+
+	history := loadHistory()
+	lastOutcomes = finishedRuns(history)
+	sortScripts(allScripts, opts.sort, history)
+
+	if opts.export != "" {
+		if err := writeExport(os.Stdout, opts, listedScripts(opts, allScripts)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	if opts.where {
+		os.Exit(printWhere(os.Stdout, allScripts, opts.scriptName, opts.whereCd))
+	}
+
+	stdinIsTerminal := isTerminal(os.Stdin)
+	stdoutIsTerminal := isTerminal(os.Stdout)
+
+	// Piping the picker makes no sense, list the scripts instead
+	if !stdoutIsTerminal && !opts.plain && opts.scriptName == "" && opts.runID == "" && !opts.eval && !opts.last && opts.print == printNone && !opts.dryRun && opts.format != formatTSV {
+		opts.list = true
+	}
+
+	if opts.json {
+		if err := printJSON(os.Stdout, listedScripts(opts, allScripts)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		reportStats(opts, stats, extracted)
+		return
+	}
+	if opts.list {
+		printList(os.Stdout, listedScripts(opts, allScripts), !opts.noVersions)
+		reportStats(opts, stats, extracted)
+		return
+	}
+	if opts.format == formatTSV {
+		printTSV(os.Stdout, listedScripts(opts, allScripts), opts.columns, opts.header)
+		reportStats(opts, stats, extracted)
+		return
+	}
+
+	if opts.runID != "" {
+		script, ok := findScriptByID(allScripts, opts.runID)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: no script with id %q found in %s, it was renamed, removed or moved to another package.json\n", opts.runID, opts.searchPath)
+			os.Exit(exitFailure)
+		}
+		run(opts, script)
+		return
+	}
+
+	if opts.last {
+		script, entry, ok := lastRun(allScripts, history, opts.scriptName)
+		if !ok {
+			infof("No previous run found in %s.", opts.searchPath)
+			os.Exit(exitNothingToDo)
+		}
+		if len(opts.scriptArgs) == 0 {
+			opts.scriptArgs = entry.Args
+		}
+		opts.values = entry.Values
+		run(opts, script)
+		return
+	}
+
+	if opts.all {
+		runAll(opts, allScripts)
+		return
+	}
+
+	if opts.alias != nil {
+		script, err := aliasInScripts(*opts.alias, allScripts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		debugf("alias %s: %s", opts.alias.Name, opts.alias)
+		run(opts, script)
+		return
+	}
+
+	if len(opts.scriptNames) > 0 {
+		runNames(opts, allScripts)
+		return
+	}
+
+	query := ""
+	if opts.scriptName != "" {
+		if script, ok := findScriptByName(allScripts, opts.scriptName, opts.searchPath); ok {
+			run(opts, script)
+			return
+		}
+		if !hasScriptNamed(allScripts, opts.scriptName) {
+			noScriptNamed(opts, opts.scriptName)
+		}
+		// Ambiguous name, let the user pick between the candidates
+		query = opts.scriptName
+	}
+
+	if !stdinIsTerminal && !usePlain(opts) {
+		fmt.Fprintln(os.Stderr, "Error: stdin is not a terminal, cannot open the picker.")
+		fmt.Fprintln(os.Stderr, "Use --list or --json to print the scripts, --plain to choose from a numbered menu, or pass a script name to run it directly.")
+		os.Exit(exitFailure)
+	}
+
+	// The candidates of an ambiguous name include hidden scripts, they run
+	// by name
+	choices := allScripts
+	if query == "" {
+		choices = listedScripts(opts, allScripts)
+		preselectLastRun(choices, history)
+	}
+
+	pickerInfo = pickerHeader(opts, extracted, choices, pickerWidth(opts))
+	verboseLog.hold()
+	stageStart = time.Now()
+	idx, err := pick(opts, choices, query)
+	stats.pick = time.Since(stageStart)
+	verboseLog.release()
+	reportStats(opts, stats, extracted)
+
+	if err != nil {
+		pickAborted(opts, err)
+		return
+	}
+
+	run(opts, choices[idx])
+}
+
+// listedScripts returns the scripts to list or offer in the picker, those
+// not hidden by their package.json unless --show-hidden is set. It exits
+// when all of them are hidden.
+func listedScripts(opts *options, scripts []discover.NpmScript) []discover.NpmScript {
+	if opts.showHidden {
+		return scripts
+	}
+	listed := visibleScripts(scripts)
+	if len(listed) == 0 {
+		infof("All %d scripts are hidden by their package.json, --show-hidden lists them.", len(scripts))
+		os.Exit(exitNothingToDo)
+	}
+	return listed
+}
+
+// reportStats prints the --stats report to stderr when it was asked for.
+func reportStats(opts *options, stats scanStats, scripts []discover.NpmScript) {
+	if opts.stats {
+		printStats(os.Stderr, stats, scripts)
+	}
+}
+
+// pickAborted prints the error a picker failed with and treats closing the
+// picker as a no-op exit rather than an error. Under --eval both exit
+// non-zero, so that the shell evaluates nothing.
+func pickAborted(opts *options, err error) {
+	if err != fuzzyfinder.ErrAbort {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		if opts.eval {
+			os.Exit(exitFailure)
+		}
+	}
+	if opts.eval {
+		os.Exit(exitNothingToDo)
+	}
+}
+
+// run executes the selected script, or just describes it with --dry-run
+// and --print.
+func run(opts *options, script discover.NpmScript) {
+	inv := resolveInvocation(script, opts)
+	err := checkRunDir(inv)
+	if err == nil {
+		err = applyScriptEnv(&inv, opts)
+	}
+	var values map[string]string
+	if err == nil {
+		values, err = fillPlaceholders(&inv, opts)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitFailure)
+	}
+	var deps []invocation
+	if opts.withDeps != "" {
+		deps = dependencyInvocations(opts, script)
+	}
+	if opts.eval {
+		if dir, err := filepath.Abs(inv.Dir); err == nil {
+			inv.Dir = dir
+		}
+		if !opts.noHistory {
+			if _, err := recordHistory(script, opts.scriptArgs, values); err != nil {
+				debugf("cannot record history: %v", err)
+			}
+		}
+		fmt.Println(inv.CommandLine())
+		return
+	}
+	invocations := append(deps, inv)
+	switch opts.print {
+	case printCommand:
+		for _, inv := range invocations {
+			fmt.Println(inv.CommandLine())
+		}
+		return
+	case printRaw:
+		for _, inv := range invocations {
+			fmt.Println(inv.Script.Command)
+		}
+		return
+	}
+	if opts.dryRun {
+		printDryRun(os.Stdout, invocations)
+		return
+	}
+	confirmDangerous(opts, invocations)
+	confirmPlatform(opts, invocations)
+	if inv.PackageManager != "bun" {
+		checkNodeVersion(opts, script)
+	}
+	ensureInstalled(opts, invocations)
+	if len(deps) > 0 {
+		runDependencies(opts, deps, inv)
+	}
+	if !opts.noHistory {
+		if entry, err := recordHistory(script, opts.scriptArgs, values); err != nil {
+			debugf("cannot record history: %v", err)
+		} else {
+			inv.recorded = &entry
+		}
+	}
+	announce(inv)
+	if opts.tmux != "" && runInTmux(inv, opts) {
+		return
+	}
+	if opts.watch {
+		watchScript(inv, opts.watchGlobs)
+		return
+	}
+	if opts.restart != restartNever {
+		superviseScript(inv, opts.restart)
+		return
+	}
+	if opts.exec {
+		err := replaceProcess(inv)
+		fmt.Fprintf(os.Stderr, "Error: cannot exec %s: %v\n", inv.Name, err)
+		os.Exit(exitFailure)
+	}
+	runScript(inv)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// terminalWidth is the width of the terminal the picker draws on, 80 when
+// none of the standard streams is one.
+func terminalWidth() int {
+	for _, f := range []*os.File{os.Stderr, os.Stdin, os.Stdout} {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	return 80
+}
+
+func hasScriptNamed(scripts []discover.NpmScript, name string) bool {
+	for _, script := range scripts {
+		if script.ScriptName == name {
+			return true
+		}
+	}
+	return false
+}
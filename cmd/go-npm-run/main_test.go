@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// TestExecScriptStdin checks that a script gets the stdin execScript is
+// given, here one reading a line and echoing it.
+func TestExecScriptStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the script is written for sh")
+	}
+	t.Setenv("npm_config_script_shell", "")
+	path := filepath.Join(t.TempDir(), "package.json")
+	if err := os.WriteFile(path, []byte(`{"name": "app", "scripts": {"echo-line": "read line; echo \"got: $line\""}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, scripts, err := discover.ReadPackageJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv := invocation{Invocation: runner.Resolve(scripts[0], runner.Options{Raw: true})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	code, err := execScript(ctx, inv, strings.NewReader("hello world\nignored\n"), &stdout, &stderr)
+	if err != nil || code != 0 {
+		t.Fatalf("execScript = %d, %v, stderr: %s", code, err, stderr.String())
+	}
+	if got, want := stdout.String(), "got: hello world\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// nodeVersionFiles pin the node version of a project, the nearest one wins.
+var nodeVersionFiles = []string{".nvmrc", ".node-version"}
+
+// checkNodeVersion warns when the active node conflicts with the version
+// script's project asks for, or exits with --strict-engines.
+func checkNodeVersion(opts *options, script discover.NpmScript) {
+	mismatch := nodeVersionMismatch(script)
+	if mismatch == "" {
+		return
+	}
+	if opts.strictEngines {
+		fmt.Fprintf(os.Stderr, "Error: %s.\n", mismatch)
+		os.Exit(exitFailure)
+	}
+	warnf("%s.", mismatch)
+}
+
+// nodeVersionMismatch checks the active node against the version pinned by
+// the nearest .nvmrc or .node-version and against engines.node of the
+// script's package. It returns a one line description of the first
+// conflict, "" when everything is satisfied or cannot be checked.
+func nodeVersionMismatch(script discover.NpmScript) string {
+	actual, parts, err := parseSemver(runner.NodeVersion())
+	if err != nil || parts == 0 {
+		return ""
+	}
+
+	type constraint struct{ wanted, source string }
+	var constraints []constraint
+	if wanted, source := pinnedNodeVersion(filepath.Dir(script.AbsolutePath)); wanted != "" {
+		constraints = append(constraints, constraint{wanted, source})
+	}
+	if data, _, err := discover.ReadPackageJSON(script.AbsolutePath); err == nil {
+		engines, _ := data["engines"].(map[string]any)
+		if wanted, ok := engines["node"].(string); ok && wanted != "" {
+			constraints = append(constraints, constraint{wanted, "engines.node"})
+		}
+	}
+
+	for _, c := range constraints {
+		ok, err := satisfiesRange(actual, c.wanted)
+		if err != nil {
+			debugf("cannot check node %s against %q from %s: %v", runner.NodeVersion(), c.wanted, c.source, err)
+			continue
+		}
+		if !ok {
+			return fmt.Sprintf("%s wants node %s (%s) but the active node is %s", script.PackageName, c.wanted, c.source, runner.NodeVersion())
+		}
+	}
+	return ""
+}
+
+// pinnedNodeVersion returns the version in the nearest node version file
+// at or above dir and that file's path. Aliases like "lts/*" are skipped.
+func pinnedNodeVersion(dir string) (wanted, source string) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", ""
+	}
+	for {
+		for _, name := range nodeVersionFiles {
+			path := filepath.Join(dir, name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			wanted = strings.TrimSpace(string(data))
+			if _, _, err := parseSemver(wanted); err != nil {
+				debugf("ignoring %s: %q is not a version", path, wanted)
+				return "", ""
+			}
+			return wanted, path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// notifyTimeout bounds how long a notifier may take, a hanging one must not
+// keep go-npm-run from exiting.
+const notifyTimeout = 5 * time.Second
+
+// notifyResult shows a desktop notification for a finished run when
+// --notify is set and the run took at least inv.notifyAfter.
+func notifyResult(inv invocation, r allResult) {
+	if !inv.notify || r.duration < inv.notifyAfter {
+		return
+	}
+	if r.failed() {
+		notifyf("✗ %s failed, %s", inv.Script.Label(), failureReason(r))
+	} else {
+		notifyf("✓ %s finished in %s", inv.Script.Label(), r.duration.Round(time.Second))
+	}
+}
+
+// notifyRecap shows one notification for the --all results of script.
+func notifyRecap(script string, results []allResult) {
+	failed := 0
+	for _, r := range results {
+		if r.failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		notifyf("✗ %s failed in %d of %d packages", script, failed, len(results))
+	} else {
+		notifyf("✓ %s passed in %d packages", script, len(results))
+	}
+}
+
+// failureReason says why the failed run r failed, e.g. "exit 1".
+func failureReason(r allResult) string {
+	switch {
+	case r.interrupted:
+		return "interrupted"
+	case r.err != nil:
+		return r.err.Error()
+	default:
+		return fmt.Sprintf("exit %d", r.code)
+	}
+}
+
+// notifyf shows a desktop notification with the native notifier of the
+// platform: osascript on macOS, notify-send elsewhere and a PowerShell
+// toast on Windows. Without one nothing happens.
+func notifyf(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	name, cmdArgs := notifyCommand("go-npm-run", message)
+	path, err := exec.LookPath(name)
+	if err != nil {
+		debugf("no notifier available: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, path, cmdArgs...).CombinedOutput(); err != nil {
+		debugf("cannot notify with %s: %v %s", name, err, strings.TrimSpace(string(out)))
+	}
+}
+
+// notifyCommand returns the command showing a notification with title and
+// message on this platform.
+func notifyCommand(title, message string) (string, []string) {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))
+		return "osascript", []string{"-e", script}
+	case "windows":
+		script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode(` + powerShellQuote(title) + `)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode(` + powerShellQuote(message) + `)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('go-npm-run').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", script}
+	default:
+		return "notify-send", []string{"--app-name=go-npm-run", title, message}
+	}
+}
+
+// appleScriptQuote returns s as an AppleScript string literal.
+func appleScriptQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// powerShellQuote returns s as a single quoted PowerShell string.
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
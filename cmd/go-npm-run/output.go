@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// describeRun is the one line saying what inv runs and where, e.g.
+// `pnpm run build -- --watch (in packages/ui)`: the command with its
+// forwarded args and the directory relative to the current one. It is
+// shown before a script starts, by --dry-run and for failed --all runs.
+func describeRun(inv invocation) string {
+	parts := []string{runner.ShellQuote(inv.Name)}
+	for _, arg := range inv.Args {
+		parts = append(parts, runner.ShellQuote(arg))
+	}
+	return fmt.Sprintf("%s (in %s)", strings.Join(parts, " "), displayPath(inv.Dir))
+}
+
+// announce prints describeRun for inv before it starts, unless --quiet.
+func announce(inv invocation) {
+	infof("%s %s", paint(colorCyan, "→"), describeRun(inv))
+}
+
+// displayPath shows path relative to the current directory when it is
+// inside of it, absolute otherwise.
+func displayPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return abs
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return rel
+}
+
+// printList writes one script per line: the picker label, the command, the
+// ID for --run-id and, when the package has one and versions is set, the
+// package version. Fields are escaped like printTSV does.
+func printList(w io.Writer, scripts []discover.NpmScript, versions bool) {
+	for _, script := range scripts {
+		fields := []string{script.Label(), script.Command, script.ID()}
+		if versions && script.PackageVersion != "" {
+			fields = append(fields, script.PackageVersion)
+		}
+		for i, field := range fields {
+			fields[i] = tsvEscaper.Replace(field)
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+}
+
+// scanProgress describes the scan so far for the progress spinner, like
+// "scanning… 1,284 dirs, 37 packages".
+func scanProgress() string {
+	return fmt.Sprintf("scanning… %s dirs, %s packages", groupDigits(discover.Progress.Dirs.Load()), groupDigits(discover.Progress.Packages.Load()))
+}
+
+// scanStats are the timings --stats reports besides discover.Progress.
+// Streaming scans walk and extract at the same time and only set scan,
+// with scanStopped when the pick ended the scan early.
+type scanStats struct {
+	walk, extract, scan, pick time.Duration
+	scanStopped               bool
+}
+
+// printStats prints the --stats report: how long every stage took and how
+// much the scan found, scripts being what it extracted before filtering.
+func printStats(w io.Writer, stats scanStats, scripts []discover.NpmScript) {
+	fmt.Fprintln(w, "Stats:")
+	line := func(what, value string) {
+		fmt.Fprintf(w, "  %-22s %s\n", what, value)
+	}
+	if stats.scanStopped {
+		line("scan", statsDuration(stats.scan)+", stopped by the pick")
+	} else if stats.scan > 0 {
+		line("scan", statsDuration(stats.scan)+", walk and extraction together")
+	} else {
+		line("directory walk", statsDuration(stats.walk))
+		line("script extraction", statsDuration(stats.extract))
+	}
+	line("  workspace expansion", statsDuration(time.Duration(discover.Progress.WorkspaceTime.Load()))+", summed over workers")
+	line("  package.json parsing", statsDuration(time.Duration(discover.Progress.ParseTime.Load()))+", summed over workers")
+	if stats.pick > 0 {
+		line("picker", statsDuration(stats.pick))
+	}
+	line("directories visited", groupDigits(discover.Progress.Dirs.Load()))
+	packages := groupDigits(discover.Progress.Packages.Load())
+	if cached := discover.Progress.Cached.Load(); cached > 0 {
+		packages += fmt.Sprintf(", %s from the cache", groupDigits(cached))
+	}
+	line("packages found", packages)
+	line("scripts extracted", groupDigits(int64(len(scripts))))
+	if counts := packagesPerManager(scripts); len(counts) > 0 {
+		line("packages with scripts", strings.Join(counts, ", "))
+	}
+}
+
+// packagesPerManager counts the packages of scripts per package manager,
+// like ["npm 7", "pnpm 30"].
+func packagesPerManager(scripts []discover.NpmScript) []string {
+	perManager := map[string]int{}
+	seen := map[string]bool{}
+	for _, script := range scripts {
+		if !seen[script.AbsolutePath] {
+			seen[script.AbsolutePath] = true
+			perManager[script.PackageManager]++
+		}
+	}
+	var counts []string
+	for _, pm := range sortedKeys(perManager) {
+		counts = append(counts, fmt.Sprintf("%s %d", pm, perManager[pm]))
+	}
+	return counts
+}
+
+// pickerHeader is the line above the picker prompt: the searched root,
+// how many packages and scripts the scan found and how many of them are
+// shown, the package manager and the active filters, like
+// "~/src/repo · 12 packages, 87 scripts (40 shown) · pnpm · --scope @acme".
+// found is nil while a streaming scan runs, pickerCounts has the rest then.
+// Parts that do not fit in width are left out from the end, the filters
+// first.
+func pickerHeader(opts *options, found, shown []discover.NpmScript, width int) string {
+	root, _ := filepath.Abs(opts.searchPath)
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		if rel, err := filepath.Rel(home, root); err == nil && !strings.HasPrefix(rel, "..") {
+			root = filepath.Join("~", rel)
+		}
+	}
+	parts := append([]string{root}, pickerCounts(opts, found, shown)...)
+
+	var filters []string
+	if opts.since != "" {
+		filters = append(filters, "--since "+opts.since)
+		if opts.dependents {
+			filters = append(filters, "--include-dependents")
+		}
+	}
+	if opts.workspacesOnly {
+		filters = append(filters, "--workspaces-only")
+	}
+	for _, f := range []struct {
+		flag  string
+		globs []string
+	}{{"--exclude-package", opts.excludePackages}, {"--scope", opts.scopes}, {"--only", opts.only}, {"--exclude", opts.exclude}} {
+		if len(f.globs) > 0 {
+			filters = append(filters, f.flag+" "+strings.Join(f.globs, ","))
+		}
+	}
+	if opts.showHidden {
+		filters = append(filters, "--show-hidden")
+	}
+	if len(filters) > 0 {
+		parts = append(parts, strings.Join(filters, " "))
+	}
+
+	return joinParts(parts, width)
+}
+
+// pickerCounts is the part of pickerHeader about the scan: the package and
+// script counts and the package managers, or the --pm override alone when
+// found is nil.
+func pickerCounts(opts *options, found, shown []discover.NpmScript) []string {
+	var parts []string
+	if found != nil {
+		packages := map[string]bool{}
+		for _, script := range found {
+			packages[script.AbsolutePath] = true
+		}
+		counts := fmt.Sprintf("%d packages, %d scripts", len(packages), len(found))
+		if len(shown) != len(found) {
+			counts += fmt.Sprintf(" (%d shown)", len(shown))
+		}
+		parts = append(parts, counts)
+	}
+	switch {
+	case opts.packageManager != "":
+		parts = append(parts, opts.packageManager+" (--pm)")
+	case found != nil:
+		parts = append(parts, strings.Join(packagesPerManager(found), ", "))
+	}
+	return parts
+}
+
+// joinParts joins parts with " · ", leaving out the ones from the end that
+// do not fit in width. The first part is always kept.
+func joinParts(parts []string, width int) string {
+	line := parts[0]
+	for _, part := range parts[1:] {
+		if len([]rune(line))+3+len([]rune(part)) > width {
+			break
+		}
+		line += " · " + part
+	}
+	return line
+}
+
+// statsDuration rounds d for --stats, to microseconds below a millisecond,
+// to a tenth of a millisecond below a second and to milliseconds above.
+func statsDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	if d < time.Second {
+		return d.Round(100 * time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// groupDigits formats n with commas between groups of three digits.
+func groupDigits(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// printWhere prints the package name, package.json path and command of
+// every script called name, or with dirOnly the directory of its package,
+// which needs exactly one of them. It returns the exit code.
+func printWhere(w io.Writer, scripts []discover.NpmScript, name string, dirOnly bool) int {
+	var matches []discover.NpmScript
+	for _, script := range scripts {
+		if script.ScriptName == name {
+			matches = append(matches, script)
+		}
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "No script named %q found.\n", name)
+		return exitFailure
+	}
+	if dirOnly {
+		if len(matches) > 1 {
+			fmt.Fprintf(os.Stderr, "Error: %d packages define %q, --cd needs exactly one:\n", len(matches), name)
+			for _, script := range matches {
+				fmt.Fprintf(os.Stderr, "  %s\t%s\n", script.PackageName, script.AbsolutePath)
+			}
+			return exitFailure
+		}
+		dir, err := filepath.Abs(filepath.Dir(matches[0].AbsolutePath))
+		if err != nil {
+			dir = filepath.Dir(matches[0].AbsolutePath)
+		}
+		fmt.Fprintln(w, dir)
+		return 0
+	}
+	for _, script := range matches {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", script.PackageName, script.AbsolutePath, script.Command)
+	}
+	return 0
+}
+
+// jsonScript is the --json representation of a script.
+type jsonScript struct {
+	// ID is the value --run-id takes.
+	ID string `json:"id"`
+	// Package is the name shown for the package, Name the one its
+	// package.json declares, empty when Package is derived from its
+	// directory.
+	Package string `json:"package"`
+	Name    string `json:"name"`
+	// Version is the package version, empty when package.json has none.
+	Version string `json:"version"`
+	Script  string `json:"script"`
+	Command string `json:"command"`
+	Path    string `json:"path"`
+	// PackageManager is the inferred one, --pm is not applied.
+	PackageManager string `json:"packageManager,omitempty"`
+	// Implicit is set for npm's default start script.
+	Implicit bool `json:"implicit,omitempty"`
+	// Source tells how the scan found the package: walk, workspace-root,
+	// workspace or dependency.
+	Source string `json:"source,omitempty"`
+	// Hidden is set for scripts hidden by their package.json, listed
+	// with --show-hidden.
+	Hidden bool `json:"hidden,omitempty"`
+	// Incompatible names the os and cpu fields that exclude this system,
+	// like "os linux".
+	Incompatible string `json:"incompatible,omitempty"`
+	// LastRun is the latest run with a recorded outcome.
+	LastRun *jsonLastRun `json:"lastRun,omitempty"`
+}
+
+type jsonLastRun struct {
+	Time       time.Time `json:"time"`
+	DurationMS int64     `json:"durationMs"`
+	ExitCode   int       `json:"exitCode"`
+}
+
+func newJSONScript(script discover.NpmScript) jsonScript {
+	out := jsonScript{
+		ID:             script.ID(),
+		Package:        script.PackageName,
+		Name:           script.DeclaredName(),
+		Version:        script.PackageVersion,
+		Script:         script.ScriptName,
+		Command:        script.Command,
+		Path:           script.AbsolutePath,
+		PackageManager: script.PackageManager,
+		Implicit:       script.Implicit,
+		Source:         script.Source,
+		Hidden:         script.Hidden,
+		Incompatible:   script.Incompatible,
+	}
+	if entry, ok := lastOutcome(script); ok {
+		out.LastRun = &jsonLastRun{Time: entry.Time, DurationMS: entry.DurationMS, ExitCode: *entry.ExitCode}
+	}
+	return out
+}
+
+// Formats accepted by --format.
+const (
+	formatList = "list"
+	formatJSON = "json"
+	formatTSV  = "tsv"
+)
+
+var formats = []string{formatList, formatJSON, formatTSV}
+
+// tsvColumns are the fields --columns can pick for --format tsv, taken
+// from the --json representation.
+var tsvColumns = map[string]func(jsonScript) string{
+	"id":      func(s jsonScript) string { return s.ID },
+	"package": func(s jsonScript) string { return s.Package },
+	"name":    func(s jsonScript) string { return s.Name },
+	"version": func(s jsonScript) string { return s.Version },
+	"script":  func(s jsonScript) string { return s.Script },
+	"command": func(s jsonScript) string { return s.Command },
+	"path":    func(s jsonScript) string { return s.Path },
+	"dir":     func(s jsonScript) string { return filepath.Dir(s.Path) },
+	"pm":      func(s jsonScript) string { return s.PackageManager },
+}
+
+var defaultTSVColumns = []string{"package", "script", "command"}
+
+// tsvEscaper keeps every value on one line and in one column. Backslashes
+// are escaped first so the output can be unescaped unambiguously.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// printTSV writes one script per line with the tab separated columns,
+// preceded by a line with the column names when header is set.
+func printTSV(w io.Writer, scripts []discover.NpmScript, columns []string, header bool) {
+	if header {
+		fmt.Fprintln(w, strings.Join(columns, "\t"))
+	}
+	values := make([]string, len(columns))
+	for _, script := range scripts {
+		s := newJSONScript(script)
+		for i, column := range columns {
+			values[i] = tsvEscaper.Replace(tsvColumns[column](s))
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+}
+
+// printJSON writes all scripts as a JSON array.
+func printJSON(w io.Writer, scripts []discover.NpmScript) error {
+	out := make([]jsonScript, 0, len(scripts))
+	for _, script := range scripts {
+		out = append(out, newJSONScript(script))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
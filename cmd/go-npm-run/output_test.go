@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// TestPrintList checks that --list escapes its fields and only has a
+// version column for packages with a version.
+func TestPrintList(t *testing.T) {
+	t.Parallel()
+	scripts := []discover.NpmScript{
+		{PackageName: "web", ScriptName: "dev", Command: "vite\t--open", AbsolutePath: "/repo/web/package.json", PackageVersion: "1.4.0"},
+		{PackageName: "api", ScriptName: "start", Command: "node a.js \\\n  --port 1", AbsolutePath: "/repo/api/package.json"},
+	}
+	tests := []struct {
+		versions bool
+		want     [][]string
+	}{
+		{true, [][]string{
+			{"web > (dev)", `vite\t--open`, scripts[0].ID(), "1.4.0"},
+			{"api > (start)", `node a.js \\\n  --port 1`, scripts[1].ID()},
+		}},
+		{false, [][]string{
+			{"web > (dev)", `vite\t--open`, scripts[0].ID()},
+			{"api > (start)", `node a.js \\\n  --port 1`, scripts[1].ID()},
+		}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		printList(&buf, scripts, tt.versions)
+		var want []string
+		for _, fields := range tt.want {
+			want = append(want, strings.Join(fields, "\t"))
+		}
+		if got, want := buf.String(), strings.Join(want, "\n")+"\n"; got != want {
+			t.Errorf("printList(versions %v) =\n%q\nwant\n%q", tt.versions, got, want)
+		}
+	}
+}
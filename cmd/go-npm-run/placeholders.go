@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// placeholderPattern matches {{name}} placeholders in a script body.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// envRefPattern matches $VAR and ${VAR} references in a script body.
+var envRefPattern = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`)
+
+// scriptPlaceholders returns the distinct {{name}} placeholders in command,
+// in the order they first appear.
+func scriptPlaceholders(command string) []string {
+	return uniqueSubmatches(placeholderPattern, command)
+}
+
+// unsetEnvReferences returns the $VAR references in command that are not
+// set in the environment.
+func unsetEnvReferences(command string) []string {
+	var unset []string
+	for _, name := range uniqueSubmatches(envRefPattern, command) {
+		if _, ok := os.LookupEnv(name); !ok {
+			unset = append(unset, name)
+		}
+	}
+	return unset
+}
+
+func uniqueSubmatches(re *regexp.Regexp, s string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range re.FindAllStringSubmatch(s, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// substitutePlaceholders replaces every {{name}} in command with its value.
+func substitutePlaceholders(command string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(command, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		return values[name]
+	})
+}
+
+// promptValues asks for every name missing from known and returns all
+// values. Prompts go to stderr so stdout stays clean for --print.
+func promptValues(names []string, known map[string]string) (map[string]string, error) {
+	values := map[string]string{}
+	var reader *bufio.Reader
+	for _, name := range names {
+		if value, ok := known[name]; ok {
+			values[name] = value
+			continue
+		}
+		if reader == nil {
+			reader = bufio.NewReader(os.Stdin)
+		}
+		fmt.Fprintf(os.Stderr, "%s: ", name)
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, fmt.Errorf("reading value for %s: %w", name, err)
+		}
+		values[name] = strings.TrimRight(line, "\r\n")
+	}
+	return values, nil
+}
+
+// fillPlaceholders prompts for the placeholders in inv's script, reusing
+// values replayed from history, and applies the answers to inv. {{name}}
+// values are substituted into the script body, which then runs through the
+// shell; $VAR values, with --prompt-env, are passed in the environment.
+// Scripts without placeholders are left untouched and nil is returned.
+func fillPlaceholders(inv *invocation, opts *options) (map[string]string, error) {
+	names := scriptPlaceholders(inv.Script.Command)
+	var envNames []string
+	if opts.promptEnv {
+		for _, name := range unsetEnvReferences(inv.Script.Command) {
+			// Set by the package manager itself when the script runs, or
+			// by an env file
+			if !strings.HasPrefix(name, "npm_") && !inv.HasEnv(name) {
+				envNames = append(envNames, name)
+			}
+		}
+	}
+	if len(names) == 0 && len(envNames) == 0 {
+		return nil, nil
+	}
+
+	values, err := promptValues(append(names, envNames...), opts.values)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range envNames {
+		inv.Env = append(inv.Env, name+"="+values[name])
+	}
+	if len(names) > 0 {
+		inv.RunInShell(substitutePlaceholders(inv.Script.Command, values), opts.scriptArgs, "placeholders substituted")
+	}
+	return values, nil
+}
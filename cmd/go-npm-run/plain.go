@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// usePlain reports whether the picker has to be the plain numbered menu:
+// with --plain, or in a terminal that cannot draw a full-screen finder.
+func usePlain(opts *options) bool {
+	return opts.plain || os.Getenv("TERM") == "dumb"
+}
+
+// pickPlain prints items as a numbered menu to w and reads the choice
+// from r: a number, or part of a label, case-insensitive. A part matching
+// several labels lists those and asks again, numbers then refer to the
+// shorter list. query narrows the first menu like a typed part would. An
+// empty line or the end of r picks nothing.
+func pickPlain(r io.Reader, w io.Writer, items []pickerItem, query string) (int, error) {
+	shown := make([]int, len(items))
+	for i := range shown {
+		shown[i] = i
+	}
+	if matches := matchPlain(items, query); query != "" && len(matches) > 0 {
+		shown = matches
+	}
+	if pickerInfo != "" {
+		fmt.Fprintln(w, pickerInfo)
+	}
+	printPlain(w, items, shown)
+	for {
+		fmt.Fprintf(w, "Number or part of a name (empty to cancel): ")
+		line, err := readLine(r)
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil {
+				fmt.Fprintln(w)
+			}
+			return -1, fuzzyfinder.ErrAbort
+		}
+
+		if n, convErr := strconv.Atoi(line); convErr == nil {
+			if n >= 1 && n <= len(shown) {
+				return shown[n-1], nil
+			}
+			fmt.Fprintf(w, "No entry %d, expected 1 to %d.\n", n, len(shown))
+		} else {
+			switch matches := matchPlain(items, line); len(matches) {
+			case 0:
+				fmt.Fprintf(w, "Nothing matches %q.\n", line)
+			case 1:
+				return matches[0], nil
+			default:
+				fmt.Fprintf(w, "%d entries match %q:\n", len(matches), line)
+				shown = matches
+				printPlain(w, items, shown)
+			}
+		}
+		if err != nil {
+			return -1, fuzzyfinder.ErrAbort
+		}
+	}
+}
+
+// matchPlain returns the indices of the items whose label contains part,
+// ignoring case.
+func matchPlain(items []pickerItem, part string) []int {
+	part = strings.ToLower(part)
+	var matches []int
+	for i, item := range items {
+		if strings.Contains(strings.ToLower(item.label), part) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// printPlain prints the shown items numbered from 1.
+func printPlain(w io.Writer, items []pickerItem, shown []int) {
+	width := len(strconv.Itoa(len(shown)))
+	for n, i := range shown {
+		fmt.Fprintf(w, "%*d) %s\n", width, n+1, items[i].label)
+	}
+}
+
+// readLine reads up to the next newline one byte at a time, so that
+// nothing after it is consumed from stdin before the script runs.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
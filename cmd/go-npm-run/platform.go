@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// errIncompatible is why --all skips a package whose os or cpu fields
+// exclude this system. It does not count as a failure.
+var errIncompatible = errors.New("incompatible platform")
+
+// incompatible reports whether script has to be treated as unable to run
+// here, which --ignore-platform turns off.
+func incompatible(opts *options, script discover.NpmScript) bool {
+	return script.Incompatible != "" && !opts.ignorePlatform
+}
+
+// platformNote tells what keeps script from running here, for the preview
+// and the confirmation.
+func platformNote(script discover.NpmScript) string {
+	os, cpu := discover.Platform()
+	return fmt.Sprintf("package.json declares %s, this system is %s %s", script.Incompatible, os, cpu)
+}
+
+// confirmPlatform asks before any of invocations runs in a package whose
+// os or cpu fields exclude this system, and exits unless the user agrees.
+// Without a terminal to ask on go-npm-run refuses to run them. It has to
+// be called before anything is started.
+func confirmPlatform(opts *options, invocations []invocation) {
+	var reader *bufio.Reader
+	for _, inv := range invocations {
+		if !incompatible(opts, inv.Script) {
+			continue
+		}
+		if !isTerminal(os.Stdin) {
+			fmt.Fprintf(os.Stderr, "Error: %s: %s, pass --ignore-platform to run it anyway\n", inv.Script.Label(), platformNote(inv.Script))
+			os.Exit(exitFailure)
+		}
+		if reader == nil {
+			reader = bufio.NewReader(os.Stdin)
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: %s.\nRun it anyway? [y/N] ", paint(colorRed, "!"), inv.Script.Label(), platformNote(inv.Script))
+		answer, _ := reader.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			if answer == "" {
+				fmt.Fprintln(os.Stderr)
+			}
+			fmt.Fprintln(os.Stderr, "Error: not confirmed, nothing was run")
+			os.Exit(exitFailure)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// killGrace is how long a script gets to exit after being asked to stop
+// before its whole process group is killed.
+const killGrace = 5 * time.Second
+
+// stopProcess sends sig to the process group of cmd and kills the group if
+// it is still alive after grace. done must be closed once cmd has been
+// waited for.
+func stopProcess(cmd *exec.Cmd, sig os.Signal, done <-chan struct{}, grace time.Duration) {
+	if cmd.Process == nil {
+		return
+	}
+	signalProcessGroup(cmd, sig)
+	select {
+	case <-done:
+	case <-time.After(grace):
+		debugf("%s did not exit within %s, killing it", cmd.Path, grace)
+		killProcessGroup(cmd)
+		<-done
+	}
+}
@@ -0,0 +1,111 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// platformEnvKeys are the variables --clean-env passes on besides
+// cleanEnvKeys, none are needed on Unix.
+var platformEnvKeys []string
+
+// setProcessGroup makes cmd the leader of a new process group, so that the
+// whole tree it spawns can be signalled at once.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setForegroundProcessGroup starts cmd in a new process group. When
+// go-npm-run is the terminal's foreground job, that group takes over the
+// terminal, so Ctrl-C and interactive input reach the script's whole tree.
+// The returned function hands the terminal back and must be called once
+// cmd has exited.
+func setForegroundProcessGroup(cmd *exec.Cmd) (restore func()) {
+	setProcessGroup(cmd)
+	tty := int(os.Stdin.Fd())
+	pgrp, err := unix.IoctlGetInt(tty, unix.TIOCGPGRP)
+	if err != nil || pgrp != syscall.Getpgrp() {
+		// No terminal, or running in the background: nothing to hand over
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = tty
+	return func() {
+		// Taking the terminal back from the background raises SIGTTOU
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		if err := unix.IoctlSetPointerInt(tty, unix.TIOCSPGRP, pgrp); err != nil {
+			debugf("cannot restore the terminal's foreground process group: %v", err)
+		}
+	}
+}
+
+// ownsProcessGroup reports whether cmd leads its own process group, either
+// from setProcessGroup or as the leader of a new session.
+func ownsProcessGroup(cmd *exec.Cmd) bool {
+	return cmd.SysProcAttr != nil && (cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Setsid)
+}
+
+// signalProcessGroup sends sig to the process group of a command started
+// with setProcessGroup, or only to the command itself otherwise.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) {
+	s, ok := sig.(syscall.Signal)
+	if ok && ownsProcessGroup(cmd) {
+		_ = syscall.Kill(-cmd.Process.Pid, s)
+		return
+	}
+	_ = cmd.Process.Signal(sig)
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	signalProcessGroup(cmd, syscall.SIGKILL)
+}
+
+// killStragglers terminates what is left of the process group of a command
+// started with setProcessGroup after the command itself exited, e.g. a
+// server a script started in the background, killing it after grace.
+func killStragglers(cmd *exec.Cmd, grace time.Duration) {
+	if !ownsProcessGroup(cmd) {
+		return
+	}
+	pgid := -cmd.Process.Pid
+	if syscall.Kill(pgid, syscall.SIGTERM) != nil {
+		// The group is gone already
+		return
+	}
+	debugf("terminating processes left behind by %s", cmd.Path)
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+		if syscall.Kill(pgid, 0) != nil {
+			return
+		}
+	}
+	_ = syscall.Kill(pgid, syscall.SIGKILL)
+}
+
+// replaceProcess replaces go-npm-run with inv, which takes over its PID. It
+// only returns when the exec failed.
+func replaceProcess(inv invocation) error {
+	cmd := inv.Command()
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if err := os.Chdir(cmd.Dir); err != nil {
+		return err
+	}
+	return syscall.Exec(cmd.Path, cmd.Args, env)
+}
@@ -0,0 +1,54 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// platformEnvKeys are the variables --clean-env passes on besides
+// cleanEnvKeys, as Windows programs and node itself fail without them.
+var platformEnvKeys = []string{"SYSTEMROOT", "SYSTEMDRIVE", "COMSPEC", "PATHEXT", "WINDIR", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA"}
+
+// setProcessGroup starts cmd in a new process group so console signals
+// aimed at go-npm-run are not delivered to it directly.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// setForegroundProcessGroup leaves cmd in go-npm-run's console group, a new
+// group would stop Ctrl-C from reaching it. The process tree is still
+// stopped as a whole by taskkill /T.
+func setForegroundProcessGroup(cmd *exec.Cmd) (restore func()) {
+	return func() {}
+}
+
+// signalProcessGroup asks the process tree of cmd to exit with taskkill /T,
+// windows has no signals to forward.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) {
+	_ = exec.Command("taskkill", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+// killStragglers does nothing on windows, once cmd exited its children can
+// no longer be found through it.
+func killStragglers(cmd *exec.Cmd, grace time.Duration) {}
+
+// replaceProcess is not possible on windows, the script runs as a child
+// process like without --exec.
+func replaceProcess(inv invocation) error {
+	infof("--exec is not supported on windows, running %s as a child process", inv.Script.ScriptName)
+	runScript(inv)
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// startInPTY starts cmd with a new pseudo terminal as its controlling
+// terminal, stdin, stdout and stderr, sized like go-npm-run's terminal and
+// resized along with it. Everything the script writes is copied to stdout
+// and stdin, unless nil, is copied to the script; a terminal stdin is put
+// in raw mode meanwhile so keys reach the script unprocessed.
+// The script leads a new session, which is also its process group. finish
+// must be called once cmd was waited for, it waits for the remaining
+// output.
+func startInPTY(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer) (finish func(), err error) {
+	master, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+	if err := pty.InheritSize(os.Stdout, master); err != nil {
+		debugf("cannot size the pty: %v", err)
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// Ctty is the child's fd 0, the terminal
+	cmd.SysProcAttr.Setsid, cmd.SysProcAttr.Setctty = true, true
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	restoreInput := func() {}
+	if stdin != nil {
+		if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			if state, err := term.MakeRaw(int(f.Fd())); err == nil {
+				restoreInput = func() { _ = term.Restore(int(f.Fd()), state) }
+			}
+		}
+		go func() {
+			_, _ = io.Copy(master, stdin)
+		}()
+	}
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	go func() {
+		for range resize {
+			_ = pty.InheritSize(os.Stdout, master)
+		}
+	}()
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		// Reading fails with EIO once every process closed the terminal
+		_, _ = io.Copy(stdout, master)
+	}()
+	return func() {
+		signal.Stop(resize)
+		close(resize)
+		restoreInput()
+		<-copied
+		master.Close()
+	}, nil
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// startInPTY is not supported on windows, scripts keep plain pipes.
+func startInPTY(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer) (finish func(), err error) {
+	return nil, errors.New("pseudo terminals are not supported on windows")
+}
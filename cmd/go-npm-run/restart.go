@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// restartMode is the value of --restart. Like printMode it works as a bare
+// boolean flag, while --restart=on-failure only relaunches failed runs.
+type restartMode string
+
+const (
+	restartNever     restartMode = ""
+	restartAlways    restartMode = "always"
+	restartOnFailure restartMode = "on-failure"
+)
+
+func (m *restartMode) String() string { return string(*m) }
+
+func (m *restartMode) IsBoolFlag() bool { return true }
+
+func (m *restartMode) Set(value string) error {
+	switch value {
+	case "true", "always":
+		*m = restartAlways
+	case "on-failure":
+		*m = restartOnFailure
+	case "false":
+		*m = restartNever
+	default:
+		return fmt.Errorf("expected --restart or --restart=on-failure")
+	}
+	return nil
+}
+
+// Backoff between relaunches with --restart. A run that lasted longer than
+// restartMaxBackoff counts as healthy and resets the delay.
+const (
+	restartMinBackoff = time.Second
+	restartMaxBackoff = 30 * time.Second
+)
+
+// superviseScript keeps inv running, relaunching it whenever it exits, or
+// with on-failure only when it failed. The delay before a relaunch doubles
+// every time, up to restartMaxBackoff. Ctrl-C stops the running script like
+// in runScript, and during the delay ends the loop right away.
+func superviseScript(inv invocation, mode restartMode) {
+	signals := make(chan os.Signal, 1)
+	backoff := restartMinBackoff
+	for restarts := 0; ; restarts++ {
+		start := time.Now()
+		code, err := execScript(context.Background(), inv, os.Stdin, os.Stdout, os.Stderr)
+		if err != nil && !errors.Is(err, errTimedOut) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		if code == 0 && mode == restartOnFailure {
+			return
+		}
+		if time.Since(start) > restartMaxBackoff {
+			backoff = restartMinBackoff
+		}
+
+		infof("==> %s exited with code %d, restart #%d in %s", inv.Script.Label(), code, restarts+1, backoff)
+		signal.Notify(signals, forwardedSignals...)
+		select {
+		case sig := <-signals:
+			os.Exit(signalExitCode(sig))
+		case <-time.After(backoff):
+		}
+		signal.Stop(signals)
+		if backoff *= 2; backoff > restartMaxBackoff {
+			backoff = restartMaxBackoff
+		}
+	}
+}
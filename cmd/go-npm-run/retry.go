@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// runAttempts runs inv like execScript and runs it again, up to
+// inv.retries more times, while it fails. inv.retryDelay is waited between
+// attempts and every retry starts with a header on stderr. The result is
+// that of the last attempt, attempts is how many were made. A script that
+// could not be started or whose ctx was cancelled is not retried.
+func runAttempts(ctx context.Context, inv invocation, stdin io.Reader, stdout, stderr io.Writer) (code, attempts int, err error) {
+	total := inv.retries + 1
+	for attempts = 1; ; attempts++ {
+		code, err = execScript(ctx, inv, stdin, stdout, stderr)
+		if code == 0 && err == nil || attempts == total || ctx.Err() != nil {
+			return code, attempts, err
+		}
+		if err != nil && !errors.Is(err, errTimedOut) {
+			return code, attempts, err
+		}
+		if inv.retryDelay > 0 {
+			select {
+			case <-ctx.Done():
+				return code, attempts, err
+			case <-time.After(inv.retryDelay):
+			}
+		}
+		if !quiet {
+			fmt.Fprintf(stderr, "==> attempt %d/%d of %s\n", attempts+1, total, inv.Script.Label())
+		}
+	}
+}
+
+// attemptsNote describes how many attempts a run with retries needed, or
+// returns "" when retries were not enabled.
+func attemptsNote(inv invocation, attempts int) string {
+	if inv.retries == 0 {
+		return ""
+	}
+	return fmt.Sprintf("attempt %d/%d", attempts, inv.retries+1)
+}
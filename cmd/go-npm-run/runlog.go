@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// logTarget is the value of --log. It behaves like a boolean flag so that a
+// bare --log picks a file name, while --log=path names the file.
+type logTarget string
+
+// logAuto is the logTarget of a bare --log.
+const logAuto logTarget = "\x00auto"
+
+func (t *logTarget) String() string { return string(*t) }
+
+func (t *logTarget) IsBoolFlag() bool { return true }
+
+func (t *logTarget) Set(value string) error {
+	switch value {
+	case "true":
+		*t = logAuto
+	case "false":
+		*t = ""
+	default:
+		*t = logTarget(value)
+	}
+	return nil
+}
+
+// logFilePath returns the file the output of script is logged to for
+// target. A bare --log writes to a new file in the logs directory of the
+// project, named after the time, package and script.
+func logFilePath(target logTarget, script discover.NpmScript, now time.Time) (string, error) {
+	if target != logAuto {
+		return filepath.Abs(string(target))
+	}
+	dir, err := logsDir(filepath.Dir(script.AbsolutePath))
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s-%s.log", now.Format("20060102-150405"), logNamePart(script.PackageName), logNamePart(script.ScriptName))
+	return filepath.Join(dir, name), nil
+}
+
+// logsDir returns the directory under the user cache directory that keeps
+// the logs of the project dir belongs to. Projects are told apart by the
+// name and a hash of their root.
+func logsDir(dir string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	root := discover.ProjectRoot(dir)
+	sum := sha256.Sum256([]byte(root))
+	project := logNamePart(filepath.Base(root)) + "-" + hex.EncodeToString(sum[:4])
+	return filepath.Join(cache, "go-npm-run", "logs", project), nil
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// logNamePart makes s usable in a file name, "@scope/pkg" becomes
+// "scope-pkg".
+func logNamePart(s string) string {
+	s = strings.Trim(unsafeNameChars.ReplaceAllString(s, "-"), "-.")
+	if s == "" {
+		return "script"
+	}
+	return s
+}
+
+// scriptLog is the --log file of one run. Both output streams of the
+// script are written to it between a header and a footer.
+type scriptLog struct {
+	path  string
+	file  *os.File
+	mu    sync.Mutex
+	out   io.Writer
+	start time.Time
+}
+
+// openScriptLog appends the header for inv to its log file, creating the
+// file and its directory as needed.
+func openScriptLog(inv invocation) (*scriptLog, error) {
+	if err := os.MkdirAll(filepath.Dir(inv.logPath), 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create log: %w", err)
+	}
+	file, err := os.OpenFile(inv.logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create log: %w", err)
+	}
+	l := &scriptLog{path: inv.logPath, file: file, out: file, start: time.Now()}
+	if inv.logStripANSI {
+		l.out = &ansiStripper{w: file}
+	}
+	dir, err := filepath.Abs(inv.Dir)
+	if err != nil {
+		dir = inv.Dir
+	}
+	fmt.Fprintf(file, "# %s\n# command: %s\n# directory: %s\n# started: %s\n\n", inv.Script.Label(), inv.displayName(), dir, l.start.Format(time.RFC3339))
+	return l, nil
+}
+
+// tee returns a writer copying everything written to w into the log.
+func (l *scriptLog) tee(w io.Writer) io.Writer {
+	return io.MultiWriter(w, logWriter{l})
+}
+
+// close writes the footer with the outcome of the run and closes the file.
+func (l *scriptLog) close(code int, err error) {
+	status := fmt.Sprintf("exit code %d", code)
+	if err != nil {
+		status = err.Error()
+	}
+	fmt.Fprintf(l.file, "\n# finished: %s after %s\n", status, time.Since(l.start).Round(time.Millisecond))
+	l.file.Close()
+}
+
+// logWriter serializes the writes of both output streams to the log.
+type logWriter struct{ l *scriptLog }
+
+func (w logWriter) Write(data []byte) (int, error) {
+	w.l.mu.Lock()
+	defer w.l.mu.Unlock()
+	if _, err := w.l.out.Write(data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// ansiStripper drops ANSI escape sequences, which may be split across
+// writes, on the way to w.
+type ansiStripper struct {
+	w     io.Writer
+	state int
+}
+
+// ansiStripper states.
+const (
+	ansiText = iota
+	ansiEscape
+	ansiCSI
+	ansiOSC
+	ansiOSCEscape
+)
+
+func (s *ansiStripper) Write(data []byte) (int, error) {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		switch s.state {
+		case ansiText:
+			if b == 0x1b {
+				s.state = ansiEscape
+			} else {
+				out = append(out, b)
+			}
+		case ansiEscape:
+			switch b {
+			case '[':
+				s.state = ansiCSI
+			case ']':
+				s.state = ansiOSC
+			default:
+				// Two byte sequences like ESC ( B or ESC =
+				if b < 0x20 || b > 0x2f {
+					s.state = ansiText
+				}
+			}
+		case ansiCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = ansiText
+			}
+		case ansiOSC:
+			switch b {
+			case 0x07:
+				s.state = ansiText
+			case 0x1b:
+				s.state = ansiOSCEscape
+			}
+		case ansiOSCEscape:
+			s.state = ansiText
+		}
+	}
+	if _, err := s.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
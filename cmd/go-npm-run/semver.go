@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a major.minor.patch version. Prerelease and build suffixes are
+// ignored, they do not matter for node version checks.
+type semver [3]int
+
+func (v semver) less(w semver) bool {
+	for i := range v {
+		if v[i] != w[i] {
+			return v[i] < w[i]
+		}
+	}
+	return false
+}
+
+// parseSemver parses a full or partial version such as "v20", "20.1" or
+// "20.11.1". parts is the number of components given, wildcards like "x"
+// and "*" end the version early.
+func parseSemver(s string) (v semver, parts int, err error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "="), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" || s == "*" || s == "x" || s == "X" {
+		return v, 0, nil
+	}
+	for i, field := range strings.Split(s, ".") {
+		if i == len(v) {
+			return v, 0, fmt.Errorf("invalid version %q", s)
+		}
+		if field == "x" || field == "X" || field == "*" {
+			break
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return v, 0, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+		parts++
+	}
+	return v, parts, nil
+}
+
+// bump returns the smallest version above every version matching the
+// first parts components of v, e.g. 20.1 -> 20.2.0.
+func bump(v semver, parts int) semver {
+	var next semver
+	copy(next[:], v[:parts])
+	next[parts-1]++
+	return next
+}
+
+// versionBounds is a half open range [min, max), max unset means unbounded.
+type versionBounds struct {
+	min, max semver
+	hasMax   bool
+}
+
+func (b *versionBounds) atLeast(v semver) {
+	if b.min.less(v) {
+		b.min = v
+	}
+}
+
+func (b *versionBounds) below(v semver) {
+	if !b.hasMax || v.less(b.max) {
+		b.max, b.hasMax = v, true
+	}
+}
+
+func (b versionBounds) contains(v semver) bool {
+	return !v.less(b.min) && (!b.hasMax || v.less(b.max))
+}
+
+// satisfiesRange reports whether v matches the npm style range rng, e.g.
+// ">=18 <21", "^20", "~20.1", "18 || 20", "18.2 - 20" or "20.11.1".
+func satisfiesRange(v semver, rng string) (bool, error) {
+	for _, alternative := range strings.Split(rng, "||") {
+		bounds, err := parseComparators(alternative)
+		if err != nil {
+			return false, err
+		}
+		if bounds.contains(v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func parseComparators(set string) (versionBounds, error) {
+	var bounds versionBounds
+	fields := strings.Fields(set)
+	// Hyphen range: "a - b"
+	if len(fields) == 3 && fields[1] == "-" {
+		lo, _, err := parseSemver(fields[0])
+		if err != nil {
+			return bounds, err
+		}
+		hi, parts, err := parseSemver(fields[2])
+		if err != nil {
+			return bounds, err
+		}
+		bounds.atLeast(lo)
+		if parts > 0 {
+			bounds.below(bump(hi, parts))
+		}
+		return bounds, nil
+	}
+
+	// Operators may be separated from the version, ">= 18"
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if strings.Trim(field, "<>=^~") == "" && i+1 < len(fields) {
+			field += fields[i+1]
+			i++
+		}
+		op := field[:len(field)-len(strings.TrimLeft(field, "<>=^~"))]
+		if op == field {
+			return bounds, fmt.Errorf("comparator %q has no version", field)
+		}
+		v, parts, err := parseSemver(field[len(op):])
+		if err != nil {
+			return bounds, err
+		}
+		if parts == 0 {
+			// "*" or "x" matches everything
+			continue
+		}
+		switch op {
+		case "", "=":
+			bounds.atLeast(v)
+			bounds.below(bump(v, parts))
+		case ">=":
+			bounds.atLeast(v)
+		case ">":
+			bounds.atLeast(bump(v, parts))
+		case "<":
+			bounds.below(v)
+		case "<=":
+			bounds.below(bump(v, parts))
+		case "~", "~>":
+			bounds.atLeast(v)
+			bounds.below(bump(v, min(parts, 2)))
+		case "^":
+			bounds.atLeast(v)
+			// The first non-zero component may not change
+			significant := 1
+			for significant < parts && v[significant-1] == 0 {
+				significant++
+			}
+			bounds.below(bump(v, significant))
+		default:
+			return bounds, fmt.Errorf("invalid comparator %q", field)
+		}
+	}
+	return bounds, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestSatisfiesRange(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		version string
+		rng     string
+		want    bool
+	}{
+		{"20.11.1", ">=18 <21", true},
+		{"21.0.0", ">=18 <21", false},
+		{"17.9.0", ">=18 <21", false},
+		{"18.0.0", ">= 18 < 21", true},
+		{"20.11.1", "^20", true},
+		{"21.0.0", "^20", false},
+		{"20.11.1", "^20.12", false},
+		{"20.11.1", "20.11.1", true},
+		{"20.11.2", "20.11.1", false},
+		{"20.11.1", "=v20.11.1", true},
+		{"20.5.0", "20", true},
+		{"0.2.9", "^0.2.3", true},
+		{"0.3.0", "^0.2.3", false},
+		{"0.0.4", "^0.0.3", false},
+		{"0.9.0", "^0.x", true},
+		{"1.0.0", "^0.x", false},
+		{"20.1.9", "~20.1", true},
+		{"20.2.0", "~20.1.3", false},
+		{"20.9.0", "~20", true},
+		{"20.0.0", ">19.2", true},
+		{"19.2.5", ">19.2", false},
+		{"19.2.5", "<=19.2", true},
+		{"19.3.0", "<=19.2", false},
+		{"19.0.0", "18.2 - 20", true},
+		{"20.9.9", "18.2 - 20", true},
+		{"21.0.0", "18.2 - 20", false},
+		{"18.1.0", "18.2 - 20", false},
+		{"16.0.0", "14 || 16 || >=18", true},
+		{"17.0.0", "14 || 16 || >=18", false},
+		{"22.0.0", "14 || 16 || >=18", true},
+		{"22.0.0", "*", true},
+		{"22.0.0", "20.x || 22.x", true},
+	}
+	for _, tt := range tests {
+		v, _, err := parseSemver(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := satisfiesRange(v, tt.rng)
+		if err != nil {
+			t.Errorf("satisfiesRange(%s, %q) error: %v", tt.version, tt.rng, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("satisfiesRange(%s, %q) = %v, want %v", tt.version, tt.rng, got, tt.want)
+		}
+	}
+}
+
+func TestSatisfiesRangeInvalid(t *testing.T) {
+	t.Parallel()
+	for _, rng := range []string{">=18 <", "^", "node", "!=20", "1.2.3.4"} {
+		if _, err := satisfiesRange(semver{20, 0, 0}, rng); err == nil {
+			t.Errorf("satisfiesRange(%q) succeeded, want an error", rng)
+		}
+	}
+}
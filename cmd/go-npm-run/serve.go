@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// serveProtocol is the version of the --serve protocol announced in the
+// hello event. It changes whenever a message changes incompatibly.
+const serveProtocol = 1
+
+// serveUsage documents the --serve protocol in --help.
+const serveUsage = `
+Serve protocol (version 1):
+  --serve scans once and then reads one JSON request per line on stdin until
+  EOF, answering with one JSON message per line on stdout. It starts with
+  {"event":"hello","protocol":1,"version":"..."}. Requests carry an optional
+  "id" that is copied to the response, which holds "result" or "error".
+    {"id":1,"method":"list"}     result: {"scripts":[...]} as in --json
+    {"id":2,"method":"refresh"}  scan again, result like list
+    {"id":3,"method":"run","package":"apps/web","script":"dev","args":[],
+     "output":true,"yes":false}  result: {"run":1}
+    {"id":4,"method":"cancel","run":1}
+  package is a package.json path, a package directory or a package name, it
+  may be left out when the script name is unique.
+  Runs emit {"event":"started","run":1,...}, with "output" set
+  {"event":"output","run":1,"stream":"stdout","data":"..."} and finally
+  {"event":"exit","run":1,"code":0,"durationMs":12,"error":"..."}.
+  At EOF running scripts are interrupted and waited for.
+`
+
+// serveRequest is one line read in --serve mode.
+type serveRequest struct {
+	ID      any      `json:"id,omitempty"`
+	Method  string   `json:"method"`
+	Package string   `json:"package,omitempty"`
+	Script  string   `json:"script,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Output  bool     `json:"output,omitempty"`
+	Yes     bool     `json:"yes,omitempty"`
+	Run     int      `json:"run,omitempty"`
+}
+
+// serveMessage is a response or an event written in --serve mode.
+type serveMessage struct {
+	ID     any    `json:"id,omitempty"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	Event    string      `json:"event,omitempty"`
+	Protocol int         `json:"protocol,omitempty"`
+	Version  string      `json:"version,omitempty"`
+	Run      int         `json:"run,omitempty"`
+	Script   *jsonScript `json:"script,omitempty"`
+	Stream   string      `json:"stream,omitempty"`
+	Data     string      `json:"data,omitempty"`
+	Code     *int        `json:"code,omitempty"`
+	Duration *int64      `json:"durationMs,omitempty"`
+}
+
+// server is the state of --serve: the scanned scripts and the running
+// scripts, which are cancelled through their contexts.
+type server struct {
+	opts        *options
+	scriptCache *discover.ScriptCache
+	scripts     []discover.NpmScript
+
+	mu      sync.Mutex
+	enc     *json.Encoder
+	nextRun int
+	runs    map[int]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// serve runs the --serve protocol on stdin and stdout, see serveUsage.
+func serve(opts *options, scriptCache *discover.ScriptCache) {
+	s := &server{opts: opts, scriptCache: scriptCache, enc: json.NewEncoder(os.Stdout), runs: map[int]context.CancelFunc{}}
+	s.enc.SetEscapeHTML(false)
+	v, _, _ := buildInfo()
+	s.send(serveMessage{Event: "hello", Protocol: serveProtocol, Version: v})
+	s.scan()
+
+	// Ctrl-C ends the session like EOF does
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case line, ok := <-lines:
+			if !ok {
+				break loop
+			}
+			s.handle(line)
+		}
+	}
+
+	s.mu.Lock()
+	for _, cancel := range s.runs {
+		cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// send writes msg as one line of JSON.
+func (s *server) send(msg serveMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(msg); err != nil {
+		debugf("cannot write to the client: %v", err)
+	}
+}
+
+// scan discovers the scripts like the picker would see them.
+func (s *server) scan() {
+	scripts := discover.ExtractScripts(context.Background(), discover.FindPackages(context.Background(), s.opts.searchPath))
+	s.scriptCache.Save()
+	if s.opts.workspacesOnly {
+		scripts = workspaceScripts(scripts, s.opts.searchPath)
+	}
+	scripts = excludePackages(scripts, s.opts.excludePackages, s.opts.searchPath)
+	if len(s.opts.scopes) > 0 {
+		scripts = scopeScripts(scripts, s.opts.scopes)
+	}
+	if len(s.opts.only) > 0 {
+		scripts, _ = onlyScripts(scripts, s.opts.only)
+	}
+	scripts = excludeScripts(scripts, s.opts.exclude)
+	history := loadHistory()
+	lastOutcomes = finishedRuns(history)
+	sortScripts(scripts, s.opts.sort, history)
+	s.scripts = scripts
+}
+
+func (s *server) listResult() any {
+	out := make([]jsonScript, 0, len(s.scripts))
+	for _, script := range s.scripts {
+		out = append(out, newJSONScript(script))
+	}
+	return map[string]any{"scripts": out}
+}
+
+// handle answers one request line.
+func (s *server) handle(line []byte) {
+	var req serveRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.send(serveMessage{Error: "invalid request: " + err.Error()})
+		return
+	}
+	switch req.Method {
+	case "list":
+		s.send(serveMessage{ID: req.ID, Result: s.listResult()})
+	case "refresh":
+		s.scan()
+		s.send(serveMessage{ID: req.ID, Result: s.listResult()})
+	case "run":
+		if err := s.start(req); err != nil {
+			s.send(serveMessage{ID: req.ID, Error: err.Error()})
+		}
+	case "cancel":
+		s.mu.Lock()
+		cancel, ok := s.runs[req.Run]
+		s.mu.Unlock()
+		if !ok {
+			s.send(serveMessage{ID: req.ID, Error: fmt.Sprintf("no run %d is running", req.Run)})
+			return
+		}
+		cancel()
+		s.send(serveMessage{ID: req.ID, Result: map[string]int{"run": req.Run}})
+	default:
+		s.send(serveMessage{ID: req.ID, Error: fmt.Sprintf("unknown method %q", req.Method)})
+	}
+}
+
+// start answers a run request with the number of the run and runs the
+// script it names in the background.
+func (s *server) start(req serveRequest) error {
+	script, err := s.find(req.Package, req.Script)
+	if err != nil {
+		return err
+	}
+	inv, err := s.prepare(script, req.Args, req.Yes)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.nextRun++
+	run := s.nextRun
+	s.runs[run] = cancel
+	s.mu.Unlock()
+
+	var stdout, stderr io.Writer = io.Discard, io.Discard
+	if req.Output {
+		stdout, stderr = &serveOutput{s: s, run: run, stream: "stdout"}, &serveOutput{s: s, run: run, stream: "stderr"}
+	}
+	s.send(serveMessage{ID: req.ID, Result: map[string]int{"run": run}})
+	started := newJSONScript(script)
+	s.send(serveMessage{Event: "started", Run: run, Script: &started})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		r := runOne(ctx, inv, nil, stdout, stderr)
+		s.mu.Lock()
+		delete(s.runs, run)
+		s.mu.Unlock()
+		code, duration := r.code, r.duration.Milliseconds()
+		msg := serveMessage{Event: "exit", Run: run, Code: &code, Duration: &duration}
+		if r.err != nil {
+			msg.Error = r.err.Error()
+		}
+		s.send(msg)
+	}()
+	return nil
+}
+
+// prepare resolves the invocation of script with args for a run without a
+// terminal and records it in the history. Dangerous scripts need yes.
+func (s *server) prepare(script discover.NpmScript, args []string, yes bool) (invocation, error) {
+	opts := *s.opts
+	opts.scriptArgs = args
+	inv := resolveInvocation(script, &opts)
+	inv.pty = false
+	if err := checkRunDir(inv); err != nil {
+		return inv, err
+	}
+	if err := applyScriptEnv(&inv, &opts); err != nil {
+		return inv, err
+	}
+	if glob, dangerous := dangerousGlob(inv, opts.dangerous); dangerous && !opts.yes && !yes {
+		return inv, fmt.Errorf("%s matches the dangerous script pattern %q, pass \"yes\":true to run it", script.Label(), glob)
+	}
+	if !opts.noHistory {
+		if entry, err := recordHistory(script, args, nil); err == nil {
+			inv.recorded = &entry
+		}
+	}
+	return inv, nil
+}
+
+// find returns the script called name of the package given by a
+// package.json path, a package directory or a package name.
+func (s *server) find(pkg, name string) (discover.NpmScript, error) {
+	if name == "" {
+		return discover.NpmScript{}, fmt.Errorf("run needs a script")
+	}
+	absPkg, _ := filepath.Abs(pkg)
+	var matches []discover.NpmScript
+	for _, script := range s.scripts {
+		if script.ScriptName != name {
+			continue
+		}
+		path, _ := filepath.Abs(script.AbsolutePath)
+		if pkg == "" || script.PackageName == pkg || path == absPkg || filepath.Dir(path) == absPkg {
+			matches = append(matches, script)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		if pkg == "" {
+			return discover.NpmScript{}, fmt.Errorf("no script %q found", name)
+		}
+		return discover.NpmScript{}, fmt.Errorf("no script %q found in %q", name, pkg)
+	case 1:
+		return matches[0], nil
+	default:
+		return discover.NpmScript{}, fmt.Errorf("%d scripts named %q, pass a package", len(matches), name)
+	}
+}
+
+// serveOutput turns the output of a run into output events.
+type serveOutput struct {
+	s      *server
+	run    int
+	stream string
+}
+
+func (o *serveOutput) Write(data []byte) (int, error) {
+	o.s.send(serveMessage{Event: "output", Run: o.run, Stream: o.stream, Data: string(data)})
+	return len(data), nil
+}
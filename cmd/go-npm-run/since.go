@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// changedFiles returns the absolute paths of the files of the git
+// repository dir belongs to that changed since ref: committed since the
+// merge base of ref and HEAD, changed in the working tree or the index, or
+// untracked and not ignored.
+func changedFiles(dir, ref string) ([]string, error) {
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("--since needs a git repository, %s is not inside one", dir)
+	}
+	top = strings.TrimSpace(top)
+	if _, err := git(top, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("--since: %q is not a commit in %s", ref, top)
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	for _, args := range [][]string{
+		{"diff", "--name-only", "-z", ref + "...HEAD"},
+		{"diff", "--name-only", "-z", "HEAD"},
+		{"ls-files", "--others", "--exclude-standard", "-z"},
+	} {
+		out, err := git(top, args...)
+		if err != nil {
+			return nil, fmt.Errorf("--since: git %s: %w", strings.Join(args, " "), err)
+		}
+		for _, name := range strings.Split(out, "\x00") {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				files = append(files, filepath.Join(top, filepath.FromSlash(name)))
+			}
+		}
+	}
+	return files, nil
+}
+
+// git runs git in dir and returns its output, with what git printed to
+// stderr as the error.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// sinceScripts keeps the scripts of the packages owning a file changed
+// since ref, the package whose directory is the closest parent of the
+// file. With dependents also the packages depending on those, directly or
+// through other packages.
+func sinceScripts(scripts []discover.NpmScript, root, ref string, dependents bool) ([]discover.NpmScript, error) {
+	files, err := changedFiles(root, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// git reports resolved paths, the scan the ones it walked
+	dirs := map[string]string{}
+	for _, script := range scripts {
+		if _, ok := dirs[script.AbsolutePath]; ok {
+			continue
+		}
+		dir, _ := filepath.Abs(filepath.Dir(script.AbsolutePath))
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		dirs[script.AbsolutePath] = dir
+	}
+	byDir := map[string]string{}
+	for path, dir := range dirs {
+		byDir[dir] = path
+	}
+
+	changed := map[string]bool{}
+	for _, file := range files {
+		for dir := filepath.Dir(file); ; dir = filepath.Dir(dir) {
+			if path, ok := byDir[dir]; ok {
+				changed[path] = true
+				break
+			}
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	debugf("--since %s: %d changed files in %d packages", ref, len(files), len(changed))
+
+	if dependents {
+		dependentsOf := map[string][]string{}
+		for path, deps := range workspaceGraph(scripts) {
+			for _, dep := range deps {
+				dependentsOf[dep] = append(dependentsOf[dep], path)
+			}
+		}
+		var queue []string
+		for path := range changed {
+			queue = append(queue, path)
+		}
+		sort.Strings(queue)
+		for len(queue) > 0 {
+			path := queue[0]
+			queue = queue[1:]
+			for _, dependent := range dependentsOf[path] {
+				if !changed[dependent] {
+					changed[dependent] = true
+					debugf("--include-dependents: %s depends on %s", dependent, path)
+					queue = append(queue, dependent)
+				}
+			}
+		}
+	}
+
+	var kept []discover.NpmScript
+	for _, script := range scripts {
+		if changed[script.AbsolutePath] {
+			kept = append(kept, script)
+		}
+	}
+	return kept, nil
+}
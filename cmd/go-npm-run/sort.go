@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// Orders accepted by --sort.
+const (
+	sortPackage = "package"
+	sortName    = "name"
+	sortRecent  = "recent"
+	sortNone    = "none"
+)
+
+var sortModes = []string{sortPackage, sortName, sortRecent, sortNone}
+
+// sortCycle is the order the picker's sort key steps through, none is
+// left out as it is only useful for listing.
+var sortCycle = []string{sortPackage, sortName, sortRecent}
+
+// nextSort returns the order after mode in sortCycle.
+func nextSort(mode string) string {
+	for i, m := range sortCycle {
+		if m == mode {
+			return sortCycle[(i+1)%len(sortCycle)]
+		}
+	}
+	return sortCycle[0]
+}
+
+// sortScripts orders scripts in place:
+//
+//   - package: by package path, then script name
+//   - name: by script name, then package path
+//   - recent: most recently run first according to history, the rest by package
+//   - none: by package path, keeping the declaration order within a package
+func sortScripts(scripts []discover.NpmScript, mode string, history []historyEntry) {
+	byPackage := func(a, b discover.NpmScript) bool {
+		if a.AbsolutePath != b.AbsolutePath {
+			return a.AbsolutePath < b.AbsolutePath
+		}
+		return a.ScriptName < b.ScriptName
+	}
+
+	switch mode {
+	case sortName:
+		sort.SliceStable(scripts, func(i, j int) bool {
+			if scripts[i].ScriptName != scripts[j].ScriptName {
+				return scripts[i].ScriptName < scripts[j].ScriptName
+			}
+			return scripts[i].AbsolutePath < scripts[j].AbsolutePath
+		})
+	case sortRecent:
+		runs := lastRuns(history)
+		lastRun := make([]time.Time, len(scripts))
+		for i, script := range scripts {
+			if path, err := filepath.Abs(script.AbsolutePath); err == nil {
+				lastRun[i] = runs[historyKey(path, script.ScriptName)]
+			}
+		}
+		sort.Sort(byRecent{scripts: scripts, lastRun: lastRun, less: byPackage})
+	case sortNone:
+		sort.SliceStable(scripts, func(i, j int) bool {
+			return scripts[i].AbsolutePath < scripts[j].AbsolutePath
+		})
+	default:
+		sort.SliceStable(scripts, func(i, j int) bool {
+			return byPackage(scripts[i], scripts[j])
+		})
+	}
+}
+
+// byRecent sorts scripts together with their last run times.
+type byRecent struct {
+	scripts []discover.NpmScript
+	lastRun []time.Time
+	less    func(a, b discover.NpmScript) bool
+}
+
+func (s byRecent) Len() int { return len(s.scripts) }
+
+func (s byRecent) Swap(i, j int) {
+	s.scripts[i], s.scripts[j] = s.scripts[j], s.scripts[i]
+	s.lastRun[i], s.lastRun[j] = s.lastRun[j], s.lastRun[i]
+}
+
+func (s byRecent) Less(i, j int) bool {
+	if !s.lastRun[i].Equal(s.lastRun[j]) {
+		return s.lastRun[i].After(s.lastRun[j])
+	}
+	return s.less(s.scripts[i], s.scripts[j])
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// pickerState holds what the picker key bindings changed, in picker.json
+// under the user cache directory, so that the next run starts the way the
+// last one was left. It only takes the place of the built-in defaults, the
+// config files, environment and flags still win.
+type pickerState struct {
+	// Preview is whether the preview pane was shown after the last toggle.
+	Preview *bool `json:"preview,omitempty"`
+	// Sort is the --sort order the picker was cycled to last.
+	Sort string `json:"sort,omitempty"`
+}
+
+func pickerStatePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-npm-run", "picker.json"), nil
+}
+
+// loadPickerState returns the saved state and where it was read from. A
+// missing or unreadable file is an empty state.
+func loadPickerState() (pickerState, string) {
+	var state pickerState
+	path, err := pickerStatePath()
+	if err != nil {
+		return state, ""
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			debugf("ignoring %s: %v", path, err)
+		}
+	}
+	return state, path
+}
+
+func (s pickerState) apply(opts *options, path string) {
+	source := "picker state " + path
+	if s.Preview != nil {
+		opts.noPreview = !*s.Preview
+		opts.setSource("no-preview", source)
+	}
+	if contains(sortModes, s.Sort) {
+		opts.sort = s.Sort
+		opts.setSource("sort", source)
+	}
+}
+
+// savePickerState changes the saved state with update. Failing to save
+// only costs the next run its starting point, so errors are logged.
+func savePickerState(update func(*pickerState)) {
+	state, path := loadPickerState()
+	if path == "" {
+		return
+	}
+	update(&state)
+	if err := writePickerState(path, state); err != nil {
+		debugf("cannot save %s: %v", path, err)
+	}
+}
+
+func writePickerState(path string, state pickerState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// errNoScripts closes the streaming picker when the scan found nothing.
+var errNoScripts = errors.New("no scripts found")
+
+// canStream reports whether the picker can open before the scan finished:
+// the built-in finder picks from all scripts, without a name to resolve, a
+// package picker first, --since, whose dependents need the whole scan, a
+// --sort by name or recent, which would reshuffle the whole list with every
+// package, or --no-preview, which leaves the counts of the scan nowhere to
+// go.
+func canStream(opts *options) bool {
+	return opts.finder == finderBuiltin && !usePlain(opts) && !opts.byPackage && opts.scriptName == "" &&
+		!opts.list && !opts.json && opts.format == "" && !opts.last && !opts.all && opts.runID == "" && opts.export == "" &&
+		opts.since == "" && opts.sort != sortName && opts.sort != sortRecent && !opts.noPreview
+}
+
+// pickStreaming opens the built-in finder right away and adds the scripts
+// of batches to it as they arrive, filtered like main does and inserted at
+// their --sort position, so the list ends up as it would after a full scan.
+// The first line of the preview pane has the package and script counts of
+// pickerHeader, which the header cannot show as it is set before the scan,
+// and says whether the scan still runs. tally counts what the filters
+// dropped. scanned is called once batches is drained.
+//
+// Every batch replaces the list, which the finder only picks up on its
+// next reload. The list it last loaded is kept aside and the chosen index
+// looked up in it, so a pick made in between still runs the script it was
+// shown for; that list is returned along with the index. When the finder
+// fails to start, the scan is waited for and all of its scripts returned
+// with the error.
+//
+// The script run last below the search path is read up front and pinned
+// first, where the cursor starts, unless --workspaces-only needs the scan
+// to tell whether it is kept.
+//
+// The action keys of pickItem work here too. Their actions run on the
+// current lists holding mu, which holds up the scan while the editor of
+// ctrl-e is open, before the finder opens again.
+func pickStreaming(opts *options, batches <-chan []discover.NpmScript, history []historyEntry, tally *filterTally, scanned func()) (int, []discover.NpmScript, error) {
+	// mu guards the lists the finder reloads, previewMu what the preview
+	// reads: the finder draws the preview without holding mu
+	var mu sync.Mutex
+	var previewMu sync.RWMutex
+	var scripts []discover.NpmScript
+	var items []pickerItem
+	// shownScripts and shownItems are the lists the finder last loaded
+	var shownScripts []discover.NpmScript
+	var shownItems []pickerItem
+	found := []discover.NpmScript{}
+	pinned := 0
+	scanning := true
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	publish := func(batch []discover.NpmScript, done bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		previewMu.Lock()
+		defer previewMu.Unlock()
+		scanning = !done
+		if len(batch) == 0 {
+			return
+		}
+		rest := append(append(make([]discover.NpmScript, 0, len(scripts)-pinned+len(batch)), scripts[pinned:]...), batch...)
+		sortScripts(rest, opts.sort, history)
+		scripts = append(scripts[:pinned:pinned], rest...)
+		items = scriptItems(opts, scripts)
+	}
+	preselected := ""
+	if last, ok := lastRunBelow(opts.searchPath, history); ok && !opts.workspacesOnly {
+		if first := filterBatch(opts, []discover.NpmScript{last}, nil); len(first) > 0 {
+			preselected = last.ID()
+			publish(first, false)
+			pinned = len(first)
+		}
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		// Hold back one batch so the last one is published together with
+		// the end of the scan, the finder only reloads when items grow
+		var pending []discover.NpmScript
+		for batch := range batches {
+			previewMu.Lock()
+			found = append(found, batch...)
+			previewMu.Unlock()
+			batch = filterBatch(opts, batch, tally)
+			if preselected != "" {
+				for i, script := range batch {
+					if script.ID() == preselected {
+						batch = append(batch[:i:i], batch[i+1:]...)
+						break
+					}
+				}
+			}
+			if len(batch) == 0 {
+				continue
+			}
+			publish(pending, false)
+			pending = batch
+		}
+		publish(pending, true)
+		scanned()
+		mu.Lock()
+		defer mu.Unlock()
+		if len(scripts) == 0 {
+			cancel()
+		}
+	}()
+
+	preview := func(i, width, height int) string {
+		previewMu.RLock()
+		defer previewMu.RUnlock()
+		// The header is set before the scan, the counts it lacks are kept
+		// up to date here instead
+		parts := pickerCounts(opts, found, scripts)
+		if scanning {
+			parts = append([]string{"scanning…"}, parts...)
+		}
+		status := joinParts(parts, width) + "\n\n"
+		if i == -1 || i >= len(shownItems) {
+			return status
+		}
+		return status + shownItems[i].preview
+	}
+	loaded := func() {
+		previewMu.Lock()
+		shownScripts, shownItems = scripts, items
+		previewMu.Unlock()
+	}
+
+	actions := append(scriptActions(opts, nil, nil), finderActions(opts)...)
+	keys, keyLine := actionHeader(actions)
+	keyLine = strings.TrimSuffix(pickerHeader(opts, nil, nil, pickerWidth(opts))+"\n"+keyLine, "\n")
+	header, query, cursor := keyLine, "", -1
+	for {
+		finderOpts := builtinOptions{
+			header:   header,
+			query:    query,
+			caseMode: opts.caseMode,
+			exact:    opts.exact,
+			cursor:   cursor,
+			keys:     keys,
+			lock:     &mu,
+			loaded:   loaded,
+			ctx:      ctx,
+		}
+		if !opts.noPreview {
+			finderOpts.preview = preview
+		}
+		result, err := pickBuiltin(&items, finderOpts)
+		if err != nil && !errors.Is(err, fuzzyfinder.ErrAbort) && !errors.Is(err, context.Canceled) {
+			<-drained
+		}
+
+		mu.Lock()
+		previewMu.RLock()
+		shown := shownScripts
+		previewMu.RUnlock()
+		switch {
+		case errors.Is(err, context.Canceled):
+			mu.Unlock()
+			return -1, scripts, errNoScripts
+		case err != nil:
+			mu.Unlock()
+			return -1, scripts, err
+		case result.key == "":
+			mu.Unlock()
+			return result.idx, shown, nil
+		}
+
+		// The actions run on the current lists, which may have grown since
+		// the finder loaded the one the key was pressed in
+		query, cursor = result.query, -1
+		i, id := -1, ""
+		if result.idx >= 0 {
+			id = shown[result.idx].ID()
+			i = scriptIndex(scripts, id)
+		}
+		sortBefore := opts.sort
+		previewMu.Lock()
+		actions := append(scriptActions(opts, scripts, items), finderActions(opts)...)
+		action := findAction(actions, result.key)
+		switch {
+		case i >= 0:
+			header = action.run(i) + "\n" + keyLine
+		case action.anyItem:
+			header = action.run(-1) + "\n" + keyLine
+		}
+		if opts.sort != sortBefore {
+			// The script run last is sorted in with the others now
+			pinned = 0
+		}
+		if id != "" {
+			cursor = scriptIndex(scripts, id)
+		}
+		previewMu.Unlock()
+		mu.Unlock()
+	}
+}
+
+// scriptIndex returns the index of the script with id in scripts, or -1.
+func scriptIndex(scripts []discover.NpmScript, id string) int {
+	for i, script := range scripts {
+		if script.ID() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Filters of filterBatch, in the order main applies them.
+const (
+	filterWorkspaces = iota
+	filterPackages
+	filterScope
+	filterOnly
+	filterExclude
+	filterHidden
+	filterCount
+)
+
+// filterTally counts the scripts going into and coming out of every filter
+// over all batches of a streaming scan, to explain an empty picker like
+// main does.
+type filterTally struct {
+	in, out [filterCount]int
+}
+
+// emptyMessage is the message main prints when the filters leave no script,
+// or "" when none of them emptied the list.
+func (t *filterTally) emptyMessage(opts *options) string {
+	for filter := 0; filter < filterCount; filter++ {
+		if t.in[filter] == 0 || t.out[filter] > 0 {
+			continue
+		}
+		switch filter {
+		case filterWorkspaces:
+			return "No scripts found in workspaces."
+		case filterPackages:
+			return fmt.Sprintf("All %d scripts are in packages excluded by %s.", t.in[filter], strings.Join(opts.excludePackages, ", "))
+		case filterScope:
+			return fmt.Sprintf("No packages in scope %s.", strings.Join(opts.scopes, ", "))
+		case filterOnly:
+			return fmt.Sprintf("No scripts match --only %s.", strings.Join(opts.only, ", "))
+		case filterExclude:
+			return fmt.Sprintf("All %d scripts are excluded by %s.", t.in[filter], strings.Join(opts.exclude, ", "))
+		case filterHidden:
+			return fmt.Sprintf("All %d scripts are hidden by their package.json, --show-hidden lists them.", t.in[filter])
+		}
+	}
+	return ""
+}
+
+// filterBatch applies the filters of main to a batch of the streaming
+// scan, counting what they keep in tally unless it is nil.
+func filterBatch(opts *options, batch []discover.NpmScript, tally *filterTally) []discover.NpmScript {
+	apply := func(filter int, keep func([]discover.NpmScript) []discover.NpmScript) {
+		if tally != nil {
+			tally.in[filter] += len(batch)
+		}
+		batch = keep(batch)
+		if tally != nil {
+			tally.out[filter] += len(batch)
+		}
+	}
+	if opts.workspacesOnly {
+		apply(filterWorkspaces, func(b []discover.NpmScript) []discover.NpmScript {
+			return workspaceScripts(b, opts.searchPath)
+		})
+	}
+	if len(opts.excludePackages) > 0 {
+		apply(filterPackages, func(b []discover.NpmScript) []discover.NpmScript {
+			return excludePackages(b, opts.excludePackages, opts.searchPath)
+		})
+	}
+	if len(opts.scopes) > 0 {
+		apply(filterScope, func(b []discover.NpmScript) []discover.NpmScript {
+			return scopeScripts(b, opts.scopes)
+		})
+	}
+	if len(opts.only) > 0 {
+		apply(filterOnly, func(b []discover.NpmScript) []discover.NpmScript {
+			b, _ = onlyScripts(b, opts.only)
+			return b
+		})
+	}
+	if len(opts.exclude) > 0 {
+		apply(filterExclude, func(b []discover.NpmScript) []discover.NpmScript {
+			return excludeScripts(b, opts.exclude)
+		})
+	}
+	if !opts.showHidden {
+		apply(filterHidden, visibleScripts)
+	}
+	return batch
+}
+
+// pickWhileScanning is main's picker path when canStream allows it: the
+// finder opens immediately and the scan fills it, then the chosen script
+// runs.
+func pickWhileScanning(opts *options, scriptCache *discover.ScriptCache, timeStart time.Time) {
+	history := loadHistory()
+	lastOutcomes = finishedRuns(history)
+
+	// The finder reads Ctrl-C as a key, the signal only arrives before it
+	// took over the terminal. A pick stops the scan as well.
+	scanCtx, stopScan := signal.NotifyContext(context.Background(), os.Interrupt)
+	var roots atomic.Int64
+	var scanTime atomic.Int64
+	batches := discover.Stream(scanCtx, opts.searchPath, &roots)
+	var extractedMu sync.Mutex
+	var extracted []discover.NpmScript
+	if opts.stats {
+		batches = teeBatches(batches, func(batch []discover.NpmScript) {
+			extractedMu.Lock()
+			defer extractedMu.Unlock()
+			extracted = append(extracted, batch...)
+		})
+	}
+	verboseLog.hold()
+	pickStart := time.Now()
+	var tally filterTally
+	idx, scripts, err := pickStreaming(opts, batches, history, &tally, func() {
+		scanTime.Store(int64(time.Since(timeStart)))
+	})
+	stats := scanStats{scan: time.Duration(scanTime.Load()), pick: time.Since(pickStart)}
+	verboseLog.release()
+	aborted := scanCtx.Err() != nil
+	stopScan()
+	if !aborted {
+		scriptCache.Save()
+	}
+	if stats.scan == 0 {
+		// The pick came first and stopped the scan
+		stats.scan, stats.scanStopped = time.Since(timeStart), true
+	}
+	extractedMu.Lock()
+	reportStats(opts, stats, extracted)
+	extractedMu.Unlock()
+
+	switch {
+	case aborted && errors.Is(err, errNoScripts):
+		scanAborted()
+	case errors.Is(err, errNoScripts) && roots.Load() == 0:
+		infof("No package.json files found.")
+		os.Exit(exitNothingToDo)
+	case errors.Is(err, errNoScripts):
+		if message := tally.emptyMessage(opts); message != "" {
+			infof("%s", message)
+		} else {
+			infof("No scripts found.")
+		}
+		os.Exit(exitNothingToDo)
+	case err != nil && !errors.Is(err, fuzzyfinder.ErrAbort):
+		warnf("cannot open the picker: %v, falling back to the plain menu", err)
+		if idx, err = pickPlain(os.Stdin, os.Stderr, scriptItems(opts, scripts), ""); err != nil {
+			pickAborted(opts, err)
+			return
+		}
+	case err != nil:
+		pickAborted(opts, err)
+		return
+	}
+	run(opts, scripts[idx])
+}
+
+// teeBatches passes the batches of in on, calling seen with each first.
+func teeBatches(in <-chan []discover.NpmScript, seen func([]discover.NpmScript)) <-chan []discover.NpmScript {
+	out := make(chan []discover.NpmScript)
+	go func() {
+		defer close(out)
+		for batch := range in {
+			seen(batch)
+			out <- batch
+		}
+	}()
+	return out
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// TestFilterTally checks that the streaming picker explains an empty list
+// with the message main prints for the filter that emptied it.
+func TestFilterTally(t *testing.T) {
+	t.Parallel()
+	batches := [][]discover.NpmScript{
+		{{PackageName: "web", ScriptName: "build"}, {PackageName: "web", ScriptName: "lint"}},
+		{{PackageName: "api", ScriptName: "test"}, {PackageName: "api", ScriptName: "secret", Hidden: true}},
+	}
+	tests := []struct {
+		name string
+		opts options
+		want string
+	}{
+		{"nothing filtered", options{showHidden: true}, ""},
+		{"excluded", options{exclude: []string{"*"}}, "All 4 scripts are excluded by *."},
+		{"no --only match", options{only: []string{"deploy", "release"}}, "No scripts match --only deploy, release."},
+		{"--only then hidden", options{only: []string{"secret"}}, "All 1 scripts are hidden by their package.json, --show-hidden lists them."},
+	}
+	for _, tt := range tests {
+		var tally filterTally
+		for _, batch := range batches {
+			filterBatch(&tt.opts, append([]discover.NpmScript(nil), batch...), &tally)
+		}
+		if got := tally.emptyMessage(&tt.opts); got != tt.want {
+			t.Errorf("%s: emptyMessage() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
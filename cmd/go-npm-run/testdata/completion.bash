@@ -0,0 +1,26 @@
+# bash completion for go-npm-run
+# Install with: eval "$(go-npm-run completion bash)"
+# or: go-npm-run completion bash > /etc/bash_completion.d/go-npm-run
+_go_npm_run() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ $COMP_CWORD -eq 2 && "${COMP_WORDS[1]}" == completion ]]; then
+        COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+        return
+    fi
+    case "$prev" in
+        --case|--columns|--config|--dir|--env|--env-allow|--env-file|--exclude|--exclude-package|--finder|--format|--http|--http-token|--ignore|--jobs|-j|--notify-after|--only|--order|--output|--parse-jobs|--pm|--prefix|--retry|--retry-delay|--run-at|--run-id|--scope|--search|--shell|--since|--sort|--tail-lines|--timeout|--timeout-grace|--tmux|--tmux-remain-on-exit|--watch-glob|--with-deps)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+            ;;
+    esac
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "--all --by-package --case --cd --clean-env --columns --config --dir --dry-run --env --env-allow --env-file --env-file-override --eval --exact --exclude --exclude-package --exec --fail-fast --finder --format --gha --header --help -h --http --http-public --http-token --if-present --ignore --ignore-platform --include-dependents --install --jobs -j --json --keep-going -k --last --list -l --list-aliases --log --log-strip-ansi --no-corepack --no-history --no-install --no-local-deps --no-node-run --no-preview --no-project-config --no-pty --no-versions --notify --notify-after --only --order --output --parallel --parse-jobs --plain --pm --prefix --print --prompt-env --quiet -s --raw --refresh --restart --retry --retry-delay --run-at --run-id --scope --search --serve --shell --short-names --show-hidden --since --sort --stats --strict-engines --tail-lines --timeout --timeout-grace --timestamps --tmux --tmux-remain-on-exit --verbose -v --version -V --watch -w --watch-glob --where --with-deps --workspaces-only --yes -y" -- "$cur"))
+        return
+    fi
+    COMPREPLY=($(compgen -d -- "$cur"))
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY+=($(compgen -W "completion" -- "$cur"))
+    fi
+}
+complete -o filenames -F _go_npm_run go-npm-run
@@ -0,0 +1,99 @@
+# fish completion for go-npm-run
+# Install with: go-npm-run completion fish > ~/.config/fish/completions/go-npm-run.fish
+complete -c go-npm-run -f
+complete -c go-npm-run -n '__fish_use_subcommand' -a '(__fish_complete_directories)'
+complete -c go-npm-run -n '__fish_use_subcommand' -a completion -d 'print a shell completion script'
+complete -c go-npm-run -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c go-npm-run -l all -d 'run the named script in every package that defines it, one after another'
+complete -c go-npm-run -l by-package -d 'pick a package first, then one of its scripts'
+complete -c go-npm-run -l case -r -F -d 'match the picker query with `case`: smart (ignore case unless the query has an uppercase letter), ignore or respect'
+complete -c go-npm-run -l cd -d 'with --where, print only the directory of the one package defining the script'
+complete -c go-npm-run -l clean-env -d 'start the script with only PATH, HOME, TERM, the --env-allow variables and the --env and --env-file ones instead of go-npm-run\'s whole environment'
+complete -c go-npm-run -l columns -r -F -d 'with --format tsv, print the comma separated `columns` out of id, package, name, version, script, command, path, dir and pm'
+complete -c go-npm-run -l config -r -F -d 'read configuration from `path` instead of the user config file'
+complete -c go-npm-run -l dir -r -F -d 'run scripts in `path` instead of their package directory'
+complete -c go-npm-run -l dry-run -d 'print the command that would run instead of running it'
+complete -c go-npm-run -l env -r -F -d 'set `KEY=VALUE` in the script\'s environment, a bare KEY passes it on from go-npm-run\'s (repeatable)'
+complete -c go-npm-run -l env-allow -r -F -d 'with --clean-env, also pass on the variables whose name matches `glob`, case-insensitive (repeatable)'
+complete -c go-npm-run -l env-file -r -F -d 'load KEY=VALUE lines from `path` into the script\'s environment (repeatable, later files win)'
+complete -c go-npm-run -l env-file-override -d 'let --env-file values override variables already set in the environment'
+complete -c go-npm-run -l eval -d 'print the command as one cd-and-run line for a shell wrapper to eval, instead of running it'
+complete -c go-npm-run -l exact -d 'match the picker query as a substring instead of fuzzily'
+complete -c go-npm-run -l exclude -r -F -d 'hide scripts whose name or package:name matches `glob`, case-insensitive (repeatable)'
+complete -c go-npm-run -l exclude-package -r -F -d 'hide the packages whose name or directory relative to the root matches `glob`, case-insensitive (repeatable)'
+complete -c go-npm-run -l exec -d 'replace go-npm-run with the package manager instead of running it as a child (not on windows)'
+complete -c go-npm-run -l fail-fast -d 'stop --all at the first failure, interrupting running scripts (default without --parallel)'
+complete -c go-npm-run -l finder -r -F -d 'pick scripts with `finder`: builtin or fzf (falls back to builtin when fzf is unavailable)'
+complete -c go-npm-run -l format -r -F -d 'print all scripts as `format`: list (like --list), json (like --json) or tsv'
+complete -c go-npm-run -l gha -d 'group the output of --all runs and annotate failures for GitHub Actions (default on when GITHUB_ACTIONS=true)'
+complete -c go-npm-run -l header -d 'start --format tsv output with the column names'
+complete -c go-npm-run -s h -l help -d 'show this help and exit'
+complete -c go-npm-run -l http -r -F -d 'serve an HTTP API for listing and running scripts on `addr`, e.g. 127.0.0.1:7777 (see below)'
+complete -c go-npm-run -l http-public -d 'let --http listen on addresses other than loopback'
+complete -c go-npm-run -l http-token -r -F -d 'require `token` from --http clients instead of a random one'
+complete -c go-npm-run -l if-present -d 'exit with 0 when no package defines the named script, like npm run --if-present'
+complete -c go-npm-run -l ignore -r -F -d 'skip directories named `dir` while scanning (repeatable)'
+complete -c go-npm-run -l ignore-platform -d 'run packages whose package.json os or cpu fields exclude this system without asking, and with --all'
+complete -c go-npm-run -l include-dependents -d 'with --since, also keep the packages depending on the changed ones'
+complete -c go-npm-run -l install -d 'install missing dependencies before running without asking'
+complete -c go-npm-run -s j -l jobs -r -F -d 'run at most `n` scripts at the same time with --parallel (default: number of CPUs)'
+complete -c go-npm-run -l json -d 'print all scripts as JSON instead of opening the picker'
+complete -c go-npm-run -s k -l keep-going -d 'run every --all package even after failures (default with --parallel)'
+complete -c go-npm-run -l last -d 'run the most recently run script again, with the same arguments and placeholder values'
+complete -c go-npm-run -s l -l list -d 'print all scripts, one per line, instead of opening the picker'
+complete -c go-npm-run -l list-aliases -d 'print the aliases from the config file and exit'
+complete -c go-npm-run -l log -d 'copy the script output to a new file in the project\'s logs directory (--log=path appends to path)'
+complete -c go-npm-run -l log-strip-ansi -d 'remove ANSI colors and escape sequences from the --log file'
+complete -c go-npm-run -l no-corepack -d 'run the package manager from PATH even when packageManager pins a version'
+complete -c go-npm-run -l no-history -d 'do not record runs in the history file'
+complete -c go-npm-run -l no-install -d 'do not check whether dependencies are installed'
+complete -c go-npm-run -l no-local-deps -d 'do not list the packages that file: and link: dependencies point to'
+complete -c go-npm-run -l no-node-run -d 'always run npm projects with npm run instead of node --run'
+complete -c go-npm-run -l no-preview -d 'hide the preview pane in the picker'
+complete -c go-npm-run -l no-project-config -d 'do not read the .go-npm-run.yaml or package.json "go-npm-run" config of the project'
+complete -c go-npm-run -l no-pty -d 'never run scripts in a pseudo terminal, even when their output is prefixed'
+complete -c go-npm-run -l no-versions -d 'leave the package versions out of the picker labels and --list'
+complete -c go-npm-run -l notify -d 'show a desktop notification when the script finishes, and on every failure with --watch'
+complete -c go-npm-run -l notify-after -r -F -d 'only --notify about runs that took at least `duration`'
+complete -c go-npm-run -l only -r -F -d 'keep only scripts whose name or package:name matches `glob`, case-insensitive (repeatable)'
+complete -c go-npm-run -l order -r -F -d 'run --all packages in `order`: flat (discovery order) or topo (dependencies first)'
+complete -c go-npm-run -l output -r -F -d 'show the script output as `mode`: stream, errors-only to hide it unless the script fails, or group to write each --parallel run as one block when it finishes (with export, the file to write)'
+complete -c go-npm-run -l parallel -d 'run the --all packages concurrently, output lines are prefixed with the package name'
+complete -c go-npm-run -l parse-jobs -r -F -d 'read at most `n` package.json files at the same time while scanning'
+complete -c go-npm-run -l plain -d 'pick from a numbered menu read from stdin instead of a full-screen finder (default when TERM=dumb)'
+complete -c go-npm-run -l pm -r -F -d 'run scripts with `runner` (npm, yarn, pnpm, bun or node) instead of inferring it'
+complete -c go-npm-run -l prefix -r -F -d 'with export aliases, start every function name with `prefix`'
+complete -c go-npm-run -l print -d 'print the selected command instead of running it (--print=raw prints the script body)'
+complete -c go-npm-run -l prompt-env -d 'also prompt for $VAR references in the script that are not set in the environment'
+complete -c go-npm-run -s s -l quiet -d 'suppress go-npm-run\'s own messages, only the script output is shown'
+complete -c go-npm-run -l raw -d 'run the script body through sh with node_modules/.bin on PATH, skipping the package manager'
+complete -c go-npm-run -l refresh -d 'parse every package.json again instead of using the script cache'
+complete -c go-npm-run -l restart -d 'relaunch the script whenever it exits, with backoff (--restart=on-failure only after failures)'
+complete -c go-npm-run -l retry -r -F -d 'run a failing script up to `n` more times'
+complete -c go-npm-run -l retry-delay -r -F -d 'wait `duration` between --retry attempts'
+complete -c go-npm-run -l run-at -r -F -d 'run scripts in `place`: package (their package directory), root (the workspace or repository root) or cwd'
+complete -c go-npm-run -l run-id -r -F -d 'run the script with `id`, as printed by --list, --json and --format tsv, without the picker'
+complete -c go-npm-run -l scope -r -F -d 'keep only packages of the npm `scope`, like @acme (repeatable)'
+complete -c go-npm-run -l search -r -F -d 'match the picker query against `fields`: name (package and script names) or command (their commands too)'
+complete -c go-npm-run -l serve -d 'scan once, then answer JSON requests on stdin for editor integrations (see below)'
+complete -c go-npm-run -l shell -r -F -d 'with export aliases, write functions for `shell`: bash, zsh (default) or fish'
+complete -c go-npm-run -l short-names -d 'leave the scope out of the package names in the picker, it still matches at the end of each line'
+complete -c go-npm-run -l show-hidden -d 'also list the scripts hidden by the "go-npm-run": {"hide": [...]} globs of their package.json'
+complete -c go-npm-run -l since -r -F -d 'keep only packages with files changed since the git `ref`, committed, uncommitted or untracked'
+complete -c go-npm-run -l sort -r -F -d 'order scripts by `order`: package, name, recent or none'
+complete -c go-npm-run -l stats -d 'report stage timings and what the scan found to stderr, after the picker or the --list, --json or tsv output'
+complete -c go-npm-run -l strict-engines -d 'refuse to run when node does not satisfy .nvmrc, .node-version or engines.node'
+complete -c go-npm-run -l tail-lines -r -F -d 'replay the last `n` lines of a failed --output=errors-only run'
+complete -c go-npm-run -l timeout -r -F -d 'stop the script when it runs longer than `duration`, e.g. 10m, and exit with 124'
+complete -c go-npm-run -l timeout-grace -r -F -d 'after --timeout, wait `duration` for the script to exit before killing it'
+complete -c go-npm-run -l timestamps -d 'prefix every output line with the time since the script started (--timestamps=abs for the time of day)'
+complete -c go-npm-run -l tmux -r -F -d 'inside tmux, run the script in a new `pane` or window instead of here'
+complete -c go-npm-run -l tmux-remain-on-exit -r -F -d 'keep the --tmux pane open after the script exits: `mode` on, off or failed'
+complete -c go-npm-run -s v -l verbose -d 'log discovery and package manager decisions to stderr'
+complete -c go-npm-run -s V -l version -d 'print version information and exit'
+complete -c go-npm-run -s w -l watch -d 're-run the script whenever a file in its package changes'
+complete -c go-npm-run -l watch-glob -r -F -d 'only restart --watch when a changed path matches `glob` (repeatable)'
+complete -c go-npm-run -l where -d 'print the package, package.json and command of every script with the given name, without running any'
+complete -c go-npm-run -l with-deps -r -F -d 'run `script` in every workspace package the selected one depends on first, dependencies first'
+complete -c go-npm-run -l workspaces-only -d 'keep only the root package and the packages of declared workspaces, not ones the directory walk found on its own'
+complete -c go-npm-run -s y -l yes -d 'run scripts matching the dangerous patterns without asking to confirm'
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// timestampMode is the value of --timestamps. It behaves like a boolean
+// flag so that a bare --timestamps prefixes the elapsed time, while
+// --timestamps=abs prefixes the wall-clock time.
+type timestampMode string
+
+const (
+	timestampsOff     timestampMode = ""
+	timestampsElapsed timestampMode = "elapsed"
+	timestampsAbs     timestampMode = "abs"
+)
+
+func (m *timestampMode) String() string { return string(*m) }
+
+func (m *timestampMode) IsBoolFlag() bool { return true }
+
+func (m *timestampMode) Set(value string) error {
+	switch value {
+	case "true", "elapsed":
+		*m = timestampsElapsed
+	case "abs":
+		*m = timestampsAbs
+	case "false":
+		*m = timestampsOff
+	default:
+		return fmt.Errorf("expected --timestamps or --timestamps=abs")
+	}
+	return nil
+}
+
+// timestampWriter prefixes every line written to w with the time since
+// start, or the time of day in abs mode. Output is passed on as it
+// arrives, the prefix is written with the first byte of a line. A carriage
+// return starts a new line too, so progress bars redrawing their line keep
+// a current timestamp, but the \n of a \r\n ending gets none.
+type timestampWriter struct {
+	w     io.Writer
+	mode  timestampMode
+	start time.Time
+	// lineStart is set when the next byte starts a line, afterCR when the
+	// last byte was a carriage return.
+	lineStart bool
+	afterCR   bool
+}
+
+func newTimestampWriter(w io.Writer, mode timestampMode, start time.Time) *timestampWriter {
+	return &timestampWriter{w: w, mode: mode, start: start, lineStart: true}
+}
+
+func (t *timestampWriter) Write(data []byte) (int, error) {
+	out := make([]byte, 0, len(data)+32)
+	for _, b := range data {
+		if t.lineStart && !(b == '\n' && t.afterCR) {
+			out = append(out, t.prefix()...)
+			t.lineStart = false
+		}
+		out = append(out, b)
+		t.afterCR = b == '\r'
+		if b == '\n' || b == '\r' {
+			t.lineStart = true
+		}
+	}
+	if _, err := t.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// prefix formats the current time like "[00:12.345] ", or with --timestamps=abs
+// "[15:04:05.000] ".
+func (t *timestampWriter) prefix() string {
+	now := time.Now()
+	if t.mode == timestampsAbs {
+		return "[" + now.Format("15:04:05.000") + "] "
+	}
+	elapsed := now.Sub(t.start)
+	minutes := int(elapsed / time.Minute)
+	millis := int((elapsed % time.Minute) / time.Millisecond)
+	return fmt.Sprintf("[%02d:%02d.%03d] ", minutes, millis/1000, millis%1000)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/runner"
+)
+
+// Modes accepted by --tmux.
+const (
+	tmuxPane   = "pane"
+	tmuxWindow = "window"
+)
+
+var tmuxModes = []string{tmuxPane, tmuxWindow}
+
+// tmuxRemainModes are the values of tmux's remain-on-exit option accepted
+// by --tmux-remain-on-exit.
+var tmuxRemainModes = []string{"on", "off", "failed"}
+
+// runInTmux starts inv in a new tmux pane or window, as opts.tmux says,
+// and returns once tmux started it. Outside of tmux it returns false and
+// inv has to run here; only a --tmux flag warns about that, not the
+// config file.
+func runInTmux(inv invocation, opts *options) bool {
+	if os.Getenv("TMUX") == "" {
+		if strings.HasPrefix(opts.sources["tmux"], "flag ") {
+			warnf("--tmux: not inside tmux, running %s here", inv.Script.Label())
+		} else {
+			debugf("not inside tmux, running %s here", inv.Script.Label())
+		}
+		return false
+	}
+	args := tmuxArgs(inv, opts.tmux, opts.tmuxRemain)
+	debugf("running tmux %s", strings.Join(args, " "))
+	cmd := exec.Command("tmux", args...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot start %s in tmux: %v\n", inv.Script.Label(), err)
+		os.Exit(exitFailure)
+	}
+	infof("Started %s in a new tmux %s.", inv.Script.Label(), opts.tmux)
+	return true
+}
+
+// tmuxArgs returns the tmux command line opening a pane or window in the
+// directory of inv, named after its package and script, and running it
+// with remain-on-exit set to remain. The command goes through sh, as the
+// default shell of tmux may not be a POSIX one.
+func tmuxArgs(inv invocation, mode, remain string) []string {
+	if dir, err := filepath.Abs(inv.Dir); err == nil {
+		inv.Dir = dir
+	}
+	if inv.BaseEnv != nil {
+		// env -i would drop anything exported before it
+		inv.Env = append(append([]string(nil), inv.PackageEnv...), inv.Env...)
+		inv.PackageEnv = nil
+	}
+	line := inv.CommandLine()
+	if len(inv.PackageEnv) > 0 {
+		env := make([]string, len(inv.PackageEnv))
+		for i, assignment := range inv.PackageEnv {
+			env[i] = runner.ShellQuote(assignment)
+		}
+		line = "export " + strings.Join(env, " ") + "; " + line
+	}
+	name := inv.Script.PackageName + "/" + inv.Script.ScriptName
+
+	args := []string{"split-window"}
+	if pane := os.Getenv("TMUX_PANE"); pane != "" {
+		// Split the pane go-npm-run runs in, not the active one
+		args = append(args, "-t", pane)
+	}
+	if mode == tmuxWindow {
+		args = []string{"new-window", "-n", name}
+	}
+	args = append(args, "-c", inv.Dir, "sh -c "+runner.ShellQuote(line), ";", "set-option", "-p", "remain-on-exit", remain)
+	if mode == tmuxPane {
+		args = append(args, ";", "select-pane", "-T", name)
+	}
+	return args
+}
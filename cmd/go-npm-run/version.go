@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Build information, injected at build time via
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=abc1234 -X main.date=2024-01-01T00:00:00Z"
+//
+// When built from source without ldflags, the values fall back to the
+// module and VCS information embedded by the go tool.
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+// buildInfo returns version, commit and date, filling the "dev" defaults
+// from runtime/debug.ReadBuildInfo where possible.
+func buildInfo() (string, string, string) {
+	v, c, d := version, commit, date
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v, c, d
+	}
+
+	if v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if c == "none" {
+				c = setting.Value
+				if len(c) > 12 {
+					c = c[:12]
+				}
+			}
+		case "vcs.time":
+			if d == "unknown" {
+				d = setting.Value
+			}
+		case "vcs.modified":
+			if setting.Value == "true" && c != "none" && commit == "none" {
+				c += "-dirty"
+			}
+		}
+	}
+
+	return v, c, d
+}
+
+// versionString is the human readable build description used by --version
+// and diagnostic output.
+func versionString() string {
+	v, c, d := buildInfo()
+	return fmt.Sprintf("go-npm-run %s (commit %s, built %s)", v, c, d)
+}
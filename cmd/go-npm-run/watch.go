@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the watcher waits for a burst of changes to
+// settle before restarting the script.
+const watchDebounce = 300 * time.Millisecond
+
+// watchIgnoredDirs are build outputs skipped in addition to discover.IgnoredDirs, a
+// build script writing into them would otherwise restart itself forever.
+var watchIgnoredDirs = map[string]bool{
+	"dist":     true,
+	"build":    true,
+	"coverage": true,
+	".next":    true,
+	".turbo":   true,
+	".cache":   true,
+}
+
+// watchScript runs inv and restarts it whenever a file under its directory
+// changes. It only returns through os.Exit, on SIGINT or SIGTERM.
+func watchScript(inv invocation, globs []string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot watch files: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	defer watcher.Close()
+
+	// The package is watched even when --run-at runs the script elsewhere
+	pkgDir := filepath.Dir(inv.Script.AbsolutePath)
+	addWatchDirs(watcher, pkgDir)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	for {
+		cmd := inv.Command()
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		setProcessGroup(cmd)
+
+		done := make(chan struct{})
+		var stopping atomic.Bool
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			close(done)
+		} else {
+			go func() {
+				err := cmd.Wait()
+				switch {
+				case stopping.Load():
+				case err != nil:
+					infof("%s exited: %v, waiting for changes", inv.Script.ScriptName, err)
+					if inv.notify {
+						notifyf("✗ %s failed, exit %d", inv.Script.Label(), cmd.ProcessState.ExitCode())
+					}
+				default:
+					infof("%s finished, waiting for changes", inv.Script.ScriptName)
+				}
+				close(done)
+			}()
+		}
+
+		sig := waitForChange(watcher, pkgDir, globs, signals)
+		stopping.Store(true)
+		stopProcess(cmd, syscall.SIGTERM, done, killGrace)
+		if sig != nil {
+			os.Exit(signalExitCode(sig))
+		}
+		infof("Change detected, restarting %s", inv.Script.ScriptName)
+	}
+}
+
+// waitForChange blocks until a relevant change settles or a signal
+// arrives, in which case the signal is returned.
+func waitForChange(watcher *fsnotify.Watcher, root string, globs []string, signals <-chan os.Signal) os.Signal {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case sig := <-signals:
+			return sig
+		case <-debounce:
+			return nil
+		case err := <-watcher.Errors:
+			debugf("watch error: %v", err)
+		case event := <-watcher.Events:
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addWatchDirs(watcher, event.Name)
+				}
+			}
+			if event.Has(fsnotify.Chmod) || !watchMatches(root, event.Name, globs) {
+				continue
+			}
+			debugf("watch: %s", event)
+			debounce = time.After(watchDebounce)
+		}
+	}
+}
+
+// addWatchDirs watches dir and every directory below it that is not ignored.
+func addWatchDirs(watcher *fsnotify.Watcher, dir string) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != dir && (discover.IgnoredDirs[d.Name()] || watchIgnoredDirs[d.Name()]) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			debugf("cannot watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// watchMatches reports whether a change to path should restart the script.
+// Without globs every change counts; otherwise the path relative to root,
+// or its base name, has to match one of them.
+func watchMatches(root, path string, globs []string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	rel = filepath.ToSlash(rel)
+	for _, glob := range globs {
+		if matchPathGlob(glob, rel) || matchPathGlob(glob, filepath.Base(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathGlob matches a slash separated name against a glob where "*"
+// and "?" stay within one path segment and "**" spans segments.
+func matchPathGlob(glob, name string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				// "**/" also matches no directory at all
+				if i+1 < len(runes) && runes[i+1] == '/' {
+					i++
+					re.WriteString("(?:.*/)?")
+				} else {
+					re.WriteString(".*")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	matched, err := regexp.MatchString(re.String(), name)
+	return err == nil && matched
+}
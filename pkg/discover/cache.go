@@ -0,0 +1,193 @@
+package discover
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// scriptCacheVersion changes whenever the cache format does, older files
+// are discarded.
+const scriptCacheVersion = 7
+
+// ScriptCache remembers the scripts extracted from every package.json,
+// keyed by absolute path, so that unchanged files are not parsed again.
+// A file counts as unchanged while its modification time and size are.
+type ScriptCache struct {
+	mu      sync.Mutex
+	entries map[string]*scriptCacheEntry
+	dirty   bool
+}
+
+type scriptCacheFile struct {
+	Version  int                          `json:"version"`
+	Packages map[string]*scriptCacheEntry `json:"packages"`
+}
+
+type scriptCacheEntry struct {
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	ModTime    time.Time      `json:"mtime"`
+	Size       int64          `json:"size"`
+	Scripts    []cachedScript `json:"scripts"`
+	Workspaces []string       `json:"workspaces,omitempty"`
+	// LocalDependencies are the file: and link: dependency directories.
+	LocalDependencies []string `json:"localDependencies,omitempty"`
+	// Hide are the HidePatterns.
+	Hide []string `json:"hide,omitempty"`
+	// OS and CPU are the PlatformFields.
+	OS  []string `json:"os,omitempty"`
+	CPU []string `json:"cpu,omitempty"`
+}
+
+// cachedScript is an NpmScript without its package and location, which
+// the entry holds.
+type cachedScript struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Line    int    `json:"line"`
+}
+
+// UseCache makes the package-level scans look up and store scripts in c,
+// nil disables caching. Scanners of other filesystems never cache. It
+// must not be called while a scan runs.
+func UseCache(c *ScriptCache) {
+	defaultScanner.cache = c
+}
+
+func scriptCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-npm-run", "scripts.json"), nil
+}
+
+// LoadScriptCache reads the cache file. With refresh set, or when the file
+// is missing, corrupt or from another version, the cache starts empty.
+func LoadScriptCache(refresh bool) *ScriptCache {
+	cache := &ScriptCache{entries: map[string]*scriptCacheEntry{}}
+	if refresh {
+		Debugf("--refresh: parsing every package.json")
+		return cache
+	}
+	path, err := scriptCachePath()
+	if err != nil {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var file scriptCacheFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != scriptCacheVersion || file.Packages == nil {
+		Debugf("discarding script cache %s", path)
+		return cache
+	}
+	cache.entries = file.Packages
+	Debugf("loaded script cache %s: %d packages", path, len(cache.entries))
+	return cache
+}
+
+// lookup returns the cached scripts, workspace patterns and local
+// dependencies of the package.json at filePath when it did not change
+// since they were cached.
+func (c *ScriptCache) lookup(filePath string) ([]NpmScript, []string, []string, bool) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[abs]
+	c.mu.Unlock()
+	if !ok || !entry.ModTime.Equal(info.ModTime()) || entry.Size != info.Size() {
+		return nil, nil, nil, false
+	}
+	name, derived := defaultScanner.packageDisplayName(filePath, entry.Name)
+	scripts := make([]NpmScript, len(entry.Scripts))
+	for i, s := range entry.Scripts {
+		scripts[i] = NpmScript{PackageName: name, ScriptName: s.Name, Command: s.Command, AbsolutePath: filePath, Line: s.Line, NameDerived: derived, PackageVersion: entry.Version}
+	}
+	if start, ok := implicitStart(OS, filePath, name, scripts); ok {
+		start.NameDerived, start.PackageVersion = derived, entry.Version
+		scripts = append(scripts, start)
+	}
+	hideScripts(scripts, entry.Hide)
+	markIncompatible(scripts, entry.OS, entry.CPU)
+	return scripts, entry.Workspaces, entry.LocalDependencies, true
+}
+
+// store caches the declared scripts, workspace patterns and local
+// dependencies of filePath, whose decoded content is packageJSON.
+func (c *ScriptCache) store(filePath string, packageJSON map[string]any, scripts []NpmScript, workspaces, deps []string) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return
+	}
+	// Names derived from the directory are worked out again on lookup
+	entry := &scriptCacheEntry{ModTime: info.ModTime(), Size: info.Size(), Workspaces: workspaces, LocalDependencies: deps, Scripts: []cachedScript{}}
+	entry.Name, _ = packageJSON["name"].(string)
+	entry.Version, _ = packageJSON["version"].(string)
+	entry.Hide = HidePatterns(packageJSON)
+	entry.OS, entry.CPU = PlatformFields(packageJSON)
+	for _, s := range scripts {
+		// Depends on server.js rather than package.json, it is worked out
+		// again on every lookup
+		if !s.Implicit {
+			entry.Scripts = append(entry.Scripts, cachedScript{Name: s.ScriptName, Command: s.Command, Line: s.Line})
+		}
+	}
+	c.mu.Lock()
+	c.entries[abs] = entry
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// Save writes the cache back when it changed, dropping the entries of
+// package.json files that no longer exist.
+func (c *ScriptCache) Save() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path := range c.entries {
+		if _, err := os.Stat(path); err != nil {
+			delete(c.entries, path)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return
+	}
+	path, err := scriptCachePath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(scriptCacheFile{Version: scriptCacheVersion, Packages: c.entries})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		Debugf("cannot write script cache: %v", err)
+		return
+	}
+	// Write and rename, so a concurrent run never reads half a file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		Debugf("cannot write script cache: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		Debugf("cannot write script cache: %v", err)
+		return
+	}
+	c.dirty = false
+}
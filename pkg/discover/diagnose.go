@@ -0,0 +1,250 @@
+package discover
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Diagnosis is what Diagnose found out about the discovery below a root.
+type Diagnosis struct {
+	// Roots are the package.json files the directory walk found.
+	Roots []DiagnosedRoot
+	// Workspaces counts the workspace packages found through Roots.
+	Workspaces int
+	// Uncovered are walked package.json files that neither declare
+	// workspaces nor are at the root, strays next to a workspace.
+	Uncovered []string
+	// Unreadable are directories and files that could not be read.
+	Unreadable []PathError
+	// Malformed are package.json and pnpm-workspace.yaml files that do not
+	// parse.
+	Malformed []PathError
+	// Lockfiles lists the directories with more than one lockfile.
+	Lockfiles []LockfileConflict
+	// Unsupported are workspace configs discovery does not read, like
+	// lerna.json.
+	Unsupported []string
+}
+
+// DiagnosedRoot is a package.json found by the walk.
+type DiagnosedRoot struct {
+	Path           string
+	PackageManager string
+	// Sources are its workspace declarations, none for a plain package.
+	Sources []WorkspaceSource
+}
+
+// WorkspaceSource is one file declaring workspaces, the package.json
+// workspaces field or a pnpm-workspace.yaml.
+type WorkspaceSource struct {
+	Path     string
+	Patterns []PatternMatch
+}
+
+// PatternMatch is how many packages a workspace pattern matched, or for an
+// exclusion removed.
+type PatternMatch struct {
+	Pattern string
+	Exclude bool
+	Matches int
+}
+
+// PathError is a path and what went wrong with it.
+type PathError struct {
+	Path string
+	Err  error
+}
+
+// LockfileConflict is a directory with several lockfiles.
+type LockfileConflict struct {
+	Dir   string
+	Files []string
+}
+
+// unsupportedWorkspaceConfigs are monorepo configs whose package lists
+// discovery does not read.
+var unsupportedWorkspaceConfigs = []string{"lerna.json", "rush.json", "nx.json"}
+
+// Diagnose is Scanner.Diagnose on the real filesystem.
+func Diagnose(rootPath string) Diagnosis {
+	return defaultScanner.Diagnose(rootPath)
+}
+
+// Diagnose walks rootPath like FindPackages and expands the workspaces of
+// what it finds like ExtractScripts, one directory at a time, recording
+// everything that may keep a package from being discovered or a package
+// manager from being inferred as expected.
+func (s *Scanner) Diagnose(rootPath string) Diagnosis {
+	var d Diagnosis
+	var roots []string
+	s.diagnoseWalk(rootPath, &roots, &d)
+
+	cache := newStatCache(s.fsys)
+	dirs := map[string]bool{rootPath: true}
+	for _, path := range roots {
+		dir := filepath.Dir(path)
+		dirs[dir] = true
+		root := DiagnosedRoot{Path: path, PackageManager: s.InferPackageManager(path)}
+		for _, name := range unsupportedWorkspaceConfigs {
+			if cache.exists(filepath.Join(dir, name)) {
+				d.Unsupported = append(d.Unsupported, filepath.Join(dir, name))
+			}
+		}
+
+		packageJSON, ok := s.diagnoseJSON(path, &d)
+		if !ok {
+			d.Roots = append(d.Roots, root)
+			continue
+		}
+		var members []string
+		if patterns := WorkspacePatterns(packageJSON); len(patterns) > 0 {
+			source := WorkspaceSource{Path: path}
+			for _, pattern := range patterns {
+				matches := packageDirs(cache, filepath.Join(dir, pattern))
+				members = append(members, matches...)
+				source.Patterns = append(source.Patterns, PatternMatch{Pattern: pattern, Matches: len(matches)})
+			}
+			root.Sources = append(root.Sources, source)
+		}
+		if pnpmPath := filepath.Join(dir, "pnpm-workspace.yaml"); cache.exists(pnpmPath) {
+			source, matches := s.diagnosePnpm(pnpmPath, cache, &d)
+			members = append(members, matches...)
+			root.Sources = append(root.Sources, source)
+		}
+
+		seen := map[string]bool{}
+		for _, member := range members {
+			if seen[member] || member == dir {
+				continue
+			}
+			seen[member] = true
+			d.Workspaces++
+			dirs[member] = true
+			s.diagnoseJSON(filepath.Join(member, "package.json"), &d)
+		}
+		if len(root.Sources) == 0 && filepath.Clean(dir) != filepath.Clean(rootPath) {
+			d.Uncovered = append(d.Uncovered, path)
+		}
+		d.Roots = append(d.Roots, root)
+	}
+
+	for dir := range dirs {
+		var files []string
+		for _, lock := range knownLockFiles {
+			if cache.exists(filepath.Join(dir, lock.name)) {
+				files = append(files, lock.name)
+			}
+		}
+		if len(files) > 1 {
+			d.Lockfiles = append(d.Lockfiles, LockfileConflict{Dir: dir, Files: files})
+		}
+	}
+	sort.Slice(d.Lockfiles, func(i, j int) bool { return d.Lockfiles[i].Dir < d.Lockfiles[j].Dir })
+	sort.Slice(d.Roots, func(i, j int) bool { return d.Roots[i].Path < d.Roots[j].Path })
+	sort.Strings(d.Uncovered)
+	return d
+}
+
+// diagnoseWalk is findPackageJSON without the concurrency, collecting the
+// directories it cannot read.
+func (s *Scanner) diagnoseWalk(path string, roots *[]string, d *Diagnosis) {
+	entries, err := s.fsys.ReadDir(path)
+	if err != nil {
+		d.Unreadable = append(d.Unreadable, PathError{Path: path, Err: err})
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() == "package.json" && s.isFileEntry(path, entry) {
+			*roots = append(*roots, filepath.Join(path, entry.Name()))
+			return
+		}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !IgnoredDirs[entry.Name()] {
+			s.diagnoseWalk(filepath.Join(path, entry.Name()), roots, d)
+		}
+	}
+}
+
+// diagnoseJSON reads the package.json at path, recording why it cannot.
+func (s *Scanner) diagnoseJSON(path string, d *Diagnosis) (map[string]any, bool) {
+	data, err := s.fsys.ReadFile(path)
+	if err != nil {
+		d.Unreadable = append(d.Unreadable, PathError{Path: path, Err: err})
+		return nil, false
+	}
+	var packageJSON map[string]any
+	if err := json.Unmarshal(data, &packageJSON); err != nil {
+		d.Malformed = append(d.Malformed, PathError{Path: path, Err: err})
+		return nil, false
+	}
+	return packageJSON, true
+}
+
+// diagnosePnpm counts the matches of every pattern of the
+// pnpm-workspace.yaml at path, and returns the package directories left
+// after the exclusions.
+func (s *Scanner) diagnosePnpm(path string, cache *statCache, d *Diagnosis) (WorkspaceSource, []string) {
+	source := WorkspaceSource{Path: path}
+	data, err := s.fsys.ReadFile(path)
+	if err != nil {
+		d.Unreadable = append(d.Unreadable, PathError{Path: path, Err: err})
+		return source, nil
+	}
+	var ws pnpmWorkspace
+	if err := yaml.Unmarshal(data, &ws); err != nil {
+		d.Malformed = append(d.Malformed, PathError{Path: path, Err: err})
+		return source, nil
+	}
+	dir := filepath.Dir(path)
+	included := map[string]string{}
+	var excludes []string
+	for _, pattern := range ws.Packages {
+		pattern = strings.TrimSpace(pattern)
+		if exclude, ok := strings.CutPrefix(pattern, "!"); ok {
+			excludes = append(excludes, exclude)
+			continue
+		}
+		matches := packageDirs(cache, filepath.Join(dir, pattern))
+		for _, match := range matches {
+			included[globKey(match)] = match
+		}
+		source.Patterns = append(source.Patterns, PatternMatch{Pattern: pattern, Matches: len(matches)})
+	}
+	for _, exclude := range excludes {
+		removed := 0
+		for _, match := range packageDirs(cache, filepath.Join(dir, exclude)) {
+			if _, ok := included[globKey(match)]; ok {
+				delete(included, globKey(match))
+				removed++
+			}
+		}
+		source.Patterns = append(source.Patterns, PatternMatch{Pattern: exclude, Exclude: true, Matches: removed})
+	}
+	var members []string
+	for _, match := range included {
+		members = append(members, match)
+	}
+	sort.Strings(members)
+	return source, members
+}
+
+// packageDirs returns the directories matching pattern that have a
+// package.json.
+func packageDirs(cache *statCache, pattern string) []string {
+	matches, err := glob(cache.fsys, pattern)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, match := range matches {
+		if cache.exists(filepath.Join(match, "package.json")) {
+			dirs = append(dirs, match)
+		}
+	}
+	return dirs
+}
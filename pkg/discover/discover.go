@@ -0,0 +1,772 @@
+// Package discover finds the package.json files below a directory, follows
+// their npm, yarn and pnpm workspaces and extracts the scripts they declare.
+package discover
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Progress counts the directories read and the package.json files parsed
+// or looked up in the cache by all scans so far, for progress displays and
+// --stats.
+var Progress struct {
+	Dirs     atomic.Int64
+	Packages atomic.Int64
+	// Cached counts the Packages whose scripts came from the script cache.
+	Cached atomic.Int64
+	// ParseTime and WorkspaceTime are the nanoseconds spent reading
+	// package.json files and expanding workspace patterns, summed over the
+	// goroutines doing it concurrently.
+	ParseTime     atomic.Int64
+	WorkspaceTime atomic.Int64
+}
+
+// Debugf receives the verbose log of the scan. It discards everything
+// unless set, and must not be changed while a scan runs.
+var Debugf = func(format string, args ...any) {}
+
+// NpmScript is one script of a package.json.
+type NpmScript struct {
+	PackageName  string
+	ScriptName   string
+	Command      string
+	AbsolutePath string
+	// Line is the 1-based line of the script's key in package.json.
+	Line int
+	// PackageManager is inferred from the nearest lockfile during the scan.
+	PackageManager string
+	// Implicit marks npm's default start script, which package.json does
+	// not declare. Line is 0 then.
+	Implicit bool
+	// NameDerived is set when package.json has no name, PackageName is
+	// then derived from its directory and wrapped in brackets.
+	NameDerived bool
+	// PackageVersion is the "version" of the package.json, empty when it
+	// has none.
+	PackageVersion string
+	// Source tells how the scan found the package, one of the Source
+	// constants. It is empty for a package.json read on its own.
+	Source string
+	// Hidden is set for scripts matched by the hide globs of their
+	// package.json, see HidePatterns.
+	Hidden bool
+	// Incompatible says which of the os and cpu fields of the package.json
+	// exclude the running system, like "os linux", see Platform. It is
+	// empty for packages that can run here.
+	Incompatible string
+}
+
+// How a scan found a package.json, see NpmScript.Source.
+const (
+	// SourceWalk is a package found by the directory walk.
+	SourceWalk = "walk"
+	// SourceWorkspaceRoot is a package found by the directory walk that
+	// declares workspaces, in package.json or pnpm-workspace.yaml.
+	SourceWorkspaceRoot = "workspace-root"
+	// SourceWorkspace is a package found through the workspaces of
+	// another one.
+	SourceWorkspace = "workspace"
+	// SourceDependency is a package found through a file: or link:
+	// dependency of another one.
+	SourceDependency = "dependency"
+)
+
+// Label is how the script is shown to the user, "package > (script)".
+func (s NpmScript) Label() string {
+	return fmt.Sprintf("%s > (%s)", s.PackageName, s.ScriptName)
+}
+
+// DeclaredName is the "name" of the package.json, empty when it has none.
+func (s NpmScript) DeclaredName() string {
+	if s.NameDerived {
+		return ""
+	}
+	return s.PackageName
+}
+
+// packageDisplayName returns the name shown for the package.json at filePath
+// declaring name: name itself, or for a nameless package its directory
+// relative to the repository root in brackets, like "[tools/lint]". The
+// root of the repository, and a package outside of one, are named after
+// their directory.
+func (s *Scanner) packageDisplayName(filePath, name string) (string, bool) {
+	if name != "" {
+		return name, false
+	}
+	dir := s.abs(filepath.Dir(filePath))
+	derived := filepath.Base(dir)
+	home, _ := os.UserHomeDir()
+	for current := dir; ; {
+		if isRepoRoot(s.fsys, current) {
+			if rel, err := filepath.Rel(current, dir); err == nil && rel != "." {
+				derived = filepath.ToSlash(rel)
+			}
+			break
+		}
+		parent := filepath.Dir(current)
+		if current == home || parent == current {
+			break
+		}
+		current = parent
+	}
+	return "[" + derived + "]", true
+}
+
+// ID identifies the script across runs: a hash of the absolute path of its
+// package.json and its name, so it only changes when either of them does.
+func (s NpmScript) ID() string {
+	path, err := filepath.Abs(s.AbsolutePath)
+	if err != nil {
+		path = s.AbsolutePath
+	}
+	sum := sha256.Sum256([]byte(path + "\x00" + s.ScriptName))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Scanner discovers packages and their scripts in a filesystem. It
+// remembers the lockfiles it came across, so one Scanner should be used
+// per tree. It is safe for concurrent use.
+type Scanner struct {
+	fsys  FS
+	locks *lockFileIndex
+	// cache is only used by defaultScanner, see UseCache.
+	cache *ScriptCache
+}
+
+// NewScanner returns a Scanner reading fsys.
+func NewScanner(fsys FS) *Scanner {
+	return &Scanner{fsys: fsys, locks: &lockFileIndex{dirs: map[string]dirMarkers{}}}
+}
+
+// defaultScanner backs the package-level functions.
+var defaultScanner = NewScanner(OS)
+
+// abs makes path absolute on the real filesystem, where lockfiles and
+// repository roots above the scanned directory are looked for.
+func (s *Scanner) abs(path string) string {
+	if s.fsys == OS {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+	}
+	return path
+}
+
+// FindPackages is Scanner.FindPackages on the real filesystem.
+func FindPackages(ctx context.Context, rootPath string) []string {
+	return defaultScanner.FindPackages(ctx, rootPath)
+}
+
+// ExtractScripts is Scanner.ExtractScripts on the real filesystem.
+func ExtractScripts(ctx context.Context, filepaths []string) []NpmScript {
+	return defaultScanner.ExtractScripts(ctx, filepaths)
+}
+
+// Workspaces is Scanner.Workspaces on the real filesystem.
+func Workspaces(ctx context.Context, packageJSONPath string) ([]string, error) {
+	return defaultScanner.Workspaces(ctx, packageJSONPath)
+}
+
+// ReadPackageJSON is Scanner.ReadPackageJSON on the real filesystem.
+func ReadPackageJSON(filePath string) (map[string]any, []NpmScript, error) {
+	return defaultScanner.ReadPackageJSON(filePath)
+}
+
+// Workspace represents the structure of the pnpm-workspace.yaml file.
+type pnpmWorkspace struct {
+	Packages []string `yaml:"packages"`
+}
+
+// FindPackages returns the package.json files of the project roots below
+// rootPath: directories are searched concurrently, skipping IgnoredDirs,
+// and the search does not descend below a package.json. Workspaces are
+// found by ExtractScripts. The result is partial when ctx is cancelled.
+func (s *Scanner) FindPackages(ctx context.Context, rootPath string) []string {
+	var wg sync.WaitGroup
+	pathsChan := make(chan string, 100) // Buffered channel to prevent blocking
+
+	// Create a goroutine to traverse the filesystem
+	wg.Add(1)
+	go s.findPackageJSON(ctx, rootPath, pathsChan, &wg)
+
+	// Wait for all goroutines to finish in a separate goroutine
+	go func() {
+		wg.Wait()
+		close(pathsChan)
+	}()
+
+	// Collect paths from the channel
+	var filepaths []string
+	for path := range pathsChan {
+		filepaths = append(filepaths, path)
+	}
+
+	return filepaths
+}
+
+// IgnoredDirs are directory names FindPackages never enters. It may be
+// extended before a scan, not during one.
+var IgnoredDirs map[string]bool = map[string]bool{
+	".circleci": true,
+	".github":   true,
+
+	".git": true,
+	".hg":  true,
+	".svn": true,
+
+	".idea":   true,
+	".vscode": true,
+
+	"node_modules": true,
+
+	"__tests__":     true,
+	"__test__":      true,
+	"__specs__":     true,
+	"__spec__":      true,
+	"__mocks__":     true,
+	"__mock__":      true,
+	"__snapshots__": true,
+	"__fixtures__":  true,
+}
+
+// findPackageJSON sends the nearest package.json files below path, without
+// descending into a directory once it has one. Entries come from a single
+// ReadDir per directory; only a symlinked package.json needs a Stat to
+// see what it points to. Symlinked directories are not followed.
+func (s *Scanner) findPackageJSON(ctx context.Context, path string, paths chan<- string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if ctx.Err() != nil {
+		return
+	}
+
+	entries, err := s.fsys.ReadDir(path)
+	if err != nil {
+		Debugf("skip %s: %v", path, err)
+		return
+	}
+	Debugf("scan %s", path)
+	Progress.Dirs.Add(1)
+	s.locks.record(s.abs(path), entries)
+
+	// If package.json file is in the currently searched directory
+	// we can stop the search here
+	for _, entry := range entries {
+		if entry.Name() == "package.json" && s.isFileEntry(path, entry) {
+			select {
+			case paths <- filepath.Join(path, entry.Name()):
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if IgnoredDirs[entry.Name()] {
+			Debugf("skip %s: ignored directory", filepath.Join(path, entry.Name()))
+			continue
+		}
+		wg.Add(1)
+		go s.findPackageJSON(ctx, filepath.Join(path, entry.Name()), paths, wg)
+	}
+}
+
+// isFileEntry reports whether entry of dir is a file, following a symlink.
+func (s *Scanner) isFileEntry(dir string, entry fs.DirEntry) bool {
+	if entry.Type()&fs.ModeSymlink == 0 {
+		return !entry.IsDir()
+	}
+	info, err := s.fsys.Stat(filepath.Join(dir, entry.Name()))
+	return err == nil && !info.IsDir()
+}
+
+// locatePnpmWorkspaces returns the sorted workspace directories matched by
+// the pnpm-workspace.yaml in pnpmWorkspaceRoot, minus the excluded ones.
+func locatePnpmWorkspaces(ctx context.Context, pnpmWorkspaceRoot string, cache *statCache) ([]string, error) {
+	data, err := cache.fsys.ReadFile(filepath.Join(pnpmWorkspaceRoot, "pnpm-workspace.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal YAML into our Workspace struct.
+	var ws pnpmWorkspace
+	if err := yaml.Unmarshal(data, &ws); err != nil {
+		return nil, fmt.Errorf("parsing YAML: %w", err)
+	}
+
+	var includePatterns []string
+	var excludePatterns []string
+
+	// Separate inclusion and exclusion patterns.
+	for _, pattern := range ws.Packages {
+		trimmed := strings.TrimSpace(pattern)
+		if strings.HasPrefix(trimmed, "!") {
+			// Exclusion pattern (remove the "!" prefix).
+			name := filepath.Join(pnpmWorkspaceRoot, strings.TrimPrefix(trimmed, "!"))
+			excludePatterns = append(excludePatterns, name)
+		} else {
+			includePatterns = append(includePatterns, filepath.Join(pnpmWorkspaceRoot, trimmed))
+		}
+	}
+
+	// Expand every pattern at once, then merge in the order of the file
+	includeMatches, includeErrs := cache.globAll(ctx, includePatterns)
+	excludeMatches, excludeErrs := cache.globAll(ctx, excludePatterns)
+
+	// Build a set (map) to store matching workspaces, keyed by globKey so
+	// that excludes remove matches whatever separators they were built
+	// with.
+	matchesSet := make(map[string]string)
+
+	// Process include patterns.
+	for i, pattern := range includePatterns {
+		if err := includeErrs[i]; err != nil {
+			return nil, fmt.Errorf("expanding include pattern %q: %w", pattern, err)
+		}
+		for _, match := range includeMatches[i] {
+			// The item exists, even if it is not a directory.
+			if cache.exists(match) {
+				matchesSet[globKey(match)] = match
+			}
+		}
+	}
+
+	// Process exclusion patterns.
+	for i, pattern := range excludePatterns {
+		if err := excludeErrs[i]; err != nil {
+			return nil, fmt.Errorf("expanding exclude pattern %q: %w", pattern, err)
+		}
+		for _, match := range excludeMatches[i] {
+			delete(matchesSet, globKey(match))
+		}
+	}
+
+	// Convert the set of matches to a sorted slice.
+	var result []string
+	for _, match := range matchesSet {
+		result = append(result, match)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// ReadPackageJSON parses the package.json at filePath and returns its
+// decoded content along with its scripts in declaration order.
+func (s *Scanner) ReadPackageJSON(filePath string) (map[string]any, []NpmScript, error) {
+	byteValue, err := s.fsys.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Unmarshal the JSON content
+	var packageJSON map[string]any
+	err = json.Unmarshal(byteValue, &packageJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name, _ := packageJSON["name"].(string)
+	packageName, derived := s.packageDisplayName(filePath, name)
+	version, _ := packageJSON["version"].(string)
+
+	// Extract the scripts
+	var scripts []NpmScript
+	if scriptsMap, ok := packageJSON["scripts"].(map[string]any); ok {
+		for _, key := range scriptKeys(byteValue) {
+			command, ok := scriptsMap[key.name].(string)
+			if !ok {
+				Debugf("skip script %q in %s: not a string", key.name, filePath)
+				continue
+			}
+			scripts = append(scripts, NpmScript{PackageName: packageName, ScriptName: key.name, Command: command, AbsolutePath: filePath, Line: key.line, NameDerived: derived, PackageVersion: version})
+		}
+	}
+	if start, ok := implicitStart(s.fsys, filePath, packageName, scripts); ok {
+		start.NameDerived, start.PackageVersion = derived, version
+		scripts = append(scripts, start)
+	}
+	hideScripts(scripts, HidePatterns(packageJSON))
+	osList, cpuList := PlatformFields(packageJSON)
+	markIncompatible(scripts, osList, cpuList)
+
+	return packageJSON, scripts, nil
+}
+
+// scriptKey is a key of the "scripts" object and the line it is on.
+type scriptKey struct {
+	name string
+	line int
+}
+
+// scriptKeys returns the keys of the "scripts" object in the order they are
+// declared, which decoding into a map does not preserve, together with
+// their line numbers.
+func scriptKeys(data []byte) []scriptKey {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if tok != "scripts" {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return nil
+		}
+		var keys []scriptKey
+		seen := map[string]bool{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			name, _ := tok.(string)
+			line := bytes.Count(data[:dec.InputOffset()], []byte("\n")) + 1
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				break
+			}
+			if !seen[name] {
+				seen[name] = true
+				keys = append(keys, scriptKey{name: name, line: line})
+			}
+		}
+		return keys
+	}
+	return nil
+}
+
+// WorkspacePatterns returns the workspaces of a package.json, given as
+// an array or as an object with a packages array.
+func WorkspacePatterns(packageJSON map[string]any) []string {
+	var workspacePatterns []string
+	var patterns []any
+	switch workspaces := packageJSON["workspaces"].(type) {
+	case []any:
+		patterns = workspaces
+	case map[string]any:
+		patterns, _ = workspaces["packages"].([]any)
+	}
+	for _, pattern := range patterns {
+		if pattern, ok := pattern.(string); ok {
+			workspacePatterns = append(workspacePatterns, pattern)
+		}
+	}
+	return workspacePatterns
+}
+
+// DefaultParseJobs is how many package.json files are read at the same
+// time unless SetParseJobs says otherwise. Every reader holds a file open.
+const DefaultParseJobs = 256
+
+// parseSlots limits concurrent package.json reads, one token per reader.
+// Workspace expansion starts readers recursively, so a token is only held
+// while reading and released before any further readers are started or
+// results are sent, which can never deadlock.
+var parseSlots = make(chan struct{}, DefaultParseJobs)
+
+// SetParseJobs limits how many package.json files are read at the same
+// time, n must be at least 1. It must not be called while a scan runs.
+func SetParseJobs(n int) {
+	parseSlots = make(chan struct{}, n)
+}
+
+// LocalDependencies returns the directories of the file: and link:
+// dependencies of a package.json, as written there, sorted.
+func LocalDependencies(packageJSON map[string]any) []string {
+	var dirs []string
+	for _, field := range []string{"dependencies", "devDependencies", "optionalDependencies"} {
+		deps, _ := packageJSON[field].(map[string]any)
+		for _, spec := range deps {
+			spec, _ := spec.(string)
+			if dir, ok := strings.CutPrefix(spec, "file:"); ok {
+				dirs = append(dirs, dir)
+			} else if dir, ok := strings.CutPrefix(spec, "link:"); ok {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// FollowLocalDependencies makes scans also extract the packages that file:
+// and link: dependencies point to. It may be changed before a scan, not
+// during one.
+var FollowLocalDependencies = true
+
+// maxDependencyDepth bounds how many file: and link: dependencies deep a
+// chain of local packages is followed.
+const maxDependencyDepth = 8
+
+// scan is the state shared by the extractions of one discovery: the Stat
+// results and the package.json files already extracted or queued, so a
+// package reached several ways is listed once.
+type scan struct {
+	stats   *statCache
+	abs     func(string) string
+	visited sync.Map
+}
+
+func (s *Scanner) newScan() *scan {
+	return &scan{stats: newStatCache(s.fsys), abs: s.abs}
+}
+
+// visit marks filePath as extracted and reports whether it was not yet.
+// Paths are compared absolute, dependencies lead to relative paths like
+// "../repo/app/package.json" for "app/package.json".
+func (sc *scan) visit(filePath string) bool {
+	_, seen := sc.visited.LoadOrStore(filepath.Clean(sc.abs(filePath)), true)
+	return !seen
+}
+
+// loadPackageScripts returns the scripts, workspace patterns and local
+// dependencies of the package.json at filePath, from the script cache when
+// the file did not change since it was last parsed.
+func (s *Scanner) loadPackageScripts(filePath string) ([]NpmScript, []string, []string, error) {
+	if s.cache != nil {
+		if scripts, workspaces, deps, ok := s.cache.lookup(filePath); ok {
+			Debugf("cached %s: %d scripts", filePath, len(scripts))
+			Progress.Cached.Add(1)
+			return scripts, workspaces, deps, nil
+		}
+	}
+	packageJSON, scripts, err := s.ReadPackageJSON(filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	Debugf("parsed %s: %d scripts", filePath, len(scripts))
+	workspaces := WorkspacePatterns(packageJSON)
+	deps := LocalDependencies(packageJSON)
+	if s.cache != nil {
+		s.cache.store(filePath, packageJSON, scripts, workspaces, deps)
+	}
+	return scripts, workspaces, deps, nil
+}
+
+// extractScripts sends the scripts of the package.json at filePath, found
+// as source, then extracts the packages of its file: and link:
+// dependencies, depth being how many of them led here, and, for a package
+// found by the walk, of its workspaces. Callers mark filePath visited.
+func (s *Scanner) extractScripts(ctx context.Context, filePath string, source string, depth int, sc *scan, scriptsChan chan<- []NpmScript, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	select {
+	case parseSlots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	started := time.Now()
+	scripts, workspacePatterns, deps, err := s.loadPackageScripts(filePath)
+	Progress.ParseTime.Add(int64(time.Since(started)))
+	<-parseSlots
+	if err != nil {
+		Debugf("cannot parse %s: %v", filePath, err)
+		return
+	}
+	Progress.Packages.Add(1)
+	pm := s.InferPackageManager(filePath)
+	isLeaf := source != SourceWalk
+	if !isLeaf && (len(workspacePatterns) > 0 || sc.stats.exists(filepath.Join(filepath.Dir(filePath), "pnpm-workspace.yaml"))) {
+		source = SourceWorkspaceRoot
+	}
+	for i := range scripts {
+		scripts[i].PackageManager = pm
+		scripts[i].Source = source
+	}
+	if len(scripts) > 0 {
+		select {
+		case scriptsChan <- scripts:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if n := len(scripts); n > 0 && scripts[n-1].Implicit {
+		Debugf("%s has no start script, added npm's default %q", filePath, scripts[n-1].Command)
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Workspaces are queued first, so that a workspace package another one
+	// links to is listed as a workspace
+	if !isLeaf {
+		started := time.Now()
+		workspaces := workspacePackages(ctx, filePath, workspacePatterns, sc.stats)
+		Progress.WorkspaceTime.Add(int64(time.Since(started)))
+		for _, workspace := range workspaces {
+			if sc.visit(workspace) {
+				wg.Add(1)
+				go s.extractScripts(ctx, workspace, SourceWorkspace, 0, sc, scriptsChan, wg)
+			}
+		}
+	}
+	if !FollowLocalDependencies || len(deps) == 0 {
+		return
+	}
+	if depth >= maxDependencyDepth {
+		Debugf("not following the local dependencies of %s: %d deep already", filePath, depth)
+		return
+	}
+	for _, dep := range deps {
+		depPath := filepath.Join(filepath.Dir(filePath), filepath.FromSlash(dep), "package.json")
+		if !sc.stats.exists(depPath) {
+			Debugf("local dependency %q of %s has no package.json", dep, filePath)
+			continue
+		}
+		if sc.visit(depPath) {
+			Debugf("local dependency %q of %s", dep, filePath)
+			wg.Add(1)
+			go s.extractScripts(ctx, depPath, SourceDependency, depth+1, sc, scriptsChan, wg)
+		}
+	}
+}
+
+// Workspaces returns the package.json files of the workspaces of the
+// package.json at packageJSONPath, declared in its workspaces field or in
+// a pnpm-workspace.yaml next to it, in declaration order.
+func (s *Scanner) Workspaces(ctx context.Context, packageJSONPath string) ([]string, error) {
+	packageJSON, _, err := s.ReadPackageJSON(packageJSONPath)
+	if err != nil {
+		return nil, err
+	}
+	return workspacePackages(ctx, packageJSONPath, WorkspacePatterns(packageJSON), newStatCache(s.fsys)), nil
+}
+
+// workspacePackages expands the workspace patterns of the package.json at
+// filePath, and its pnpm-workspace.yaml if any, into the package.json files
+// that exist.
+func workspacePackages(ctx context.Context, filePath string, workspacePatterns []string, cache *statCache) []string {
+	var packages []string
+	// Process the workspace patterns, expanding the globs concurrently
+	if len(workspacePatterns) > 0 {
+		knownWorkspaces := make(map[string]bool)
+		var globs []string
+		for _, workspacePattern := range workspacePatterns {
+			if strings.ContainsAny(workspacePattern, "*?[") {
+				globs = append(globs, filepath.Join(filepath.Dir(filePath), workspacePattern))
+			}
+		}
+		globMatches, globErrs := cache.globAll(ctx, globs)
+
+		g := 0
+		for _, workspacePattern := range workspacePatterns {
+			isGlob := strings.ContainsAny(workspacePattern, "*?[")
+			workspacePath := filepath.Join(filepath.Dir(filePath), workspacePattern)
+
+			if isGlob {
+				// If the workspace is a glob pattern, find all matching directories
+				matches, err := globMatches[g], globErrs[g]
+				g++
+				if err != nil {
+					Debugf("workspace pattern %q in %s: %v", workspacePattern, filePath, err)
+					continue
+				}
+				Debugf("workspace pattern %q in %s matched %d paths", workspacePattern, filePath, len(matches))
+				for _, match := range matches {
+					workspacePackageJSONPath := filepath.Join(match, "package.json")
+					if knownWorkspaces[workspacePackageJSONPath] {
+						continue
+					}
+					knownWorkspaces[workspacePackageJSONPath] = true
+					if cache.exists(workspacePackageJSONPath) {
+						packages = append(packages, workspacePackageJSONPath)
+					}
+				}
+			} else {
+				// If the workspace is a directory, check if package.json exists
+				workspacePackageJSONPath := filepath.Join(workspacePath, "package.json")
+				Debugf("workspace %q in %s", workspacePattern, filePath)
+				if knownWorkspaces[workspacePackageJSONPath] {
+					continue
+				}
+				knownWorkspaces[workspacePackageJSONPath] = true
+				if cache.exists(workspacePackageJSONPath) {
+					packages = append(packages, workspacePackageJSONPath)
+				}
+			}
+		}
+	}
+
+	dirname := filepath.Dir(filePath)
+	pnpmWorkspacePath := filepath.Join(dirname, "pnpm-workspace.yaml")
+
+	if cache.exists(pnpmWorkspacePath) {
+		result, err := locatePnpmWorkspaces(ctx, dirname, cache)
+		if err != nil {
+			Debugf("cannot read %s: %v", pnpmWorkspacePath, err)
+		} else {
+			Debugf("%s matched %d paths", pnpmWorkspacePath, len(result))
+			for _, match := range result {
+				workspacePackageJSONPath := filepath.Join(match, "package.json")
+				// Skip the current package.json
+				if workspacePackageJSONPath == filePath {
+					continue
+				}
+				if cache.exists(workspacePackageJSONPath) {
+					packages = append(packages, workspacePackageJSONPath)
+				}
+			}
+		}
+	}
+	return packages
+}
+
+// ExtractScripts returns the scripts of every package.json in filepaths and
+// of their workspaces, parsed concurrently. Scripts of one package keep
+// their declaration order. The result is partial when ctx is cancelled.
+func (s *Scanner) ExtractScripts(ctx context.Context, filepaths []string) []NpmScript {
+	var wg sync.WaitGroup
+	scriptsChan := make(chan []NpmScript, len(filepaths))
+	sc := s.newScan()
+
+	for _, path := range filepaths {
+		if sc.visit(path) {
+			wg.Add(1)
+			go s.extractScripts(ctx, path, SourceWalk, 0, sc, scriptsChan, &wg)
+		}
+	}
+
+	// Wait for all goroutines to finish in a separate goroutine
+	go func() {
+		wg.Wait()
+		close(scriptsChan)
+	}()
+
+	// Collect all scripts from the channel
+	var allScripts []NpmScript
+	for scripts := range scriptsChan {
+		allScripts = append(allScripts, scripts...)
+	}
+
+	return allScripts
+}
@@ -0,0 +1,459 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+// file returns a MapFS file holding data.
+func file(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+// scanFixture runs a full discovery of fsys from its root and returns every script
+// as "package > (script) pm", sorted.
+func scanFixture(t *testing.T, fsys fstest.MapFS) []string {
+	t.Helper()
+	scanner := NewScanner(IOFS(fsys))
+	ctx := context.Background()
+	var got []string
+	for _, script := range scanner.ExtractScripts(ctx, scanner.FindPackages(ctx, ".")) {
+		got = append(got, fmt.Sprintf("%s %s", script.Label(), script.PackageManager))
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  []string
+	}{
+		{
+			name: "plain repo",
+			files: fstest.MapFS{
+				"package.json":      file(`{"name": "app", "scripts": {"build": "tsc", "test": "jest"}}`),
+				"package-lock.json": file(`{}`),
+				"src/index.ts":      file(``),
+			},
+			want: []string{"app > (build) npm", "app > (test) npm"},
+		},
+		{
+			name: "npm workspaces array",
+			files: fstest.MapFS{
+				"package.json":            file(`{"name": "root", "workspaces": ["packages/*"], "scripts": {"lint": "eslint ."}}`),
+				"package-lock.json":       file(`{}`),
+				"packages/a/package.json": file(`{"name": "a", "scripts": {"build": "tsc"}}`),
+				"packages/b/package.json": file(`{"name": "b", "scripts": {"build": "tsc"}}`),
+				"packages/notes.txt":      file(``),
+			},
+			want: []string{"a > (build) npm", "b > (build) npm", "root > (lint) npm"},
+		},
+		{
+			name: "yarn workspaces object",
+			files: fstest.MapFS{
+				"package.json":             file(`{"name": "root", "private": true, "workspaces": {"packages": ["apps/*", "tools/cli"]}}`),
+				"yarn.lock":                file(``),
+				"apps/web/package.json":    file(`{"name": "web", "scripts": {"dev": "vite"}}`),
+				"tools/cli/package.json":   file(`{"name": "cli", "scripts": {"start": "node ."}}`),
+				"tools/other/package.json": file(`{"name": "other", "scripts": {"start": "node ."}}`),
+			},
+			want: []string{"cli > (start) yarn", "web > (dev) yarn"},
+		},
+		{
+			name: "pnpm workspace with exclusions",
+			files: fstest.MapFS{
+				"package.json":                   file(`{"name": "root", "scripts": {"build": "turbo build"}}`),
+				"pnpm-lock.yaml":                 file(``),
+				"pnpm-workspace.yaml":            file("packages:\n  - 'packages/*'\n  - '!packages/internal'\n  - '!**/fixtures'\n"),
+				"packages/ui/package.json":       file(`{"name": "ui", "scripts": {"build": "tsc"}}`),
+				"packages/internal/package.json": file(`{"name": "internal", "scripts": {"build": "tsc"}}`),
+				"packages/fixtures/package.json": file(`{"name": "fixtures", "scripts": {"build": "tsc"}}`),
+			},
+			want: []string{"root > (build) pnpm", "ui > (build) pnpm"},
+		},
+		{
+			name: "nested packages",
+			files: fstest.MapFS{
+				"apps/web/package.json":                 file(`{"name": "web", "scripts": {"dev": "vite"}}`),
+				"apps/web/fixtures/package.json":        file(`{"name": "fixture", "scripts": {"dev": "true"}}`),
+				"libs/ui/package.json":                  file(`{"name": "ui", "scripts": {"build": "tsc"}}`),
+				"libs/ui/node_modules/dep/package.json": file(`{"name": "dep", "scripts": {"build": "tsc"}}`),
+				"node_modules/dep/package.json":         file(`{"name": "dep", "scripts": {"build": "tsc"}}`),
+			},
+			want: []string{"ui > (build) npm", "web > (dev) npm"},
+		},
+		{
+			name: "missing names",
+			files: fstest.MapFS{
+				"tools/lint/package.json": file(`{"scripts": {"check": "eslint ."}}`),
+				"web/package.json":        file(`{"name": "", "version": "1.0.0", "scripts": {"dev": "vite"}}`),
+			},
+			want: []string{"[lint] > (check) npm", "[web] > (dev) npm"},
+		},
+		{
+			name: "missing name below the repository root",
+			files: fstest.MapFS{
+				"repo/.git/HEAD":               file(``),
+				"repo/packages/x/package.json": file(`{"scripts": {"build": "tsc"}}`),
+				"repo/packages/y/package.json": file(`{"name": "y", "scripts": {"build": "tsc"}}`),
+				"other/tools/z/package.json":   file(`{"scripts": {"build": "tsc"}}`),
+			},
+			want: []string{"[packages/x] > (build) npm", "[z] > (build) npm", "y > (build) npm"},
+		},
+		{
+			name: "malformed JSON",
+			files: fstest.MapFS{
+				"broken/package.json": file(`{"name": "broken", "scripts": {`),
+				"empty/package.json":  file(``),
+				"good/package.json":   file(`{"name": "good", "scripts": {"test": "jest", "bad": 1}}`),
+			},
+			want: []string{"good > (test) npm"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := scanFixture(t, tt.files)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scripts\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInferPackageManager(t *testing.T) {
+	t.Parallel()
+	fsys := fstest.MapFS{
+		"pnpm/pnpm-lock.yaml":               file(``),
+		"pnpm/package.json":                 file(`{}`),
+		"pnpm/packages/a/package.json":      file(`{}`),
+		"yarn/yarn.lock":                    file(``),
+		"yarn/packages/a/package.json":      file(`{}`),
+		"yarn/packages/b/package-lock.json": file(`{}`),
+		"yarn/packages/b/package.json":      file(`{}`),
+		"bun/bun.lockb":                     file(``),
+		"bun/package.json":                  file(`{}`),
+		"both/pnpm-lock.yaml":               file(``),
+		"both/yarn.lock":                    file(``),
+		"both/package.json":                 file(`{}`),
+		"none/package.json":                 file(`{}`),
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"pnpm/package.json", "pnpm"},
+		{"pnpm/packages/a/package.json", "pnpm"},
+		{"yarn/packages/a/package.json", "yarn"},
+		{"yarn/packages/b/package.json", "npm"},
+		{"bun/package.json", "bun"},
+		{"both/package.json", "pnpm"},
+		{"none/package.json", "npm"},
+	}
+	scanner := NewScanner(IOFS(fsys))
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+			if got := scanner.InferPackageManager(filepath.FromSlash(tt.path)); got != tt.want {
+				t.Errorf("InferPackageManager(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPackageJSON(t *testing.T) {
+	t.Parallel()
+	fsys := fstest.MapFS{
+		"app/package.json": file(`{
+  "name": "@acme/app",
+  "version": "1.2.0",
+  "scripts": {
+    "test": "jest",
+    "build": "tsc",
+    "broken": ["not", "a", "string"],
+    "dev": "vite"
+  }
+}`),
+		"no-scripts/package.json": file(`{"name": "lib", "main": "index.js"}`),
+		"invalid/package.json":    file(`{"name": }`),
+	}
+	scanner := NewScanner(IOFS(fsys))
+
+	packageJSON, scripts, err := scanner.ReadPackageJSON(filepath.Join("app", "package.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packageJSON["version"] != "1.2.0" {
+		t.Errorf("version = %v, want 1.2.0", packageJSON["version"])
+	}
+	var got []string
+	for _, s := range scripts {
+		got = append(got, fmt.Sprintf("%s %s %q line %d v%s", s.PackageName, s.ScriptName, s.Command, s.Line, s.PackageVersion))
+	}
+	want := []string{
+		`@acme/app test "jest" line 5 v1.2.0`,
+		`@acme/app build "tsc" line 6 v1.2.0`,
+		`@acme/app dev "vite" line 8 v1.2.0`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("scripts\n got: %q\nwant: %q", got, want)
+	}
+
+	if _, scripts, err := scanner.ReadPackageJSON(filepath.Join("no-scripts", "package.json")); err != nil || len(scripts) != 0 {
+		t.Errorf("package without scripts: %d scripts, error %v", len(scripts), err)
+	}
+	if _, _, err := scanner.ReadPackageJSON(filepath.Join("invalid", "package.json")); err == nil {
+		t.Error("invalid JSON: no error")
+	}
+	if _, _, err := scanner.ReadPackageJSON(filepath.Join("missing", "package.json")); err == nil {
+		t.Error("missing file: no error")
+	}
+}
+
+func TestWorkspacePatterns(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		packageJSON string
+		want        []string
+	}{
+		{"array", `{"workspaces": ["packages/*", "apps/web"]}`, []string{"packages/*", "apps/web"}},
+		{"object", `{"workspaces": {"packages": ["packages/*"], "nohoist": ["**/react"]}}`, []string{"packages/*"}},
+		{"object without packages", `{"workspaces": {"nohoist": ["**/react"]}}`, nil},
+		{"non-string entries", `{"workspaces": ["packages/*", 1, null]}`, []string{"packages/*"}},
+		{"string", `{"workspaces": "packages/*"}`, nil},
+		{"none", `{"name": "app"}`, nil},
+	}
+	for _, tt := range tests {
+		var packageJSON map[string]any
+		if err := json.Unmarshal([]byte(tt.packageJSON), &packageJSON); err != nil {
+			t.Fatal(err)
+		}
+		if got := WorkspacePatterns(packageJSON); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: WorkspacePatterns = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocalDependencies(t *testing.T) {
+	t.Parallel()
+	var packageJSON map[string]any
+	err := json.Unmarshal([]byte(`{
+		"dependencies": {"react": "^18.0.0", "ui": "file:../ui", "git": "github:acme/git"},
+		"devDependencies": {"tools": "link:./tools", "jest": "29"},
+		"optionalDependencies": {"native": "file:vendor/native"},
+		"peerDependencies": {"peer": "file:../peer"}
+	}`), &packageJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"../ui", "./tools", "vendor/native"}
+	if got := LocalDependencies(packageJSON); !reflect.DeepEqual(got, want) {
+		t.Errorf("LocalDependencies = %q, want %q", got, want)
+	}
+	if got := LocalDependencies(map[string]any{}); got != nil {
+		t.Errorf("LocalDependencies of an empty package.json = %q, want none", got)
+	}
+}
+
+func TestInferPackageManagerBoundaries(t *testing.T) {
+	t.Parallel()
+	fsys := fstest.MapFS{
+		"package.json":                            file(`{}`),
+		"yarn.lock":                               file(``),
+		"repo/.git/HEAD":                          file(``),
+		"repo/pnpm-lock.yaml":                     file(``),
+		"repo/packages/a/package.json":            file(`{}`),
+		"outer/pnpm-lock.yaml":                    file(``),
+		"outer/inner/.git":                        file(`gitdir: ../.git/modules/inner`),
+		"outer/inner/packages/b/package.json":     file(`{}`),
+		"outer/inner/bun.lock":                    file(``),
+		"outer/unrelated/.git/HEAD":               file(``),
+		"outer/unrelated/packages/c/package.json": file(`{}`),
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"lockfile at the root", "package.json", "yarn"},
+		{"relative path", "repo/packages/a/package.json", "pnpm"},
+		{"absolute path", "/repo/packages/a/package.json", "pnpm"},
+		{"lockfile at the repository root", "outer/inner/packages/b/package.json", "bun"},
+		{"lockfile above the repository root", "outer/unrelated/packages/c/package.json", "npm"},
+		{"absolute path below a repository", "/outer/unrelated/packages/c/package.json", "npm"},
+	}
+	scanner := NewScanner(IOFS(fsys))
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := scanner.InferPackageManager(filepath.FromSlash(tt.path)); got != tt.want {
+				t.Errorf("InferPackageManager(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// generateTree writes a repository of 40 packages below root: each has
+// source directories without a package.json and a node_modules the walk
+// must skip, half of them sit one level deeper below a group directory.
+func generateTree(tb testing.TB, root string) {
+	tb.Helper()
+	write := func(path, data string) {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	write("README.md", "")
+	for i := 0; i < 40; i++ {
+		dir := fmt.Sprintf("packages/p%d", i)
+		if i%2 == 1 {
+			dir = fmt.Sprintf("packages/group%d/p%d", i%5, i)
+		}
+		write(dir+"/package.json", fmt.Sprintf(`{"name": "p%d", "scripts": {"build": "tsc"}}`, i))
+		write(dir+"/node_modules/dep/package.json", `{}`)
+		for j := 0; j < 5; j++ {
+			write(fmt.Sprintf("docs/d%d/s%d/notes.md", i, j), "")
+			write(fmt.Sprintf("%s/src/m%d/index.ts", dir, j), "")
+		}
+	}
+}
+
+// countingFS counts the directory reads and stats made through FS.
+type countingFS struct {
+	FS
+	calls *atomic.Int64
+}
+
+func (f countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f.calls.Add(1)
+	return f.FS.ReadDir(name)
+}
+
+func (f countingFS) Stat(name string) (fs.FileInfo, error) {
+	f.calls.Add(1)
+	return f.FS.Stat(name)
+}
+
+// readdirWalk is the walk FindPackages replaced: Readdir, which lstats
+// every entry, and a Stat for the package.json of the directory and of
+// each subdirectory. calls counts the directory reads and stats.
+func readdirWalk(path string, paths chan<- string, wg *sync.WaitGroup, calls *atomic.Int64) {
+	defer wg.Done()
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	entries, err := dir.Readdir(-1)
+	calls.Add(1 + int64(len(entries)))
+	if err != nil {
+		return
+	}
+
+	calls.Add(1)
+	if _, err := os.Stat(filepath.Join(path, "package.json")); err == nil {
+		paths <- filepath.Join(path, "package.json")
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || IgnoredDirs[entry.Name()] {
+			continue
+		}
+		dirPath := filepath.Join(path, entry.Name())
+		calls.Add(1)
+		if _, err := os.Stat(filepath.Join(dirPath, "package.json")); err == nil {
+			paths <- filepath.Join(dirPath, "package.json")
+		} else {
+			wg.Add(1)
+			go readdirWalk(dirPath, paths, wg, calls)
+		}
+	}
+}
+
+// findWithReaddir runs readdirWalk from root and returns the sorted
+// package.json files it found.
+func findWithReaddir(root string, calls *atomic.Int64) []string {
+	var wg sync.WaitGroup
+	paths := make(chan string, 100)
+	wg.Add(1)
+	go readdirWalk(root, paths, &wg, calls)
+	go func() {
+		wg.Wait()
+		close(paths)
+	}()
+	var found []string
+	for path := range paths {
+		found = append(found, path)
+	}
+	sort.Strings(found)
+	return found
+}
+
+// findWithReadDir runs FindPackages over the real filesystem from root and
+// returns the sorted package.json files it found.
+func findWithReadDir(root string, calls *atomic.Int64) []string {
+	found := NewScanner(countingFS{OS, calls}).FindPackages(context.Background(), root)
+	sort.Strings(found)
+	return found
+}
+
+func TestFindPackagesMatchesReaddirWalk(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	generateTree(t, root)
+
+	var oldCalls, newCalls atomic.Int64
+	want := findWithReaddir(root, &oldCalls)
+	got := findWithReadDir(root, &newCalls)
+	if len(want) != 40 {
+		t.Fatalf("the Readdir walk found %d package.json files, want 40", len(want))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPackages() = %v, want %v", got, want)
+	}
+	if newCalls.Load() >= oldCalls.Load() {
+		t.Errorf("FindPackages made %d filesystem calls, the Readdir walk %d", newCalls.Load(), oldCalls.Load())
+	}
+}
+
+func BenchmarkFindPackageJSON(b *testing.B) {
+	root := b.TempDir()
+	generateTree(b, root)
+	for _, bb := range []struct {
+		name string
+		find func(string, *atomic.Int64) []string
+	}{
+		{"ReadDir", findWithReadDir},
+		{"Readdir+Stat", findWithReaddir},
+	} {
+		bb := bb
+		b.Run(bb.name, func(b *testing.B) {
+			var calls atomic.Int64
+			for i := 0; i < b.N; i++ {
+				bb.find(root, &calls)
+			}
+			b.ReportMetric(float64(calls.Load())/float64(b.N), "fscalls/op")
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package discover
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FS is the filesystem a Scanner reads. Names are paths as the scan builds
+// them from its root, with the OS separator.
+type FS interface {
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// OS is the real filesystem, the one the package-level functions scan.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+
+// IOFS adapts fsys, for example an fstest.MapFS or os.DirFS, to FS. Names
+// are resolved relative to its root, so a scan starts at "." and never
+// looks for lockfiles above it.
+func IOFS(fsys fs.FS) FS {
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+// name turns an OS path into the slash separated, unrooted form io/fs
+// expects.
+func (f ioFS) name(name string) string {
+	name = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(f.fsys, f.name(name)) }
+func (f ioFS) ReadFile(name string) ([]byte, error)       { return fs.ReadFile(f.fsys, f.name(name)) }
+func (f ioFS) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(f.fsys, f.name(name)) }
+
+// glob is filepath.Glob reading directories from fsys. Patterns are
+// matched in slash form, so that `packages/*` joined to a root with
+// backslashes on Windows matches like it does elsewhere, and the matches
+// are returned with the OS separator.
+func glob(fsys FS, pattern string) ([]string, error) {
+	matches, err := globSlash(fsys, filepath.ToSlash(pattern))
+	for i, match := range matches {
+		matches[i] = filepath.FromSlash(match)
+	}
+	return matches, err
+}
+
+func globSlash(fsys FS, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasGlobMeta(pattern) {
+		if _, err := fsys.Stat(filepath.FromSlash(pattern)); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := path.Split(pattern)
+	dir = cleanGlobDir(dir)
+	if !hasGlobMeta(dir) {
+		return globDir(fsys, dir, file, nil), nil
+	}
+	// A pattern like `[` would recurse forever
+	if dir == pattern {
+		return nil, filepath.ErrBadPattern
+	}
+	dirs, err := globSlash(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, d := range dirs {
+		matches = globDir(fsys, d, file, matches)
+	}
+	return matches, nil
+}
+
+// globDir appends the entries of the slash separated dir matching pattern
+// to matches, sorted.
+func globDir(fsys FS, dir, pattern string, matches []string) []string {
+	entries, err := fsys.ReadDir(filepath.FromSlash(dir))
+	if err != nil {
+		return matches
+	}
+	var names []string
+	for _, entry := range entries {
+		if ok, _ := path.Match(pattern, entry.Name()); ok {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		matches = append(matches, path.Join(dir, name))
+	}
+	return matches
+}
+
+// cleanGlobDir drops the trailing slash path.Split leaves on dir, keeping
+// a root like "/" or "C:/" intact.
+func cleanGlobDir(dir string) string {
+	switch {
+	case dir == "":
+		return "."
+	case dir == "/" || strings.HasSuffix(dir, ":/") && !strings.Contains(strings.TrimSuffix(dir, ":/"), "/"):
+		return dir
+	}
+	return dir[:len(dir)-1]
+}
+
+// hasGlobMeta reports whether a slash separated pattern has any meta
+// characters. In slash form a backslash can only be an escape.
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+// globKey is the form matches are compared in, whatever separator and
+// redundant elements they were built with.
+func globKey(match string) string {
+	return filepath.ToSlash(filepath.Clean(match))
+}
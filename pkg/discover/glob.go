@@ -0,0 +1,73 @@
+package discover
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+)
+
+// globWorkers bounds how many workspace patterns are expanded at once.
+const globWorkers = 8
+
+// statCache remembers the Stat results of fsys during one discovery, so paths that
+// several overlapping workspace patterns match are only checked once. It
+// is safe for concurrent use.
+type statCache struct {
+	fsys    FS
+	mu      sync.Mutex
+	results map[string]statResult
+}
+
+type statResult struct {
+	info fs.FileInfo
+	err  error
+}
+
+func newStatCache(fsys FS) *statCache {
+	return &statCache{fsys: fsys, results: map[string]statResult{}}
+}
+
+func (c *statCache) stat(path string) (fs.FileInfo, error) {
+	c.mu.Lock()
+	r, ok := c.results[path]
+	c.mu.Unlock()
+	if !ok {
+		r.info, r.err = c.fsys.Stat(path)
+		c.mu.Lock()
+		c.results[path] = r
+		c.mu.Unlock()
+	}
+	return r.info, r.err
+}
+
+// exists reports whether path exists.
+func (c *statCache) exists(path string) bool {
+	_, err := c.stat(path)
+	return err == nil
+}
+
+// globAll expands every pattern like filepath.Glob, at most globWorkers at
+// a time. matches[i] and errs[i] belong to patterns[i], whatever order the
+// expansions finish in. Patterns not started when ctx is cancelled fail
+// with its error.
+func (c *statCache) globAll(ctx context.Context, patterns []string) (matches [][]string, errs []error) {
+	matches = make([][]string, len(patterns))
+	errs = make([]error, len(patterns))
+	sem := make(chan struct{}, globWorkers)
+	var wg sync.WaitGroup
+	for i, pattern := range patterns {
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pattern string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			matches[i], errs[i] = glob(c.fsys, pattern)
+		}(i, pattern)
+	}
+	wg.Wait()
+	return matches, errs
+}
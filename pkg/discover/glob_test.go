@@ -0,0 +1,118 @@
+package discover
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// globFixture is a workspace with a few packages and a stray file.
+var globFixture = fstest.MapFS{
+	"repo/packages/ui/package.json":       file(`{"name": "ui"}`),
+	"repo/packages/internal/package.json": file(`{"name": "internal"}`),
+	"repo/packages/legacy/package.json":   file(`{"name": "legacy"}`),
+	"repo/packages/README.md":             file(``),
+	"repo/apps/web/package.json":          file(`{"name": "web"}`),
+}
+
+// slashPaths converts paths to slash form, for comparisons that hold on
+// every OS.
+func slashPaths(paths []string) []string {
+	for i, path := range paths {
+		paths[i] = filepath.ToSlash(path)
+	}
+	return paths
+}
+
+func TestGlobKey(t *testing.T) {
+	t.Parallel()
+	for _, match := range []string{
+		"repo/packages/ui",
+		"repo/packages/ui/",
+		"./repo/packages/ui",
+		"repo/./packages/ui",
+		"repo//packages/ui",
+		"repo/apps/../packages/ui",
+		filepath.Join("repo", "packages", "ui"),
+	} {
+		if got := globKey(filepath.FromSlash(match)); got != "repo/packages/ui" {
+			t.Errorf("globKey(%q) = %q, want repo/packages/ui", match, got)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	t.Parallel()
+	fsys := IOFS(globFixture)
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"packages/*", []string{"repo/packages/README.md", "repo/packages/internal", "repo/packages/legacy", "repo/packages/ui"}},
+		{"*/web", []string{"repo/apps/web"}},
+		{"packages/[il]*", []string{"repo/packages/internal", "repo/packages/legacy"}},
+		{"packages/ui", []string{"repo/packages/ui"}},
+		{"packages/missing", nil},
+		{"*/*/package.json", []string{"repo/apps/web/package.json", "repo/packages/internal/package.json", "repo/packages/legacy/package.json", "repo/packages/ui/package.json"}},
+	}
+	for _, tt := range tests {
+		// Patterns are joined to the root with the OS separator, like the
+		// workspace patterns are
+		pattern := filepath.Join("repo", tt.pattern)
+		got, err := glob(fsys, pattern)
+		if err != nil {
+			t.Errorf("glob(%q): %v", pattern, err)
+			continue
+		}
+		if got = slashPaths(got); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("glob(%q) = %q, want %q", pattern, got, tt.want)
+		}
+	}
+	if _, err := glob(fsys, filepath.Join("repo", "[")); err == nil {
+		t.Error("glob of an unterminated [: no error")
+	}
+}
+
+func TestLocatePnpmWorkspacesExcludes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		workspace string
+		want      []string
+	}{
+		{
+			name:      "plain excludes",
+			workspace: "packages:\n  - packages/*\n  - apps/*\n  - '!packages/internal'\n",
+			want:      []string{"repo/apps/web", "repo/packages/README.md", "repo/packages/legacy", "repo/packages/ui"},
+		},
+		{
+			name:      "excludes with ./ and redundant slashes",
+			workspace: "packages:\n  - ./packages/*\n  - '!./packages/internal'\n  - '!packages//legacy/'\n  - '!packages/README.md'\n",
+			want:      []string{"repo/packages/ui"},
+		},
+		{
+			name:      "exclude glob against a ./ include",
+			workspace: "packages:\n  - './packages/*'\n  - '!packages/[il]*'\n  - '!**/*.md'\n",
+			want:      []string{"repo/packages/ui"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fsys := fstest.MapFS{"repo/pnpm-workspace.yaml": file(tt.workspace)}
+			for name, f := range globFixture {
+				fsys[name] = f
+			}
+			got, err := locatePnpmWorkspaces(context.Background(), "repo", newStatCache(IOFS(fsys)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got = slashPaths(got); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("workspaces\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
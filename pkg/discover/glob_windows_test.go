@@ -0,0 +1,67 @@
+//go:build windows
+
+package discover
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGlobKeyWindows(t *testing.T) {
+	t.Parallel()
+	for _, match := range []string{`repo\packages\ui`, `repo/packages\ui`, `.\repo\packages\ui\`, `repo\.\packages\\ui`} {
+		if got := globKey(match); got != "repo/packages/ui" {
+			t.Errorf("globKey(%q) = %q, want repo/packages/ui", match, got)
+		}
+	}
+	if got := globKey(`C:\repo\packages\ui`); got != "C:/repo/packages/ui" {
+		t.Errorf(`globKey(C:\repo\packages\ui) = %q, want C:/repo/packages/ui`, got)
+	}
+}
+
+// TestGlobBackslashJoined checks that patterns written with forward
+// slashes match once joined to a root with backslashes, and that matches
+// come back with backslashes.
+func TestGlobBackslashJoined(t *testing.T) {
+	t.Parallel()
+	fsys := IOFS(globFixture)
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{`repo\packages/*`, []string{`repo\packages\README.md`, `repo\packages\internal`, `repo\packages\legacy`, `repo\packages\ui`}},
+		{`repo\*\web`, []string{`repo\apps\web`}},
+		{`repo\packages\ui`, []string{`repo\packages\ui`}},
+		{filepath.Join("repo", "apps/*"), []string{`repo\apps\web`}},
+	}
+	for _, tt := range tests {
+		got, err := glob(fsys, tt.pattern)
+		if err != nil {
+			t.Errorf("glob(%q): %v", tt.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("glob(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// TestLocatePnpmWorkspacesSeparators checks that an exclude written with
+// other separators than its include still removes the match.
+func TestLocatePnpmWorkspacesSeparators(t *testing.T) {
+	t.Parallel()
+	fsys := fstest.MapFS{"repo/pnpm-workspace.yaml": file("packages:\n  - 'packages\\*'\n  - './apps/*'\n  - '!packages/internal'\n  - '!.\\packages\\legacy'\n  - '!packages\\README.md'\n  - '!apps\\web\\'\n")}
+	for name, f := range globFixture {
+		fsys[name] = f
+	}
+	got, err := locatePnpmWorkspaces(context.Background(), "repo", newStatCache(IOFS(fsys)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`repo\packages\ui`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("workspaces\n got: %q\nwant: %q", got, want)
+	}
+}
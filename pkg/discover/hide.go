@@ -0,0 +1,63 @@
+package discover
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MatchScriptGlob reports whether glob matches the script's name or its
+// "package:script" form. Matching is case-insensitive, "*" matches any run
+// of characters and "?" a single one.
+func MatchScriptGlob(glob string, script NpmScript) bool {
+	matcher, err := GlobRegexp(glob)
+	if err != nil {
+		return false
+	}
+	return matcher.MatchString(script.ScriptName) || matcher.MatchString(script.PackageName+":"+script.ScriptName)
+}
+
+// GlobRegexp compiles glob, matched case-insensitively as a whole, with "*"
+// matching any run of characters and "?" a single one.
+func GlobRegexp(glob string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("(?i)^")
+	for _, c := range glob {
+		switch c {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
+
+// HidePatterns returns the script globs of the "hide" list in the
+// "go-npm-run" object of a parsed package.json, like
+// `"go-npm-run": {"hide": ["postinstall", "internal:*"]}`.
+func HidePatterns(packageJSON map[string]any) []string {
+	config, _ := packageJSON["go-npm-run"].(map[string]any)
+	list, _ := config["hide"].([]any)
+	var patterns []string
+	for _, v := range list {
+		if pattern, ok := v.(string); ok && pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// hideScripts marks the scripts matched by any of patterns Hidden.
+func hideScripts(scripts []NpmScript, patterns []string) {
+	for i := range scripts {
+		for _, pattern := range patterns {
+			if MatchScriptGlob(pattern, scripts[i]) {
+				scripts[i].Hidden = true
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package discover
+
+import (
+	"path/filepath"
+)
+
+// implicitStartCommand is what `npm start` runs when package.json has no
+// start script but a server.js next to it.
+const implicitStartCommand = "node server.js"
+
+// implicitStart returns npm's default start script for the package.json at
+// path when it applies: scripts has no start entry and server.js exists in
+// fsys.
+func implicitStart(fsys FS, path, packageName string, scripts []NpmScript) (NpmScript, bool) {
+	for _, script := range scripts {
+		if script.ScriptName == "start" {
+			return NpmScript{}, false
+		}
+	}
+	if info, err := fsys.Stat(filepath.Join(filepath.Dir(path), "server.js")); err != nil || info.IsDir() {
+		return NpmScript{}, false
+	}
+	return NpmScript{PackageName: packageName, ScriptName: "start", Command: implicitStartCommand, AbsolutePath: path, Implicit: true}, true
+}
@@ -0,0 +1,167 @@
+package discover
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// knownLockFiles maps lockfile names to their package manager, in the order
+// they are checked when a directory has several.
+var knownLockFiles = []struct {
+	name, pm string
+}{
+	{"pnpm-lock.yaml", "pnpm"},
+	{"yarn.lock", "yarn"},
+	{"bun.lock", "bun"},
+	{"bun.lockb", "bun"},
+	{"package-lock.json", "npm"},
+}
+
+// dirMarkers is what package manager inference needs to know about one
+// directory.
+type dirMarkers struct {
+	lockFile string
+	pm       string
+	repoRoot bool
+}
+
+// lockFileIndex remembers the lockfiles and repository roots of every
+// directory looked at, keyed by path, absolute on the real filesystem. The scan records the
+// directories it lists for free, others are checked with Stat once. It is
+// safe for concurrent use.
+type lockFileIndex struct {
+	mu   sync.Mutex
+	dirs map[string]dirMarkers
+}
+
+// record notes the markers among the entries of dir, read by the scan.
+func (x *lockFileIndex) record(dir string, entries []fs.DirEntry) {
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	var markers dirMarkers
+	for _, lock := range knownLockFiles {
+		if names[lock.name] {
+			markers.lockFile, markers.pm = filepath.Join(dir, lock.name), lock.pm
+			break
+		}
+	}
+	markers.repoRoot = names[".git"]
+	x.mu.Lock()
+	x.dirs[dir] = markers
+	x.mu.Unlock()
+}
+
+// markers returns what is known about dir, checking fsys the first time.
+func (x *lockFileIndex) markers(fsys FS, dir string) dirMarkers {
+	x.mu.Lock()
+	markers, ok := x.dirs[dir]
+	x.mu.Unlock()
+	if ok {
+		return markers
+	}
+	for _, lock := range knownLockFiles {
+		if _, err := fsys.Stat(filepath.Join(dir, lock.name)); err == nil {
+			markers.lockFile, markers.pm = filepath.Join(dir, lock.name), lock.pm
+			break
+		}
+	}
+	markers.repoRoot = isRepoRoot(fsys, dir)
+	x.mu.Lock()
+	x.dirs[dir] = markers
+	x.mu.Unlock()
+	return markers
+}
+
+// InferPackageManager is Scanner.InferPackageManager on the real
+// filesystem.
+func InferPackageManager(filePath string) string {
+	return defaultScanner.InferPackageManager(filePath)
+}
+
+// InferPackageManager returns the package manager of the package.json at
+// filePath, named after the nearest lockfile in its directory or above.
+// The search stops at the repository root or the home directory and falls
+// back to npm.
+func (s *Scanner) InferPackageManager(filePath string) string {
+	dir := s.abs(filepath.Dir(filePath))
+	home, _ := os.UserHomeDir()
+	for {
+		markers := s.locks.markers(s.fsys, dir)
+		if markers.pm != "" {
+			Debugf("package manager for %s: %s (found %s)", filePath, markers.pm, markers.lockFile)
+			return markers.pm
+		}
+		// Lockfiles above the repository or the home directory belong to
+		// something else
+		if markers.repoRoot || dir == home {
+			break
+		}
+		// filepath.Dir of "/" or a drive root like `C:\` is the root itself
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	Debugf("package manager for %s: npm (no lockfile found)", filePath)
+	return "npm"
+}
+
+// isRepoRoot reports whether dir is the top of a git repository. .git is a
+// file in worktrees and submodules.
+func isRepoRoot(fsys FS, dir string) bool {
+	_, err := fsys.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// projectRootMarkers identify the directory dependencies are installed in,
+// for hoisted workspaces that is the workspace root.
+var projectRootMarkers = []string{"package-lock.json", "yarn.lock", "pnpm-lock.yaml", "pnpm-workspace.yaml", "bun.lock", "bun.lockb"}
+
+// IsProjectRoot reports whether dependencies are installed in dir, which
+// has a lockfile or a pnpm-workspace.yaml.
+func IsProjectRoot(dir string) bool {
+	for _, marker := range projectRootMarkers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectRoot returns the workspace or repository root dir belongs to: the
+// topmost directory at or above dir that IsProjectRoot, without looking
+// past the repository root or the home directory. Failing that it is the
+// repository root, or dir itself outside of a repository.
+func ProjectRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	root := ""
+	for current := dir; ; {
+		if IsProjectRoot(current) {
+			root = current
+		}
+		if isRepoRoot(OS, current) {
+			if root == "" {
+				root = current
+			}
+			break
+		}
+		parent := filepath.Dir(current)
+		if current == home || parent == current {
+			break
+		}
+		current = parent
+	}
+	if root == "" {
+		return dir
+	}
+	return root
+}
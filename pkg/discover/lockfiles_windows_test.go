@@ -0,0 +1,40 @@
+//go:build windows
+
+package discover
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestInferPackageManagerDriveRoot checks that the lockfile walk ends at a
+// drive root, where filepath.Dir returns the root itself.
+func TestInferPackageManagerDriveRoot(t *testing.T) {
+	t.Parallel()
+	fsys := fstest.MapFS{
+		"C:/repo/yarn.lock":               file(``),
+		"C:/repo/packages/a/package.json": file(`{}`),
+		"C:/loose/package.json":           file(`{}`),
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{`C:\repo\packages\a\package.json`, "yarn"},
+		{`C:\loose\package.json`, "npm"},
+		{`C:\package.json`, "npm"},
+	}
+	scanner := NewScanner(IOFS(fsys))
+	for _, tt := range tests {
+		done := make(chan string)
+		go func(path string) { done <- scanner.InferPackageManager(path) }(tt.path)
+		select {
+		case got := <-done:
+			if got != tt.want {
+				t.Errorf("InferPackageManager(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("InferPackageManager(%q) did not stop at the drive root", tt.path)
+		}
+	}
+}
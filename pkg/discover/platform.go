@@ -0,0 +1,97 @@
+package discover
+
+import (
+	"runtime"
+	"strings"
+)
+
+// nodePlatforms and nodeArchs map GOOS and GOARCH to Node's
+// process.platform and process.arch, the values of the package.json os and
+// cpu fields. Values missing here are the same in both.
+var (
+	nodePlatforms = map[string]string{"windows": "win32", "solaris": "sunos", "illumos": "sunos"}
+	nodeArchs     = map[string]string{"amd64": "x64", "386": "ia32", "ppc64le": "ppc64", "mipsle": "mipsel"}
+)
+
+// Platform is the os and cpu the running system has in package.json
+// terms, like "darwin" and "arm64" or "win32" and "x64".
+func Platform() (os, cpu string) {
+	os, cpu = runtime.GOOS, runtime.GOARCH
+	if name, ok := nodePlatforms[os]; ok {
+		os = name
+	}
+	if name, ok := nodeArchs[cpu]; ok {
+		cpu = name
+	}
+	return os, cpu
+}
+
+// PlatformFields returns the "os" and "cpu" lists of a parsed package.json,
+// a single string counting as a list of one.
+func PlatformFields(packageJSON map[string]any) (os, cpu []string) {
+	return stringList(packageJSON["os"]), stringList(packageJSON["cpu"])
+}
+
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []any:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// incompatibility describes why a package declaring osList and cpuList
+// cannot run on the os and cpu given, like "os linux" or "cpu !arm64", and
+// is empty when it can. The lists follow npm: "any" allows everything, a
+// "!" entry excludes a value and otherwise one entry has to match.
+func incompatibility(osList, cpuList []string, os, cpu string) string {
+	var reasons []string
+	if !platformAllowed(os, osList) {
+		reasons = append(reasons, "os "+strings.Join(osList, ","))
+	}
+	if !platformAllowed(cpu, cpuList) {
+		reasons = append(reasons, "cpu "+strings.Join(cpuList, ","))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+func platformAllowed(value string, list []string) bool {
+	if len(list) == 0 || len(list) == 1 && list[0] == "any" {
+		return true
+	}
+	negated, match := 0, false
+	for _, entry := range list {
+		if excluded, ok := strings.CutPrefix(entry, "!"); ok {
+			if excluded == value {
+				return false
+			}
+			negated++
+		} else if entry == value {
+			match = true
+		}
+	}
+	return match || negated == len(list)
+}
+
+// markIncompatible sets Incompatible on scripts when the os and cpu lists
+// of their package.json exclude the running system.
+func markIncompatible(scripts []NpmScript, osList, cpuList []string) {
+	os, cpu := Platform()
+	reason := incompatibility(osList, cpuList, os, cpu)
+	if reason == "" {
+		return
+	}
+	for i := range scripts {
+		scripts[i].Incompatible = reason
+	}
+}
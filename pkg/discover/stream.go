@@ -0,0 +1,45 @@
+package discover
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Stream is Scanner.Stream on the real filesystem.
+func Stream(ctx context.Context, rootPath string, roots *atomic.Int64) <-chan []NpmScript {
+	return defaultScanner.Stream(ctx, rootPath, roots)
+}
+
+// Stream scans rootPath like FindPackages followed by ExtractScripts, but
+// sends the scripts of every package as soon as it is parsed instead of
+// waiting for the whole scan. The channel is closed once discovery is
+// complete, roots counts the project roots found so far. Cancelling ctx stops the scan and
+// closes the channel early.
+func (s *Scanner) Stream(ctx context.Context, rootPath string, roots *atomic.Int64) <-chan []NpmScript {
+	scriptsChan := make(chan []NpmScript, 100)
+	pathsChan := make(chan string, 100)
+
+	var walk sync.WaitGroup
+	walk.Add(1)
+	go s.findPackageJSON(ctx, rootPath, pathsChan, &walk)
+	go func() {
+		walk.Wait()
+		close(pathsChan)
+	}()
+
+	go func() {
+		var extract sync.WaitGroup
+		sc := s.newScan()
+		for path := range pathsChan {
+			roots.Add(1)
+			if sc.visit(path) {
+				extract.Add(1)
+				go s.extractScripts(ctx, path, SourceWalk, 0, sc, scriptsChan, &extract)
+			}
+		}
+		extract.Wait()
+		close(scriptsChan)
+	}()
+	return scriptsChan
+}
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// corepackManagers are the package managers corepack can provision.
+var corepackManagers = []string{"npm", "yarn", "pnpm"}
+
+var corepack struct {
+	lookup sync.Once
+	path   string
+	warn   sync.Once
+}
+
+// corepackPath returns the corepack binary, "" when it is not installed.
+func corepackPath() string {
+	corepack.lookup.Do(func() {
+		path, err := exec.LookPath(LookupCommand("corepack"))
+		if err != nil {
+			Debugf("corepack not found: %v", err)
+			return
+		}
+		corepack.path = path
+	})
+	return corepack.path
+}
+
+// pinnedPackageManager returns the packageManager field of the nearest
+// package.json at or above packageJSONPath, without its hash, e.g.
+// "pnpm@8.15.4", and the package.json it came from.
+func pinnedPackageManager(packageJSONPath string) (pinned, from string) {
+	dir, err := filepath.Abs(filepath.Dir(packageJSONPath))
+	if err != nil {
+		return "", ""
+	}
+	for {
+		path := filepath.Join(dir, "package.json")
+		if _, err := os.Stat(path); err == nil {
+			data, _, err := discover.ReadPackageJSON(path)
+			if err == nil {
+				if field, ok := data["packageManager"].(string); ok && field != "" {
+					pinned, _, _ = strings.Cut(field, "+")
+					return pinned, path
+				}
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// corepackSpec returns the "name@version" corepack should run for script
+// when packageManager is pinned through the packageManager field, "" when
+// the binary on PATH is to be used.
+func corepackSpec(script discover.NpmScript, packageManager string) string {
+	if !contains(corepackManagers, packageManager) {
+		return ""
+	}
+	pinned, from := pinnedPackageManager(script.AbsolutePath)
+	name, _, _ := strings.Cut(pinned, "@")
+	if name != packageManager {
+		return ""
+	}
+	if corepackPath() == "" {
+		corepack.warn.Do(func() {
+			Warnf("%s pins %s but corepack is not installed, using %s from PATH", from, pinned, packageManager)
+		})
+		return ""
+	}
+	Debugf("running %s through corepack: %s pins %s", script.Label(), from, pinned)
+	return pinned
+}
@@ -0,0 +1,21 @@
+package runner
+
+import "github.com/antonk52/go-npm-run/pkg/discover"
+
+// lifecycleScripts have a shortcut command, `npm test` instead of
+// `npm run test`.
+var lifecycleScripts = []string{"start", "test", "stop", "restart"}
+
+// shortcutRunners understand the lifecycle shortcuts. bun is missing on
+// purpose: `bun test` is bun's own test runner, not the test script.
+var shortcutRunners = []string{"npm", "yarn", "pnpm"}
+
+// implicitStartRunners fall back to npm's default start script, see
+// NpmScript.Implicit, on their own.
+var implicitStartRunners = []string{"npm", "pnpm"}
+
+// usesShortcut reports whether script runs as `runner <name>` rather than
+// `runner run <name>`.
+func usesShortcut(runner string, script discover.NpmScript) bool {
+	return contains(shortcutRunners, runner) && contains(lifecycleScripts, script.ScriptName)
+}
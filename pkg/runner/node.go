@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// nodeRunMinMajor is the first node major version with `node --run`.
+const nodeRunMinMajor = 22
+
+var nodeVersionOnce struct {
+	sync.Once
+	version string
+}
+
+// NodeVersion returns the output of `node --version`, e.g. "v20.11.1", or
+// "" when node cannot be run. It is only asked once per run.
+func NodeVersion() string {
+	nodeVersionOnce.Do(func() {
+		out, err := exec.Command(LookupCommand("node"), "--version").Output()
+		if err != nil {
+			Debugf("cannot determine the node version: %v", err)
+			return
+		}
+		nodeVersionOnce.version = strings.TrimSpace(string(out))
+		Debugf("node version: %s", nodeVersionOnce.version)
+	})
+	return nodeVersionOnce.version
+}
+
+// nodeMajorVersion returns the major version of the active node, 0 when
+// unknown.
+func nodeMajorVersion() int {
+	major, _, _ := strings.Cut(strings.TrimPrefix(NodeVersion(), "v"), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// nodeSupportsRun reports whether the active node has `node --run`.
+func nodeSupportsRun() bool {
+	return nodeMajorVersion() >= nodeRunMinMajor
+}
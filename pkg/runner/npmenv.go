@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// npmEnvKeyUnsafe matches what npm replaces with "_" in variable names.
+var npmEnvKeyUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// npmPackageEnv returns the variables a package manager sets for script and
+// that a direct shell run has to provide itself: the package.json flattened
+// into npm_package_* like npm 6 did, with nested keys and array indices
+// joined by underscores, plus npm_lifecycle_event, npm_lifecycle_script and
+// npm_package_json.
+func npmPackageEnv(script discover.NpmScript) []string {
+	vars := map[string]string{}
+	if data, _, err := discover.ReadPackageJSON(script.AbsolutePath); err == nil {
+		for key, value := range data {
+			// The readme can be huge and nobody reads it from a script
+			if key != "readme" {
+				flattenNpmEnv(vars, "npm_package_"+npmEnvKeyUnsafe.ReplaceAllString(key, "_"), value)
+			}
+		}
+	} else {
+		Debugf("cannot flatten %s into npm_package_*: %v", script.AbsolutePath, err)
+	}
+	if path, err := filepath.Abs(script.AbsolutePath); err == nil {
+		vars["npm_package_json"] = path
+	}
+	vars["npm_lifecycle_event"] = script.ScriptName
+	vars["npm_lifecycle_script"] = script.Command
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	env := make([]string, len(keys))
+	for i, key := range keys {
+		// NUL cannot be passed in the environment
+		env[i] = key + "=" + strings.ReplaceAll(vars[key], "\x00", "")
+	}
+	return env
+}
+
+func flattenNpmEnv(vars map[string]string, name string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, nested := range v {
+			flattenNpmEnv(vars, name+"_"+npmEnvKeyUnsafe.ReplaceAllString(key, "_"), nested)
+		}
+	case []any:
+		for i, nested := range v {
+			flattenNpmEnv(vars, fmt.Sprintf("%s_%d", name, i), nested)
+		}
+	case string:
+		vars[name] = v
+	case nil:
+		vars[name] = ""
+	case float64, bool:
+		data, _ := json.Marshal(v)
+		vars[name] = string(data)
+	}
+}
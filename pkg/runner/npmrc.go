@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// npmrcVarPattern matches the ${VAR} references npm expands in .npmrc.
+var npmrcVarPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// readNpmrc returns the value of key in the ini style .npmrc at path.
+func readNpmrc(path, key string) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	value, found := "", false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' && v[len(v)-1] == '"' || v[0] == '\'' && v[len(v)-1] == '\'') {
+			v = v[1 : len(v)-1]
+		}
+		// The last assignment wins, like in npm
+		value, found = npmrcVarPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			return os.Getenv(ref[2 : len(ref)-1])
+		}), true
+	}
+	return value, found
+}
+
+// npmrcFiles lists the .npmrc files that apply to dir, in decreasing
+// precedence: the package directory and its parents up to the project
+// root, then the user and the global config.
+func npmrcFiles(dir string) []string {
+	var files []string
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	for {
+		files = append(files, filepath.Join(dir, ".npmrc"))
+		parent := filepath.Dir(dir)
+		if discover.IsProjectRoot(dir) || parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	if path := os.Getenv("NPM_CONFIG_USERCONFIG"); path != "" {
+		files = append(files, path)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".npmrc"))
+	}
+	if path := os.Getenv("NPM_CONFIG_GLOBALCONFIG"); path != "" {
+		files = append(files, path)
+	} else if prefix := os.Getenv("NPM_CONFIG_PREFIX"); prefix != "" {
+		files = append(files, filepath.Join(prefix, "etc", "npmrc"))
+	}
+	return files
+}
+
+// scriptShell returns the shell npm runs scripts of the package in dir
+// with and where that came from: npm_config_script_shell, the script-shell
+// setting of the nearest .npmrc, or the platform default, sh or %ComSpec%.
+func scriptShell(dir string) (shell, source string) {
+	if shell := os.Getenv("npm_config_script_shell"); shell != "" {
+		return shell, "env npm_config_script_shell"
+	}
+	for _, path := range npmrcFiles(dir) {
+		if shell, ok := readNpmrc(path, "script-shell"); ok && shell != "" {
+			return shell, path
+		}
+	}
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("ComSpec"); comspec != "" {
+			return comspec, "default"
+		}
+		return "cmd.exe", "default"
+	}
+	return "sh", "default"
+}
+
+// isCmdShell reports whether shell is the Windows command interpreter,
+// which takes /d /s /c and its own quoting.
+func isCmdShell(shell string) bool {
+	name := strings.ToLower(filepath.Base(shell))
+	return name == "cmd" || name == "cmd.exe"
+}
+
+// cmdQuote quotes s for cmd.exe when it contains anything beyond a
+// conservative set of safe characters.
+func cmdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"&|<>^%()!,;=") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
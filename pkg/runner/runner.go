@@ -0,0 +1,412 @@
+// Package runner turns a discovered script into the command that runs it:
+// the package manager, node --run, corepack or the script shell.
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// PackageManagers are the runners Options.PackageManager accepts.
+var PackageManagers = []string{"npm", "yarn", "pnpm", "bun", "node"}
+
+// Invocation is a script resolved to the exact process that runs it.
+type Invocation struct {
+	Script         discover.NpmScript
+	PackageManager string
+	// PMSource explains where PackageManager came from, e.g. "inferred".
+	PMSource string
+	// RunnerReason explains why an npm project does not use node --run.
+	RunnerReason string
+	// Corepack is the pinned "name@version" run through corepack, if any.
+	Corepack string
+	Name     string
+	Args     []string
+	Dir      string
+	// Env holds extra NAME=value pairs for the script's environment.
+	Env []string
+	// Shell explains why the script body runs through the shell directly,
+	// with BinPath prepended to PATH, instead of through the package
+	// manager. It is empty for package manager runs.
+	Shell   string
+	BinPath string
+	// PackageEnv holds the npm_package_* and npm_lifecycle_* variables a
+	// package manager would set, for shell runs. Unlike Env they are not
+	// part of CommandLine.
+	PackageEnv []string
+	// BaseEnv replaces go-npm-run's environment as the one the others
+	// extend, for --clean-env. Nil inherits all of it.
+	BaseEnv []string
+}
+
+// Options control how Resolve runs a script.
+type Options struct {
+	// PackageManager forces one of PackageManagers instead of inferring
+	// it, PMSource says where that choice came from.
+	PackageManager string
+	PMSource       string
+	// Raw runs the script body through the script shell, bypassing the
+	// package manager.
+	Raw bool
+	// NoNodeRun keeps npm projects on npm run instead of node --run.
+	NoNodeRun bool
+	// NoCorepack ignores the packageManager field.
+	NoCorepack bool
+	// Args are forwarded to the script.
+	Args []string
+	// Dir runs the script there instead of in its package directory. A
+	// package manager only finds the script in the package directory, so
+	// the body then runs through the script shell.
+	Dir string
+}
+
+// Debugf and Warnf receive diagnostics. They discard everything unless
+// set, and must not be changed while scripts are resolved.
+var (
+	Debugf = func(format string, args ...any) {}
+	Warnf  = func(format string, args ...any) {}
+)
+
+// Resolve works out the binary, arguments and working directory used to
+// run script with opts.
+func Resolve(script discover.NpmScript, opts Options) Invocation {
+	inv := resolve(script, opts)
+	if opts.Dir == "" || sameDir(opts.Dir, inv.Dir) {
+		return inv
+	}
+	if inv.Shell == "" {
+		inv.RunInShell(script.Command, opts.Args, "runs outside its package directory")
+	}
+	inv.Dir = opts.Dir
+	return inv
+}
+
+func resolve(script discover.NpmScript, opts Options) Invocation {
+	args := opts.Args
+	if opts.Raw {
+		inv := Invocation{Script: script, Dir: filepath.Dir(script.AbsolutePath)}
+		inv.RunInShell(script.Command, args, "--raw")
+		return inv
+	}
+
+	packageManager := opts.PackageManager
+	pmSource := opts.PMSource
+	cmdName := packageManager
+	run := "run"
+	runnerReason := ""
+
+	if packageManager == "" {
+		packageManager = script.PackageManager
+		if packageManager == "" {
+			packageManager = discover.InferPackageManager(script.AbsolutePath)
+		}
+		pmSource = "inferred"
+		cmdName = packageManager
+		// node --run skips npm's startup cost and behaves the same for plain scripts
+		if packageManager == "npm" {
+			runnerReason = nodeRunBlocker(script, opts)
+			if runnerReason == "" {
+				cmdName = "node"
+				run = "--run"
+			} else {
+				Debugf("running %s with npm run: %s", script.Label(), runnerReason)
+			}
+		}
+	} else if packageManager == "node" {
+		run = "--run"
+	}
+
+	if script.Implicit && !contains(implicitStartRunners, cmdName) {
+		inv := Invocation{Script: script, PackageManager: packageManager, PMSource: pmSource, Dir: filepath.Dir(script.AbsolutePath)}
+		inv.RunInShell(script.Command, args, cmdName+" has no default start script")
+		return inv
+	}
+
+	cmdArgs := []string{run, script.ScriptName}
+	if usesShortcut(cmdName, script) {
+		cmdArgs = []string{script.ScriptName}
+	}
+	if len(args) > 0 {
+		// npm and node need "--" to stop treating the arguments as their own
+		if cmdName == "npm" || cmdName == "node" {
+			cmdArgs = append(cmdArgs, "--")
+		}
+		cmdArgs = append(cmdArgs, args...)
+	}
+
+	corepack := ""
+	if !opts.NoCorepack {
+		if corepack = corepackSpec(script, cmdName); corepack != "" {
+			cmdArgs = append([]string{corepack}, cmdArgs...)
+			cmdName = "corepack"
+		}
+	}
+
+	return Invocation{
+		Script:         script,
+		Corepack:       corepack,
+		PackageManager: packageManager,
+		PMSource:       pmSource,
+		RunnerReason:   runnerReason,
+		Name:           cmdName,
+		Args:           cmdArgs,
+		Dir:            filepath.Dir(script.AbsolutePath),
+	}
+}
+
+// RunInShell makes inv run body, followed by the forwarded args, through
+// the script shell for reason, see scriptShell. Like the package managers do, every
+// node_modules/.bin from the package up to the filesystem root is put on
+// PATH.
+func (inv *Invocation) RunInShell(body string, args []string, reason string) {
+	shell, source := scriptShell(inv.Dir)
+	Debugf("script shell for %s: %s (%s)", inv.Script.Label(), shell, source)
+	quote := ShellQuote
+	if isCmdShell(shell) {
+		quote = cmdQuote
+	}
+	for _, arg := range args {
+		body += " " + quote(arg)
+	}
+	inv.Shell = reason
+	inv.BinPath = nodeModulesBinPath(inv.Dir)
+	inv.PackageEnv = npmPackageEnv(inv.Script)
+	inv.Corepack, inv.RunnerReason = "", ""
+	if isCmdShell(shell) {
+		inv.Name, inv.Args = shell, []string{"/d", "/s", "/c", body}
+	} else {
+		inv.Name, inv.Args = shell, []string{"-c", body}
+	}
+	Debugf("running %s through %s (%s), pre and post scripts are skipped", inv.Script.Label(), inv.Name, reason)
+}
+
+// sameDir reports whether a and b name the same directory.
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// nodeModulesBinPath joins the node_modules/.bin directories of dir and all
+// of its parents, nearest first, into a PATH list.
+func nodeModulesBinPath(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	var dirs []string
+	for {
+		dirs = append(dirs, filepath.Join(abs, "node_modules", ".bin"))
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			break
+		}
+		abs = parent
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
+
+// npmEnvPrefixes are the variables npm run sets and node --run does not.
+var npmEnvPrefixes = []string{"npm_package_", "npm_config_", "npm_lifecycle_"}
+
+// nodeRunBlocker explains why script cannot run with node --run without
+// changing its behaviour, or returns "" when it can.
+func nodeRunBlocker(script discover.NpmScript, opts Options) string {
+	if opts.NoNodeRun {
+		return "--no-node-run"
+	}
+	if script.Implicit {
+		return "start is npm's default " + script.Command
+	}
+	if !nodeSupportsRun() {
+		return fmt.Sprintf("node %s has no --run", NodeVersion())
+	}
+	// node --run skips lifecycle scripts
+	_, siblings, err := discover.ReadPackageJSON(script.AbsolutePath)
+	if err == nil {
+		for _, sibling := range siblings {
+			if sibling.ScriptName == "pre"+script.ScriptName || sibling.ScriptName == "post"+script.ScriptName {
+				return "has a " + sibling.ScriptName + " script"
+			}
+		}
+	}
+	for _, prefix := range npmEnvPrefixes {
+		if strings.Contains(script.Command, prefix) {
+			return "uses " + prefix + "* variables"
+		}
+	}
+	return ""
+}
+
+// HasEnv reports whether inv's extra environment sets name.
+func (inv Invocation) HasEnv(name string) bool {
+	for _, env := range inv.Env {
+		if strings.HasPrefix(env, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetEnv sets name to value in inv's extra environment, replacing an
+// earlier value.
+func (inv *Invocation) SetEnv(name, value string) {
+	for i, env := range inv.Env {
+		if strings.HasPrefix(env, name+"=") {
+			inv.Env[i] = name + "=" + value
+			return
+		}
+	}
+	inv.Env = append(inv.Env, name+"="+value)
+}
+
+// UsesNodeRun reports whether inv runs the script with `node --run`.
+func (inv Invocation) UsesNodeRun() bool {
+	return inv.Shell == "" && inv.Name == "node" && len(inv.Args) > 0 && inv.Args[0] == "--run"
+}
+
+// windowsShimExts are tried when a runner is not found as is on windows,
+// where npm, yarn and pnpm are installed as .cmd shims.
+var windowsShimExts = []string{".cmd", ".exe", ".bat"}
+
+// LookupCommand resolves name to the executable to start. Only windows
+// needs help, exec.LookPath relies on PATHEXT which may not list .cmd.
+func LookupCommand(name string) string {
+	if runtime.GOOS != "windows" {
+		return name
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	for _, ext := range windowsShimExts {
+		if path, err := exec.LookPath(name + ext); err == nil {
+			return path
+		}
+	}
+	return name
+}
+
+// Command returns the process to start for inv, with the environment of
+// Environ.
+func (inv Invocation) Command() *exec.Cmd {
+	cmd := exec.Command(LookupCommand(inv.Name), inv.Args...)
+	cmd.Dir = inv.Dir
+	cmd.Env = inv.Environ()
+	return cmd
+}
+
+// Environ returns the environment inv starts with: BaseEnv or else
+// go-npm-run's, extended by PackageEnv, Env and BinPath. A later value of
+// a variable replaces an earlier one in place. It is nil when the process
+// simply inherits go-npm-run's environment.
+func (inv Invocation) Environ() []string {
+	if inv.BaseEnv == nil && len(inv.Env) == 0 && inv.BinPath == "" {
+		return nil
+	}
+	base := inv.BaseEnv
+	if base == nil {
+		base = os.Environ()
+	}
+	env := append(append([]string(nil), base...), inv.PackageEnv...)
+	env = append(env, inv.Env...)
+	if inv.BinPath != "" {
+		env = append(env, "PATH="+inv.BinPath+string(os.PathListSeparator)+lookupEnv(base, "PATH"))
+	}
+
+	index := map[string]int{}
+	var merged []string
+	for _, assignment := range env {
+		name := envName(assignment)
+		if runtime.GOOS == "windows" {
+			name = strings.ToUpper(name)
+		}
+		if i, ok := index[name]; ok {
+			merged[i] = assignment
+			continue
+		}
+		index[name] = len(merged)
+		merged = append(merged, assignment)
+	}
+	return merged
+}
+
+// lookupEnv returns the value of name in env, the last one when it is set
+// several times.
+func lookupEnv(env []string, name string) string {
+	value := ""
+	for _, assignment := range env {
+		if key := envName(assignment); key == name || runtime.GOOS == "windows" && strings.EqualFold(key, name) {
+			value = strings.TrimPrefix(assignment[len(key):], "=")
+		}
+	}
+	return value
+}
+
+// envName returns the variable name of a NAME=value assignment. Names of
+// the hidden Windows variables like "=C:" start with the "=".
+func envName(assignment string) string {
+	i := strings.IndexByte(assignment, '=')
+	if i == 0 {
+		i = strings.IndexByte(assignment[1:], '=') + 1
+	}
+	if i <= 0 {
+		return assignment
+	}
+	return assignment[:i]
+}
+
+// CommandLine renders inv as a line that can be pasted into a shell.
+func (inv Invocation) CommandLine() string {
+	var parts []string
+	if inv.BaseEnv != nil {
+		parts = append(parts, "env", "-i")
+		for _, env := range inv.BaseEnv {
+			parts = append(parts, ShellQuote(env))
+		}
+	}
+	for _, env := range inv.Env {
+		parts = append(parts, ShellQuote(env))
+	}
+	if inv.BinPath != "" {
+		parts = append(parts, "PATH="+ShellQuote(inv.BinPath)+`:"$PATH"`)
+	}
+	parts = append(parts, ShellQuote(inv.Name))
+	for _, arg := range inv.Args {
+		parts = append(parts, ShellQuote(arg))
+	}
+	return "cd " + ShellQuote(inv.Dir) + " && " + strings.Join(parts, " ")
+}
+
+// ShellQuote quotes s for POSIX shells when it contains anything beyond a
+// conservative set of safe characters.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@%+,", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// TestMain puts a fake node that supports --run and a fake corepack first
+// on PATH, so that Resolve does not depend on what is installed.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "runner-test")
+	if err != nil {
+		panic(err)
+	}
+	fakes := map[string]string{"node": "#!/bin/sh\necho v22.3.0\n", "corepack": "#!/bin/sh\n"}
+	if runtime.GOOS == "windows" {
+		fakes = map[string]string{"node.cmd": "@echo v22.3.0\r\n", "corepack.cmd": "@exit /b 0\r\n"}
+	}
+	for name, body := range fakes {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o755); err != nil {
+			panic(err)
+		}
+	}
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fixtureScript writes packageJSON to a package directory of its own and
+// returns its script name, found with the package manager pm like a scan
+// would.
+func fixtureScript(t *testing.T, packageJSON, name, pm string) discover.NpmScript {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "package.json")
+	if err := os.WriteFile(path, []byte(packageJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, scripts, err := discover.ReadPackageJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range scripts {
+		if script.ScriptName == name {
+			script.PackageManager = pm
+			return script
+		}
+	}
+	t.Fatalf("%s has no %s script", path, name)
+	return discover.NpmScript{}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		packageJSON string
+		script      string
+		pm          string
+		opts        Options
+		wantName    string
+		wantArgs    []string
+		wantPM      string
+		wantSource  string
+		wantReason  string
+		wantPinned  string
+	}{
+		{
+			name:        "node --run for npm",
+			packageJSON: `{"scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "npm",
+			wantName: "node", wantArgs: []string{"--run", "build"},
+			wantPM: "npm", wantSource: "inferred",
+		},
+		{
+			name:        "node --run with arguments",
+			packageJSON: `{"scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "npm",
+			opts:     Options{Args: []string{"--watch"}},
+			wantName: "node", wantArgs: []string{"--run", "build", "--", "--watch"},
+			wantPM: "npm", wantSource: "inferred",
+		},
+		{
+			name:        "npm run for a pre script",
+			packageJSON: `{"scripts": {"prebuild": "rm -rf dist", "build": "tsc"}}`,
+			script:      "build", pm: "npm",
+			wantName: "npm", wantArgs: []string{"run", "build"},
+			wantPM: "npm", wantSource: "inferred", wantReason: "has a prebuild script",
+		},
+		{
+			name:        "npm run for npm variables",
+			packageJSON: `{"scripts": {"version": "echo $npm_package_version"}}`,
+			script:      "version", pm: "npm",
+			wantName: "npm", wantArgs: []string{"run", "version"},
+			wantPM: "npm", wantSource: "inferred", wantReason: "uses npm_package_* variables",
+		},
+		{
+			name:        "npm run with NoNodeRun",
+			packageJSON: `{"scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "npm",
+			opts:     Options{NoNodeRun: true, Args: []string{"a b"}},
+			wantName: "npm", wantArgs: []string{"run", "build", "--", "a b"},
+			wantPM: "npm", wantSource: "inferred", wantReason: "--no-node-run",
+		},
+		{
+			name:        "npm lifecycle shortcut",
+			packageJSON: `{"scripts": {"test": "jest"}}`,
+			script:      "test", pm: "npm",
+			opts:     Options{NoNodeRun: true},
+			wantName: "npm", wantArgs: []string{"test"},
+			wantPM: "npm", wantSource: "inferred", wantReason: "--no-node-run",
+		},
+		{
+			name:        "inferred yarn",
+			packageJSON: `{"scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "yarn",
+			opts:     Options{Args: []string{"--watch"}},
+			wantName: "yarn", wantArgs: []string{"run", "build", "--watch"},
+			wantPM: "yarn", wantSource: "inferred",
+		},
+		{
+			name:        "pm override",
+			packageJSON: `{"scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "npm",
+			opts:     Options{PackageManager: "pnpm", PMSource: "flag --pm"},
+			wantName: "pnpm", wantArgs: []string{"run", "build"},
+			wantPM: "pnpm", wantSource: "flag --pm",
+		},
+		{
+			name:        "pm override with node",
+			packageJSON: `{"scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "yarn",
+			opts:     Options{PackageManager: "node", PMSource: "flag --pm"},
+			wantName: "node", wantArgs: []string{"--run", "build"},
+			wantPM: "node", wantSource: "flag --pm",
+		},
+		{
+			name:        "corepack",
+			packageJSON: `{"packageManager": "pnpm@8.15.4+sha256.abc", "scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "pnpm",
+			wantName: "corepack", wantArgs: []string{"pnpm@8.15.4", "run", "build"},
+			wantPM: "pnpm", wantSource: "inferred", wantPinned: "pnpm@8.15.4",
+		},
+		{
+			name:        "corepack for another package manager",
+			packageJSON: `{"packageManager": "yarn@4.1.0", "scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "pnpm",
+			wantName: "pnpm", wantArgs: []string{"run", "build"},
+			wantPM: "pnpm", wantSource: "inferred",
+		},
+		{
+			name:        "corepack with NoCorepack",
+			packageJSON: `{"packageManager": "pnpm@8.15.4", "scripts": {"build": "tsc"}}`,
+			script:      "build", pm: "pnpm",
+			opts:     Options{NoCorepack: true},
+			wantName: "pnpm", wantArgs: []string{"run", "build"},
+			wantPM: "pnpm", wantSource: "inferred",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			script := fixtureScript(t, tt.packageJSON, tt.script, tt.pm)
+			inv := Resolve(script, tt.opts)
+			if inv.Name != tt.wantName || !reflect.DeepEqual(inv.Args, tt.wantArgs) {
+				t.Errorf("Resolve ran %s %q, want %s %q", inv.Name, inv.Args, tt.wantName, tt.wantArgs)
+			}
+			if inv.PackageManager != tt.wantPM || inv.PMSource != tt.wantSource {
+				t.Errorf("package manager %s (%s), want %s (%s)", inv.PackageManager, inv.PMSource, tt.wantPM, tt.wantSource)
+			}
+			if inv.RunnerReason != tt.wantReason {
+				t.Errorf("RunnerReason = %q, want %q", inv.RunnerReason, tt.wantReason)
+			}
+			if inv.Corepack != tt.wantPinned {
+				t.Errorf("Corepack = %q, want %q", inv.Corepack, tt.wantPinned)
+			}
+			if want := filepath.Dir(script.AbsolutePath); inv.Dir != want {
+				t.Errorf("Dir = %q, want %q", inv.Dir, want)
+			}
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in, want string
+	}{
+		{"build", "build"},
+		{"--port=3000", "--port=3000"},
+		{"@acme/ui", "@acme/ui"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"a;b", "'a;b'"},
+		{`"quoted"`, `'"quoted"'`},
+	}
+	for _, tt := range tests {
+		if got := ShellQuote(tt.in); got != tt.want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		inv  Invocation
+		want string
+	}{
+		{
+			name: "plain",
+			inv:  Invocation{Name: "npm", Args: []string{"run", "build"}, Dir: "packages/ui"},
+			want: "cd packages/ui && npm run build",
+		},
+		{
+			name: "quoted arguments",
+			inv:  Invocation{Name: "node", Args: []string{"--run", "test", "--", "it's", "a b", ""}, Dir: "/tmp/my app"},
+			want: `cd '/tmp/my app' && node --run test -- 'it'\''s' 'a b' ''`,
+		},
+		{
+			name: "environment",
+			inv:  Invocation{Name: "pnpm", Args: []string{"run", "dev"}, Dir: ".", Env: []string{"PORT=3000", "GREETING=hi there"}},
+			want: `cd . && PORT=3000 'GREETING=hi there' pnpm run dev`,
+		},
+		{
+			name: "shell run",
+			inv:  Invocation{Name: "sh", Args: []string{"-c", "tsc -p ."}, Dir: "app", BinPath: "/repo/app/node_modules/.bin"},
+			want: `cd app && PATH=/repo/app/node_modules/.bin:"$PATH" sh -c 'tsc -p .'`,
+		},
+		{
+			name: "clean environment",
+			inv:  Invocation{Name: "npm", Args: []string{"run", "build"}, Dir: "app", BaseEnv: []string{"PATH=/usr/bin", "HOME=/home/me"}, Env: []string{"CI=1"}},
+			want: `cd app && env -i PATH=/usr/bin HOME=/home/me CI=1 npm run build`,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.inv.CommandLine(); got != tt.want {
+			t.Errorf("%s: CommandLine() =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
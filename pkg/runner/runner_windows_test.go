@@ -0,0 +1,63 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antonk52/go-npm-run/pkg/discover"
+)
+
+// shimDir returns a directory holding npm.cmd and pnpm.cmd shims, like an
+// npm installation on Windows has.
+func shimDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"npm.cmd", "pnpm.cmd"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("@exit /b 0\r\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLookupCommandShims(t *testing.T) {
+	for _, pathext := range []string{".COM;.EXE;.BAT;.CMD", ".COM;.EXE", ""} {
+		t.Run("PATHEXT="+pathext, func(t *testing.T) {
+			dir := shimDir(t)
+			t.Setenv("PATH", dir)
+			t.Setenv("PATHEXT", pathext)
+			for _, name := range []string{"npm", "pnpm"} {
+				want := filepath.Join(dir, name+".cmd")
+				if got := LookupCommand(name); !strings.EqualFold(got, want) {
+					t.Errorf("LookupCommand(%q) = %q, want %q", name, got, want)
+				}
+			}
+			if got := LookupCommand("yarn"); got != "yarn" {
+				t.Errorf("LookupCommand(yarn) = %q, want it unchanged when there is no shim", got)
+			}
+		})
+	}
+}
+
+func TestResolveCommandShim(t *testing.T) {
+	dir := shimDir(t)
+	t.Setenv("PATH", dir)
+	t.Setenv("PATHEXT", ".COM;.EXE")
+	path := filepath.Join(t.TempDir(), "package.json")
+	if err := os.WriteFile(path, []byte(`{"scripts": {"build": "tsc"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, scripts, err := discover.ReadPackageJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scripts[0].PackageManager = "pnpm"
+	cmd := Resolve(scripts[0], Options{NoCorepack: true}).Command()
+	if want := filepath.Join(dir, "pnpm.cmd"); !strings.EqualFold(cmd.Path, want) {
+		t.Errorf("Command().Path = %q, want %q", cmd.Path, want)
+	}
+}